@@ -0,0 +1,106 @@
+// Command migrate 执行数据库迁移，数据库连接使用 conf 中 db.<name>.* 的配置
+//
+//	migrate [-db name] [-dir path] [-dry-run] up [version]
+//	migrate [-db name] [-dir path] [-dry-run] down [steps]
+//	migrate [-db name] [-dir path] status
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/go-baa/common/models/base"
+	"github.com/go-baa/setting"
+)
+
+func main() {
+	name := flag.String("db", "default", "数据库配置名称")
+	dir := flag.String("dir", "", "SQL 迁移文件的目录，默认使用 db.<name>.migrations")
+	dryRun := flag.Bool("dry-run", false, "只输出将要执行的迁移")
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: migrate [flags] up [version] | down [steps] | status\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() < 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	config := base.LoadConfigs(*name)
+	config.Migrate = false
+	if *dir == "" {
+		*dir = setting.Config.MustString("db."+*name+".migrations", "")
+	}
+	db, err := base.NewEngine(config)
+	if err != nil {
+		fatal(err)
+	}
+	defer db.Close()
+
+	m, err := base.NewMigrator(db, *dir)
+	if err != nil {
+		fatal(err)
+	}
+	m.DryRun = *dryRun
+
+	switch flag.Arg(0) {
+	case "up":
+		var target int64
+		if flag.NArg() > 1 {
+			if target, err = strconv.ParseInt(flag.Arg(1), 10, 64); err != nil {
+				fatal(fmt.Errorf("invalid version: %s", flag.Arg(1)))
+			}
+		}
+		n, err := m.Up(target)
+		if m.DryRun {
+			fmt.Printf("%d migrations pending (dry run)\n", n)
+		} else {
+			fmt.Printf("%d migrations applied\n", n)
+		}
+		if err != nil {
+			fatal(err)
+		}
+	case "down":
+		steps := 1
+		if flag.NArg() > 1 {
+			if steps, err = strconv.Atoi(flag.Arg(1)); err != nil || steps < 1 {
+				fatal(fmt.Errorf("invalid steps: %s", flag.Arg(1)))
+			}
+		}
+		n, err := m.Down(steps)
+		if m.DryRun {
+			fmt.Printf("%d migrations to roll back (dry run)\n", n)
+		} else {
+			fmt.Printf("%d migrations rolled back\n", n)
+		}
+		if err != nil {
+			fatal(err)
+		}
+	case "status":
+		list, err := m.Status()
+		if err != nil {
+			fatal(err)
+		}
+		for _, v := range list {
+			state := "pending"
+			if v.AppliedAt != nil {
+				state = "applied " + v.AppliedAt.Format(base.TimeFormatDefault)
+			}
+			if v.Missing {
+				state += " (missing)"
+			}
+			fmt.Printf("%-16d %-40s %s\n", v.Version, v.Name, state)
+		}
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+}
+
+func fatal(err error) {
+	fmt.Fprintf(os.Stderr, "migrate: %v\n", err)
+	os.Exit(1)
+}
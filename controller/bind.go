@@ -0,0 +1,589 @@
+package controller
+
+import (
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/go-baa/baa"
+	"github.com/go-baa/common/modules/errors"
+	"github.com/go-baa/common/util"
+)
+
+var (
+	timeType            = reflect.TypeOf(time.Time{})
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
+// Bind 用请求参数填充结构体 dst，并按 valid 标签校验
+// 参数来源依次为 url 查询参数、表单（支持 data[a][b] 形式的嵌套字段）、JSON 请求体，后者覆盖前者
+// 字段名依次取 form 标签、json 标签、字段名，错误提示中的字段名可用 label 标签指定
+// 校验规则写在 valid 标签中，多个规则用 , 分隔，例如：
+//
+//	Mobile string `form:"mobile" valid:"required,mobile"`
+//	Age    int    `form:"age" valid:"min=1,max=150"`
+//	Code   string `form:"code" valid:"len=6,regexp=^\d+$"`
+//
+// 支持的规则：required, min, max, len, regexp 以及 util.Validate 支持的 mobile, email, url, number, ipv4
+// regexp 必须是最后一个规则，所有不合法的字段合并在一个 errors.APIError 中返回，Details 中记录每个字段的提示
+// 请求中没有的字段、空字符串、空列表和 nil 指针视为空，非必填的字段为空时不校验其它规则，数值 0 和 false 照常校验
+// 规则在结构体类型第一次校验时解析并缓存，规则不合法时 panic
+func Bind(c *baa.Context, dst interface{}) error {
+	rv := reflect.ValueOf(dst)
+	if rv.Kind() != reflect.Ptr || rv.Elem().Kind() != reflect.Struct {
+		return Errorf("Bind: dst must be a pointer to struct")
+	}
+
+	if err := c.ParseForm(0); err != nil {
+		return errors.New(errors.ErrParamsInvalid.Code, fmt.Sprintf("请求参数解析失败: %s", err))
+	}
+
+	var invalid []fieldError
+	present := make(map[string]bool)
+	if tree, ok := RequestTree(c).(map[string]interface{}); ok {
+		bindValue(rv.Elem(), tree, "", present, &invalid)
+	}
+
+	if strings.Contains(c.Req.Header.Get("Content-Type"), "application/json") {
+		body, err := c.Body().Bytes()
+		if err != nil {
+			return errors.New(errors.ErrParamsInvalid.Code, fmt.Sprintf("请求内容读取失败: %s", err))
+		}
+		if len(body) > 0 {
+			if err = json.Unmarshal(body, dst); err != nil {
+				invalid = append(invalid, fieldError{"body", fmt.Sprintf("请求内容不是有效的JSON: %s", err)})
+			} else {
+				var data interface{}
+				json.Unmarshal(body, &data)
+				jsonPresent(rv.Elem().Type(), data, "", present)
+			}
+		}
+	}
+
+	// 解析失败的字段已经记录了错误，不再校验规则
+	fields := &bindFields{failed: make(map[string]bool, len(invalid)), present: present}
+	for _, v := range invalid {
+		fields.failed[v.Field] = true
+	}
+	validateStruct(rv.Elem(), "", fields, &invalid)
+	return invalidError(invalid)
+}
+
+// ValidateStruct 按 valid 标签校验结构体，规则同 Bind
+func ValidateStruct(v interface{}) error {
+	rv := reflect.Indirect(reflect.ValueOf(v))
+	if rv.Kind() != reflect.Struct {
+		return Errorf("ValidateStruct: v must be a struct")
+	}
+	var invalid []fieldError
+	validateStruct(rv, "", nil, &invalid)
+	return invalidError(invalid)
+}
+
+// fieldError 不合法的字段及提示
+type fieldError struct {
+	Field   string
+	Message string
+}
+
+// invalidError 合并所有不合法的字段，详细信息中以字段路径为键记录每个字段的提示
+func invalidError(invalid []fieldError) error {
+	if len(invalid) == 0 {
+		return nil
+	}
+	messages := make([]string, 0, len(invalid))
+	details := make([]interface{}, 0, len(invalid)*2)
+	for _, v := range invalid {
+		messages = append(messages, v.Message)
+		details = append(details, v.Field, v.Message)
+	}
+	e := errors.New(errors.ErrParamsInvalid.Code, strings.Join(messages, "; "))
+	return e.WithDetails(details...)
+}
+
+// bindFieldName 返回字段在请求参数中的名字
+func bindFieldName(f reflect.StructField) string {
+	if name := strings.Split(f.Tag.Get("form"), ",")[0]; name != "" {
+		return name
+	}
+	if name := strings.Split(f.Tag.Get("json"), ",")[0]; name != "" {
+		return name
+	}
+	return f.Name
+}
+
+// bindPath 拼接嵌套字段的路径
+func bindPath(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
+
+// bindValue 将请求参数 data 填充到 v，data 可能是 string, []string 或 map[string]interface{}
+// 有值的字段路径记录在 present 中，空字符串不算有值
+func bindValue(v reflect.Value, data interface{}, path string, present map[string]bool, invalid *[]fieldError) {
+	if data == nil || !v.CanSet() {
+		return
+	}
+
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		bindValue(v.Elem(), data, path, present, invalid)
+		return
+	}
+
+	// 自定义类型和时间
+	if v.Type() != timeType && v.Addr().Type().Implements(textUnmarshalerType) {
+		if s, ok := bindString(data); ok {
+			if err := v.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(s)); err != nil {
+				*invalid = append(*invalid, fieldError{path, fmt.Sprintf("%s 格式不正确", path)})
+			}
+		}
+		return
+	}
+
+	switch v.Kind() {
+	case reflect.Struct:
+		if v.Type() == timeType {
+			if s, ok := bindString(data); ok && s != "" {
+				t, err := bindTime(s)
+				if err != nil {
+					*invalid = append(*invalid, fieldError{path, fmt.Sprintf("%s 格式不正确", path)})
+					return
+				}
+				v.Set(reflect.ValueOf(t))
+			}
+			return
+		}
+		m, ok := data.(map[string]interface{})
+		if !ok {
+			return
+		}
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			if f.PkgPath != "" && !f.Anonymous {
+				continue
+			}
+			if f.Anonymous && f.Tag.Get("form") == "" && f.Tag.Get("json") == "" {
+				bindValue(v.Field(i), m, path, present, invalid)
+				continue
+			}
+			name := bindFieldName(f)
+			if name == "-" {
+				continue
+			}
+			if val, ok := m[name]; ok {
+				if s, ok := bindString(val); !ok || strings.TrimSpace(s) != "" {
+					present[bindPath(path, name)] = true
+				}
+				bindValue(v.Field(i), val, bindPath(path, name), present, invalid)
+			}
+		}
+	case reflect.Slice:
+		var items []interface{}
+		switch d := data.(type) {
+		case string:
+			items = append(items, d)
+		case []string:
+			for _, s := range d {
+				items = append(items, s)
+			}
+		case map[string]interface{}:
+			// data[0][name] 形式的列表，按序号排序
+			keys := make([]int, 0, len(d))
+			for k := range d {
+				if i, err := strconv.Atoi(k); err == nil {
+					keys = append(keys, i)
+				}
+			}
+			sort.Ints(keys)
+			for _, k := range keys {
+				items = append(items, d[strconv.Itoa(k)])
+			}
+		}
+		slice := reflect.MakeSlice(v.Type(), len(items), len(items))
+		for i := range items {
+			bindValue(slice.Index(i), items[i], fmt.Sprintf("%s[%d]", path, i), present, invalid)
+		}
+		v.Set(slice)
+	case reflect.Map:
+		m, ok := data.(map[string]interface{})
+		if !ok || v.Type().Key().Kind() != reflect.String {
+			return
+		}
+		nm := reflect.MakeMap(v.Type())
+		for k, val := range m {
+			item := reflect.New(v.Type().Elem()).Elem()
+			if item.Kind() == reflect.Interface {
+				item.Set(reflect.ValueOf(val))
+			} else {
+				bindValue(item, val, bindPath(path, k), present, invalid)
+			}
+			nm.SetMapIndex(reflect.ValueOf(k).Convert(v.Type().Key()), item)
+		}
+		v.Set(nm)
+	case reflect.Interface:
+		v.Set(reflect.ValueOf(data))
+	default:
+		s, ok := bindString(data)
+		if !ok {
+			return
+		}
+		if err := bindBasic(v, s); err != nil {
+			*invalid = append(*invalid, fieldError{path, fmt.Sprintf("%s 格式不正确", path)})
+		}
+	}
+}
+
+// jsonPresent 按 encoding/json 的字段匹配规则，在 present 中记录 JSON 请求体中有值的字段路径
+func jsonPresent(t reflect.Type, data interface{}, path string, present map[string]bool) {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.Struct:
+		m, ok := data.(map[string]interface{})
+		if !ok || t == timeType {
+			return
+		}
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			if f.PkgPath != "" && !f.Anonymous {
+				continue
+			}
+			key := strings.Split(f.Tag.Get("json"), ",")[0]
+			if key == "-" {
+				continue
+			}
+			if f.Anonymous && key == "" {
+				jsonPresent(f.Type, m, path, present)
+				continue
+			}
+			if key == "" {
+				key = f.Name
+			}
+			val, ok := m[key]
+			if !ok {
+				for k, v := range m {
+					if strings.EqualFold(k, key) {
+						val, ok = v, true
+						break
+					}
+				}
+			}
+			if !ok || val == nil {
+				continue
+			}
+			fieldPath := bindPath(path, bindFieldName(f))
+			present[fieldPath] = true
+			jsonPresent(f.Type, val, fieldPath, present)
+		}
+	case reflect.Slice, reflect.Array:
+		items, _ := data.([]interface{})
+		for i, item := range items {
+			jsonPresent(t.Elem(), item, fmt.Sprintf("%s[%d]", path, i), present)
+		}
+	}
+}
+
+// bindString 取请求参数的字符串值，多个值时取最后一个
+func bindString(data interface{}) (string, bool) {
+	switch d := data.(type) {
+	case string:
+		return d, true
+	case []string:
+		if len(d) == 0 {
+			return "", false
+		}
+		return d[len(d)-1], true
+	}
+	return "", false
+}
+
+// bindBasic 将字符串转换为基本类型
+func bindBasic(v reflect.Value, s string) error {
+	s = strings.TrimSpace(s)
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(s)
+	case reflect.Bool:
+		if s == "" {
+			v.SetBool(false)
+			return nil
+		}
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if s == "" {
+			return nil
+		}
+		n, err := strconv.ParseInt(s, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if s == "" {
+			return nil
+		}
+		n, err := strconv.ParseUint(s, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		if s == "" {
+			return nil
+		}
+		n, err := strconv.ParseFloat(s, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetFloat(n)
+	}
+	return nil
+}
+
+// bindTime 解析常见格式的时间
+func bindTime(s string) (time.Time, error) {
+	for _, layout := range []string{"2006-01-02 15:04:05", time.RFC3339, "2006-01-02"} {
+		if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return time.Unix(n, 0), nil
+	}
+	return time.Time{}, fmt.Errorf("invalid time: %s", s)
+}
+
+// validRule 解析后的校验规则
+type validRule struct {
+	name string
+	arg  string
+	n    float64        // min, max, len 的参数
+	re   *regexp.Regexp // regexp 的参数
+}
+
+// validField 结构体字段的校验信息
+type validField struct {
+	index     int
+	name      string // 字段在请求参数中的名字
+	label     string // 错误提示中的名字，为空时使用字段路径
+	anonymous bool
+	required  bool
+	rules     []validRule // 除 required 外的规则
+}
+
+// validFieldsCache 结构体类型 => []validField
+var validFieldsCache sync.Map
+
+// validFields 返回结构体类型的校验信息，每个类型只解析一次规则，规则不合法时 panic
+func validFields(t reflect.Type) []validField {
+	if v, ok := validFieldsCache.Load(t); ok {
+		return v.([]validField)
+	}
+	fields := make([]validField, 0, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" && !f.Anonymous {
+			continue
+		}
+		vf := validField{index: i, name: bindFieldName(f), label: f.Tag.Get("label"), anonymous: f.Anonymous}
+		if rules := f.Tag.Get("valid"); rules != "" && rules != "-" {
+			vf.required, vf.rules = parseRules(t, f, rules)
+		}
+		fields = append(fields, vf)
+	}
+	v, _ := validFieldsCache.LoadOrStore(t, fields)
+	return v.([]validField)
+}
+
+// parseRules 解析 valid 标签，regexp 必须是最后一个规则
+func parseRules(t reflect.Type, f reflect.StructField, rules string) (bool, []validRule) {
+	var required bool
+	var parsed []validRule
+	for len(rules) > 0 {
+		var rule string
+		if strings.HasPrefix(rules, "regexp=") {
+			rule, rules = rules, ""
+		} else if i := strings.IndexByte(rules, ','); i >= 0 {
+			rule, rules = rules[:i], rules[i+1:]
+		} else {
+			rule, rules = rules, ""
+		}
+		rule = strings.TrimSpace(rule)
+		r := validRule{name: rule}
+		if i := strings.IndexByte(rule, '='); i > 0 {
+			r.name, r.arg = rule[:i], rule[i+1:]
+		}
+
+		var err error
+		switch r.name {
+		case "":
+			continue
+		case "required":
+			required = true
+			continue
+		case "min", "max", "len":
+			r.n, err = strconv.ParseFloat(r.arg, 64)
+		case "regexp":
+			r.re, err = regexp.Compile(r.arg)
+		case "mobile", "email", "url", "number", "ipv4":
+		default:
+			panic(fmt.Sprintf("controller.Bind: unknown validate rule '%s' on %s.%s", rule, t, f.Name))
+		}
+		if err != nil {
+			panic(fmt.Sprintf("controller.Bind: invalid validate rule '%s' on %s.%s", rule, t, f.Name))
+		}
+		parsed = append(parsed, r)
+	}
+	return required, parsed
+}
+
+// bindFields Bind 时请求中各字段的情况，ValidateStruct 时为 nil，所有字段都视为有值
+type bindFields struct {
+	failed  map[string]bool // 解析失败的字段，不再校验规则
+	present map[string]bool // 请求中有值的字段
+}
+
+// absent 判断字段是否没有在请求中出现
+func (b *bindFields) absent(path string) bool {
+	return b != nil && !b.present[path]
+}
+
+// validateStruct 校验结构体的所有字段，包括嵌套的结构体，跳过解析失败的字段
+func validateStruct(v reflect.Value, path string, fields *bindFields, invalid *[]fieldError) {
+	for _, f := range validFields(v.Type()) {
+		fv := v.Field(f.index)
+		fieldPath := path
+		absent := false
+		if !f.anonymous {
+			fieldPath = bindPath(path, f.name)
+			if fields != nil && fields.failed[fieldPath] {
+				continue
+			}
+			absent = fields.absent(fieldPath)
+		}
+		label := f.label
+		if label == "" {
+			label = fieldPath
+		}
+		if msg := validateField(fv, label, f, absent); msg != "" {
+			*invalid = append(*invalid, fieldError{fieldPath, msg})
+			continue
+		}
+		validateNested(fv, fieldPath, fields, invalid)
+	}
+}
+
+// validateNested 校验嵌套的结构体及结构体列表
+func validateNested(v reflect.Value, path string, fields *bindFields, invalid *[]fieldError) {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if !v.IsNil() {
+			validateNested(v.Elem(), path, fields, invalid)
+		}
+	case reflect.Struct:
+		if v.Type() != timeType {
+			validateStruct(v, path, fields, invalid)
+		}
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			validateNested(v.Index(i), fmt.Sprintf("%s[%d]", path, i), fields, invalid)
+		}
+	}
+}
+
+// validateField 按规则校验一个字段，返回第一个不满足的规则的提示
+// absent 表示字段没有在请求中出现，与 nil 指针、空字符串、空列表一样视为空，数值 0 和 false 是有效的值
+func validateField(v reflect.Value, label string, f validField, absent bool) string {
+	if !f.required && len(f.rules) == 0 {
+		return ""
+	}
+	empty := absent
+	for !empty && v.Kind() == reflect.Ptr {
+		empty = v.IsNil()
+		v = v.Elem()
+	}
+	if !empty {
+		switch v.Kind() {
+		case reflect.Slice, reflect.Map, reflect.String:
+			empty = v.Len() == 0
+		}
+	}
+	if empty {
+		if f.required {
+			return fmt.Sprintf("%s 不能为空", label)
+		}
+		// 非必填的字段为空时不做其它校验
+		return ""
+	}
+
+	for _, r := range f.rules {
+		switch r.name {
+		case "min", "max", "len":
+			if msg := validateSize(v, label, r.name, r.arg, r.n); msg != "" {
+				return msg
+			}
+		case "regexp":
+			if !r.re.MatchString(fmt.Sprint(v.Interface())) {
+				return fmt.Sprintf("%s 格式不正确", label)
+			}
+		default:
+			if !util.Validate(fmt.Sprint(v.Interface()), r.name) {
+				return fmt.Sprintf("%s 格式不正确", label)
+			}
+		}
+	}
+	return ""
+}
+
+// validateSize 校验数值大小或长度
+func validateSize(v reflect.Value, label, name, arg string, n float64) string {
+	var size float64
+	isLength := true
+	switch v.Kind() {
+	case reflect.String:
+		size = float64(utf8.RuneCountInString(v.String()))
+	case reflect.Slice, reflect.Array, reflect.Map:
+		size = float64(v.Len())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		size, isLength = float64(v.Int()), false
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		size, isLength = float64(v.Uint()), false
+	case reflect.Float32, reflect.Float64:
+		size, isLength = v.Float(), false
+	default:
+		return ""
+	}
+
+	switch {
+	case name == "len" && size != n:
+		return fmt.Sprintf("%s 长度必须为 %s", label, arg)
+	case name == "min" && size < n && isLength:
+		return fmt.Sprintf("%s 长度不能小于 %s", label, arg)
+	case name == "min" && size < n:
+		return fmt.Sprintf("%s 不能小于 %s", label, arg)
+	case name == "max" && size > n && isLength:
+		return fmt.Sprintf("%s 长度不能大于 %s", label, arg)
+	case name == "max" && size > n:
+		return fmt.Sprintf("%s 不能大于 %s", label, arg)
+	}
+	return ""
+}
@@ -0,0 +1,150 @@
+package controller
+
+import (
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-baa/baa"
+	"github.com/go-baa/common/modules/errors"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+type bindAddress struct {
+	City string `form:"city" valid:"required"`
+	Zip  string `form:"zip" valid:"len=6,number"`
+}
+
+type bindUser struct {
+	ID       int           `form:"id" valid:"required,min=1"`
+	Name     string        `form:"name" label:"姓名" valid:"required,max=4"`
+	Mobile   string        `json:"mobile" valid:"mobile"`
+	Tags     []string      `form:"tags"`
+	Score    float64       `form:"score" valid:"max=100"`
+	Birthday time.Time     `form:"birthday"`
+	Address  *bindAddress  `form:"address"`
+	Items    []bindAddress `form:"items"`
+	Code     string        `form:"code" valid:"regexp=^[a-z]{2,3}$"`
+}
+
+func newBindContext(method, target, contentType, body string) *baa.Context {
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	return baa.NewContext(httptest.NewRecorder(), req, baa.New())
+}
+
+func TestBind(t *testing.T) {
+	Convey("测试查询参数和嵌套表单", t, func() {
+		form := url.Values{}
+		form.Set("name", "张三")
+		form.Add("tags[]", "a")
+		form.Add("tags[]", "b")
+		form.Set("address[city]", "北京")
+		form.Set("address[zip]", "100000")
+		form.Set("items[1][city]", "上海")
+		form.Set("items[0][city]", "天津")
+		form.Set("birthday", "2000-01-02")
+		c := newBindContext("POST", "/?id=3&mobile=13800138000&score=99.5", "application/x-www-form-urlencoded", form.Encode())
+
+		u := new(bindUser)
+		err := Bind(c, u)
+		So(err, ShouldBeNil)
+		So(u.ID, ShouldEqual, 3)
+		So(u.Name, ShouldEqual, "张三")
+		So(u.Mobile, ShouldEqual, "13800138000")
+		So(u.Tags, ShouldResemble, []string{"a", "b"})
+		So(u.Score, ShouldEqual, 99.5)
+		So(u.Birthday.Format("2006-01-02"), ShouldEqual, "2000-01-02")
+		So(u.Address.City, ShouldEqual, "北京")
+		So(len(u.Items), ShouldEqual, 2)
+		So(u.Items[0].City, ShouldEqual, "天津")
+		So(u.Items[1].City, ShouldEqual, "上海")
+	})
+
+	Convey("测试JSON请求体", t, func() {
+		c := newBindContext("POST", "/?id=1", "application/json", `{"Name":"李四","mobile":"13800138000","Address":{"City":"广州"}}`)
+		u := new(bindUser)
+		err := Bind(c, u)
+		So(err, ShouldBeNil)
+		So(u.ID, ShouldEqual, 1)
+		So(u.Name, ShouldEqual, "李四")
+		So(u.Address.City, ShouldEqual, "广州")
+	})
+
+	Convey("测试校验失败时返回所有字段", t, func() {
+		c := newBindContext("GET", "/?id=abc&name=abcdef&mobile=123&score=101&address[zip]=12&items[0][zip]=123456&code=x1", "", "")
+		u := new(bindUser)
+		err := Bind(c, u)
+		So(err, ShouldNotBeNil)
+		e, ok := err.(*errors.APIError)
+		So(ok, ShouldBeTrue)
+		So(e.Code, ShouldEqual, errors.ErrParamsInvalid.Code)
+		So(e.Message, ShouldContainSubstring, "id 格式不正确")
+		So(e.Message, ShouldNotContainSubstring, "id 不能为空")
+		So(e.Details["id"], ShouldEqual, "id 格式不正确")
+		So(e.Message, ShouldContainSubstring, "姓名 长度不能大于 4")
+		So(e.Message, ShouldContainSubstring, "mobile 格式不正确")
+		So(e.Message, ShouldContainSubstring, "score 不能大于 100")
+		So(e.Message, ShouldContainSubstring, "address.city 不能为空")
+		So(e.Message, ShouldContainSubstring, "address.zip 长度必须为 6")
+		So(e.Message, ShouldContainSubstring, "items[0].city 不能为空")
+		So(e.Message, ShouldContainSubstring, "code 格式不正确")
+	})
+
+	Convey("测试数值 0 和 false 按规则校验", t, func() {
+		type counter struct {
+			ID     int  `form:"id" valid:"required"`
+			Count  int  `form:"count" valid:"min=1,max=10"`
+			Enable bool `form:"enable"`
+		}
+		// 没有传的字段视为空
+		err := Bind(newBindContext("GET", "/", "", ""), new(counter))
+		So(err, ShouldNotBeNil)
+		So(err.(*errors.APIError).Message, ShouldEqual, "id 不能为空")
+		So(Bind(newBindContext("GET", "/?id=0&count=", "", ""), new(counter)), ShouldBeNil)
+
+		err = Bind(newBindContext("GET", "/?id=0&count=0&enable=false", "", ""), new(counter))
+		So(err, ShouldNotBeNil)
+		So(err.(*errors.APIError).Message, ShouldEqual, "count 不能小于 1")
+
+		err = Bind(newBindContext("POST", "/", "application/json", `{"ID":1,"Count":0}`), new(counter))
+		So(err, ShouldNotBeNil)
+		So(err.(*errors.APIError).Message, ShouldEqual, "count 不能小于 1")
+		So(Bind(newBindContext("POST", "/", "application/json", `{"id":1,"count":null}`), new(counter)), ShouldBeNil)
+
+		So(ValidateStruct(counter{}), ShouldNotBeNil)
+		So(ValidateStruct(counter{Count: 1}), ShouldBeNil)
+	})
+
+	Convey("测试不合法的规则在第一次使用时 panic", t, func() {
+		type badMin struct {
+			Age int `valid:"min=abc"`
+		}
+		type badRegexp struct {
+			Code string `valid:"regexp=[a-"`
+		}
+		type unknownRule struct {
+			Code string `valid:"required,phone"`
+		}
+		// 字段为空时也会检查规则
+		So(func() { ValidateStruct(badMin{}) }, ShouldPanic)
+		So(func() { ValidateStruct(badRegexp{}) }, ShouldPanic)
+		So(func() { ValidateStruct(unknownRule{Code: "1"}) }, ShouldPanic)
+		So(func() { ValidateStruct(bindAddress{}) }, ShouldNotPanic)
+
+		_, ok := validFieldsCache.Load(reflect.TypeOf(bindAddress{}))
+		So(ok, ShouldBeTrue)
+		_, ok = validFieldsCache.Load(reflect.TypeOf(badMin{}))
+		So(ok, ShouldBeFalse)
+	})
+
+	Convey("测试结构体校验", t, func() {
+		So(ValidateStruct(bindAddress{City: "北京"}), ShouldBeNil)
+		So(ValidateStruct(&bindAddress{}), ShouldNotBeNil)
+	})
+}
@@ -0,0 +1,87 @@
+package controller
+
+import (
+	"math"
+	"net/http"
+
+	"github.com/go-baa/baa"
+	"github.com/go-baa/common/modules/errors"
+	"github.com/go-baa/log"
+	"github.com/go-baa/setting"
+)
+
+// Response 通用返回格式，字段同 NormalReturn，Data 可以是任意类型
+type Response struct {
+	Code    int                    `json:"code"`
+	Message string                 `json:"message"`
+	Data    interface{}            `json:"data,omitempty"`
+	Details map[string]interface{} `json:"details,omitempty"`
+}
+
+// PageData 分页数据
+type PageData struct {
+	Items    interface{} `json:"items"`
+	Total    int         `json:"total"`
+	Page     int         `json:"page"`
+	Pagesize int         `json:"pagesize"`
+	Pages    int         `json:"pages"`
+}
+
+// CursorData 游标分页数据
+type CursorData struct {
+	Items      interface{} `json:"items"`
+	NextCursor string      `json:"next_cursor"`
+	HasMore    bool        `json:"has_more"`
+}
+
+// Success 返回成功的结果
+func Success(c *baa.Context, data interface{}) {
+	c.JSON(http.StatusOK, &Response{Code: 0, Message: "ok", Data: data})
+}
+
+// Fail 返回错误的结果，HTTP 状态码取自错误代码在 errors 中注册的状态码
+// 错误消息按 Accept-Language 选择语言，不是 errors.APIError 的错误只记录日志，
+// 返回给客户端的是 errors.ErrInternal，避免泄露数据库等内部错误的信息
+func Fail(c *baa.Context, err error) {
+	e, ok := errors.As(err)
+	if !ok {
+		log.Errorf("%s %s error: %v\n", c.Req.Method, c.Req.RequestURI, err)
+		e = errors.ErrInternal
+	}
+	if setting.Debug && e.Unwrap() != nil {
+		log.Debugf("%s %s error: %v\n%s", c.Req.Method, c.Req.RequestURI, err, e.Stack())
+	}
+	c.JSON(errors.Status(e.Code), &Response{
+		Code:    e.Code,
+		Message: e.Localize(c.Req.Header.Get("Accept-Language")),
+		Details: e.Details,
+	})
+}
+
+// Page 返回分页的结果，page 和 pagesize 按 ConvertPageToOffset 的规则处理
+func Page(c *baa.Context, items interface{}, total, page, pagesize int) {
+	_, pagesize = ConvertPageToOffset(page, pagesize, 0, -1)
+	if page < 1 {
+		page = 1
+	}
+	Success(c, &PageData{
+		Items:    items,
+		Total:    total,
+		Page:     page,
+		Pagesize: pagesize,
+		Pages:    int(math.Ceil(float64(total) / float64(pagesize))),
+	})
+}
+
+// CursorPage 返回游标分页的结果，nextCursor 和 hasMore 通常来自 base.KeysetPage
+// 客户端使用 next_cursor 作为 cursor 参数请求下一页
+func CursorPage(c *baa.Context, items interface{}, nextCursor string, hasMore bool) {
+	if !hasMore {
+		nextCursor = ""
+	}
+	Success(c, &CursorData{
+		Items:      items,
+		NextCursor: nextCursor,
+		HasMore:    hasMore,
+	})
+}
@@ -0,0 +1,91 @@
+package controller
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-baa/baa"
+	"github.com/go-baa/common/modules/errors"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func newResponseContext() (*baa.Context, *httptest.ResponseRecorder) {
+	w := httptest.NewRecorder()
+	return baa.NewContext(w, httptest.NewRequest("GET", "/", nil), baa.New()), w
+}
+
+// compactJSON 重新编码 JSON，消除缩进和字段顺序的差异
+func compactJSON(b []byte) string {
+	var v interface{}
+	json.Unmarshal(b, &v)
+	b, _ = json.Marshal(v)
+	return string(b)
+}
+
+func TestResponse(t *testing.T) {
+	Convey("测试成功返回", t, func() {
+		c, w := newResponseContext()
+		Success(c, map[string]int{"id": 1})
+		So(w.Code, ShouldEqual, http.StatusOK)
+		So(compactJSON(w.Body.Bytes()), ShouldEqual, `{"code":0,"data":{"id":1},"message":"ok"}`)
+	})
+
+	Convey("测试包装过的错误", t, func() {
+		c, w := newResponseContext()
+		Fail(c, fmt.Errorf("check login: %w", errors.ErrUserNeedLogin))
+		So(w.Code, ShouldEqual, http.StatusUnauthorized)
+		ret := new(Response)
+		json.Unmarshal(w.Body.Bytes(), ret)
+		So(ret.Code, ShouldEqual, errors.ErrUserNeedLogin.Code)
+		So(ret.Message, ShouldEqual, errors.ErrUserNeedLogin.Message)
+
+	})
+
+	Convey("测试内部错误不返回给客户端", t, func() {
+		c, w := newResponseContext()
+		Fail(c, fmt.Errorf("dial tcp 10.0.0.1:3306: connection refused"))
+		So(w.Code, ShouldEqual, http.StatusInternalServerError)
+		So(compactJSON(w.Body.Bytes()), ShouldEqual, `{"code":1,"message":"服务器内部错误"}`)
+
+		c, w = newResponseContext()
+		c.Req.Header.Set("Accept-Language", "en")
+		Fail(c, fmt.Errorf("unknown"))
+		So(w.Code, ShouldEqual, http.StatusInternalServerError)
+		So(compactJSON(w.Body.Bytes()), ShouldEqual, `{"code":1,"message":"Internal server error"}`)
+	})
+
+	Convey("测试按 Accept-Language 返回错误消息", t, func() {
+		c, w := newResponseContext()
+		c.Req.Header.Set("Accept-Language", "en-US,en;q=0.8")
+		Fail(c, errors.ErrParamsInvalid.WithDetails("mobile", "mobile 格式不正确"))
+		So(w.Code, ShouldEqual, http.StatusBadRequest)
+		So(compactJSON(w.Body.Bytes()), ShouldEqual, `{"code":1400,"details":{"mobile":"mobile 格式不正确"},"message":"Invalid request parameters"}`)
+	})
+
+	Convey("测试自定义消息不会被翻译", t, func() {
+		c, w := newResponseContext()
+		c.Req.Header.Set("Accept-Language", "en")
+		Fail(c, errors.New(errors.ErrParamsInvalid.Code, "请求参数解析失败: unexpected EOF"))
+		So(w.Code, ShouldEqual, http.StatusBadRequest)
+		So(compactJSON(w.Body.Bytes()), ShouldEqual, `{"code":1400,"message":"请求参数解析失败: unexpected EOF"}`)
+	})
+
+	Convey("测试分页返回", t, func() {
+		c, w := newResponseContext()
+		Page(c, []int{1, 2, 3}, 23, 0, 10)
+		So(compactJSON(w.Body.Bytes()), ShouldEqual, `{"code":0,"data":{"items":[1,2,3],"page":1,"pages":3,"pagesize":10,"total":23},"message":"ok"}`)
+	})
+
+	Convey("测试游标分页返回", t, func() {
+		c, w := newResponseContext()
+		CursorPage(c, []int{1, 2}, "abc", true)
+		So(compactJSON(w.Body.Bytes()), ShouldEqual, `{"code":0,"data":{"has_more":true,"items":[1,2],"next_cursor":"abc"},"message":"ok"}`)
+
+		c, w = newResponseContext()
+		CursorPage(c, []int{}, "abc", false)
+		So(compactJSON(w.Body.Bytes()), ShouldEqual, `{"code":0,"data":{"has_more":false,"items":[],"next_cursor":""},"message":"ok"}`)
+	})
+}
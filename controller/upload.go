@@ -0,0 +1,184 @@
+package controller
+
+import (
+	"bytes"
+	"encoding/base64"
+	"io"
+	"mime"
+	"mime/multipart"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/go-baa/baa"
+	"github.com/go-baa/common/modules/assets"
+	"github.com/go-baa/common/modules/storage"
+	_ "github.com/go-baa/common/modules/storage/local"
+	_ "github.com/go-baa/common/modules/storage/s3"
+	"github.com/go-baa/common/util"
+	"github.com/go-baa/log"
+	"github.com/go-baa/setting"
+)
+
+var (
+	globalUploadExtension string // 全局文件后缀限制
+	globalUploadMaxsize   int64  // 全局文件大小限制
+)
+
+// UploadFile 从Http流中上传一个文件, 返回上传后的文件地址
+// 默认上传获取到的第一个文件，如果指定 fieldName 仅上传指定的文件
+// 允许指定一个附件路径，默认会上传到upload目录，如果有addonPath则附加
+// 文件保存到 upload.<uploadType>.driver 指定的存储，默认为本地磁盘
+// 文件类型以内容识别为准，不符合 upload.<uploadType> 规则时返回 errors.APIError
+func UploadFile(uploadType, fieldName string, c *baa.Context, addonPath string) (string, string, error) {
+	maxSize := setting.Config.MustInt64("upload."+uploadType+".maxsize", globalUploadMaxsize)
+	err := c.Req.ParseMultipartForm(maxSize)
+	if err != nil {
+		return "", "", Errorf("超过上传限制，最大允许 %d m, %s", maxSize, err)
+	}
+
+	// 如果没有指定 文件字段，取第一个获取到的文件
+	if fieldName == "" {
+		for k := range c.Req.MultipartForm.File {
+			fieldName = k
+			break
+		}
+	}
+	files := c.Req.MultipartForm.File[fieldName]
+	if len(files) == 0 {
+		return "", "", Errorf("没有文件被上传")
+	}
+
+	return uploadFileHeader(uploadType, files[0], addonPath)
+}
+
+// UploadResult 批量上传中单个文件的上传结果
+type UploadResult struct {
+	Field    string `json:"field"`    // 表单字段
+	Filename string `json:"filename"` // 原始文件名
+	Path     string `json:"-"`        // 存储路径
+	URI      string `json:"uri"`      // 访问地址
+	Err      error  `json:"-"`        // 上传错误，为 nil 表示成功
+}
+
+// UploadFiles 从Http流中批量上传文件，返回每个文件的上传结果
+// 如果指定 fieldName 仅上传该字段的所有文件，否则上传所有字段的文件
+// 单个文件失败不会中断其它文件，错误记录在对应结果的 Err 中
+func UploadFiles(uploadType, fieldName string, c *baa.Context, addonPath string) ([]*UploadResult, error) {
+	maxSize := setting.Config.MustInt64("upload."+uploadType+".maxsize", globalUploadMaxsize)
+	err := c.Req.ParseMultipartForm(maxSize)
+	if err != nil {
+		return nil, Errorf("超过上传限制，最大允许 %d m, %s", maxSize, err)
+	}
+
+	var fields []string
+	if fieldName != "" {
+		fields = append(fields, fieldName)
+	} else {
+		for k := range c.Req.MultipartForm.File {
+			fields = append(fields, k)
+		}
+		sort.Strings(fields)
+	}
+
+	var results []*UploadResult
+	for _, field := range fields {
+		for _, fh := range c.Req.MultipartForm.File[field] {
+			ret := &UploadResult{Field: field, Filename: fh.Filename}
+			ret.Path, ret.URI, ret.Err = uploadFileHeader(uploadType, fh, addonPath)
+			results = append(results, ret)
+		}
+	}
+	if len(results) == 0 {
+		return nil, Errorf("没有文件被上传")
+	}
+
+	return results, nil
+}
+
+// uploadFileHeader 检查并保存一个表单文件
+func uploadFileHeader(uploadType string, fh *multipart.FileHeader, addonPath string) (string, string, error) {
+	ext := strings.ToLower(filepath.Ext(fh.Filename))
+	if err := checkExtension(uploadType, ext); err != nil {
+		return "", "", err
+	}
+
+	file, err := fh.Open()
+	if err != nil {
+		return "", "", Errorf("文件读取失败: %s", err)
+	}
+	defer file.Close()
+
+	if err = checkUpload(uploadType, ext, file); err != nil {
+		return "", "", err
+	}
+
+	return saveUpload(uploadType, fh.Filename, ext, file, addonPath)
+}
+
+// UploadBase64 上传一个 base64 编码的文件，data 格式为 data:image/png;base64,xxx
+func UploadBase64(uploadType string, alias string, data string, addonPath string) (string, string, error) {
+	parts := strings.Split(data, ",")
+	if len(parts) != 2 {
+		return "", "", Errorf("文件内容格式不正确")
+	}
+	content, err := base64.StdEncoding.DecodeString(parts[1])
+	if err != nil {
+		return "", "", Errorf("文件内容解析失败")
+	}
+
+	maxSize := setting.Config.MustInt64("upload."+uploadType+".maxsize", globalUploadMaxsize)
+	if len(content) > int(maxSize) {
+		return "", "", Errorf("超过上传限制，最大允许 %d m, %s", maxSize, err)
+	}
+
+	ext := strings.ToLower(filepath.Ext(alias))
+	if err = checkExtension(uploadType, ext); err != nil {
+		return "", "", err
+	}
+
+	r := bytes.NewReader(content)
+	if err = checkUpload(uploadType, ext, r); err != nil {
+		return "", "", err
+	}
+
+	return saveUpload(uploadType, alias, ext, r, addonPath)
+}
+
+// checkExtension 检查文件后缀是否在 upload.<uploadType>.extension 允许的列表中
+func checkExtension(uploadType, ext string) error {
+	allowExt := strings.Split(setting.Config.MustString("upload."+uploadType+".extension", globalUploadExtension), ";")
+	if ext == "" || util.InSlice(allowExt, ext, "string") == false {
+		return Errorf("只允许上传指定的格式: %s", strings.Join(allowExt, ";"))
+	}
+	return nil
+}
+
+// saveUpload 保存上传内容到存储，返回存储路径和访问地址
+func saveUpload(uploadType, name, ext string, r io.Reader, addonPath string) (string, string, error) {
+	store, err := storage.New(uploadType)
+	if err != nil {
+		return "", "", Errorf("上传存储初始化失败: %s", err)
+	}
+
+	if addonPath != "" {
+		addonPath = strings.Trim(addonPath, "/") + "/"
+	}
+	key := addonPath + util.RandFileName() + ext
+	dstPath, size, err := store.Put(key, r, mime.TypeByExtension(ext))
+	if err != nil {
+		return "", "", err
+	}
+
+	if setting.Debug {
+		log.Infof("upload a file: %s fileSzie: %d saved to %s\n", name, size, dstPath)
+	}
+
+	return dstPath, assets.AbsoluteUploadURL(store.URL(key)), nil
+}
+
+func init() {
+	// 处理全局的上传配置
+	globalUploadExtension = setting.Config.MustString("upload.extension", "")
+	globalUploadMaxsize = setting.Config.MustInt64("upload.maxsize", 1048576) // 1m
+}
@@ -0,0 +1,146 @@
+package controller
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/go-baa/common/modules/errors"
+	"github.com/go-baa/common/modules/image"
+	"github.com/go-baa/setting"
+)
+
+// sniffLen 内容识别需要读取的字节数
+const sniffLen = 512
+
+// oleContentType OLE 复合文档，即 doc、xls、ppt 等旧版 office 文件
+const oleContentType = "application/x-ole-storage"
+
+// oleMagic OLE 复合文档的文件头
+var oleMagic = []byte{0xD0, 0xCF, 0x11, 0xE0, 0xA1, 0xB1, 0x1A, 0xE1}
+
+// sniffExtTypes 可以通过内容可靠识别的扩展名，及其内容识别的类型
+// 新版 office 文件是 zip 格式，识别为 application/zip
+var sniffExtTypes = map[string]string{
+	".jpg":  "image/jpeg",
+	".jpeg": "image/jpeg",
+	".png":  "image/png",
+	".gif":  "image/gif",
+	".bmp":  "image/bmp",
+	".webp": "image/webp",
+	".pdf":  "application/pdf",
+	".zip":  "application/zip",
+	".gz":   "application/x-gzip",
+	".rar":  "application/x-rar-compressed",
+	".doc":  oleContentType,
+	".xls":  oleContentType,
+	".ppt":  oleContentType,
+	".docx": "application/zip",
+	".xlsx": "application/zip",
+	".pptx": "application/zip",
+	".mp4":  "video/mp4",
+	".webm": "video/webm",
+	".avi":  "video/avi",
+	".wav":  "audio/wave",
+	".ogg":  "application/ogg",
+}
+
+// decodeImageTypes 可以解码检查尺寸的图片类型
+var decodeImageTypes = map[string]bool{
+	"image/jpeg": true,
+	"image/png":  true,
+	"image/gif":  true,
+	"image/bmp":  true,
+	"image/webp": true,
+}
+
+// checkUpload 根据文件内容检查上传文件，检查后将 r 重置到开头
+// upload.<type>.mime 允许的文件类型，多个用 ; 分隔，支持 image/* 的形式，旧版 office 文件为 application/x-ole-storage
+// upload.<type>.minWidth, minHeight, maxWidth, maxHeight 图片尺寸限制
+// upload.<type>.decode 是否完整解码图片，拒绝损坏的图片
+func checkUpload(uploadType, ext string, r io.ReadSeeker) error {
+	contentType, err := sniffContentType(r)
+	if err != nil {
+		return Errorf("文件读取失败: %s", err)
+	}
+
+	// 扩展名可以通过内容识别时，内容必须与扩展名一致
+	if extType, ok := sniffExtTypes[ext]; ok && extType != contentType {
+		return errors.ErrUploadMimeMismatch
+	}
+
+	allowMime := setting.Config.MustString("upload."+uploadType+".mime", "")
+	if allowMime != "" && !matchMime(strings.Split(allowMime, ";"), contentType) {
+		return errors.ErrUploadMimeNotAllowed
+	}
+
+	if !decodeImageTypes[contentType] {
+		return nil
+	}
+
+	minWidth := setting.Config.MustInt("upload."+uploadType+".minWidth", 0)
+	minHeight := setting.Config.MustInt("upload."+uploadType+".minHeight", 0)
+	maxWidth := setting.Config.MustInt("upload."+uploadType+".maxWidth", 0)
+	maxHeight := setting.Config.MustInt("upload."+uploadType+".maxHeight", 0)
+	if minWidth > 0 || minHeight > 0 || maxWidth > 0 || maxHeight > 0 {
+		info, err := image.DetectReader(r)
+		if err != nil {
+			return errors.ErrUploadImageInvalid
+		}
+		if info.Width < minWidth || info.Height < minHeight {
+			return errors.ErrUploadImageTooSmall
+		}
+		if (maxWidth > 0 && info.Width > maxWidth) || (maxHeight > 0 && info.Height > maxHeight) {
+			return errors.ErrUploadImageTooLarge
+		}
+		if _, err = r.Seek(0, io.SeekStart); err != nil {
+			return Errorf("文件读取失败: %s", err)
+		}
+	}
+
+	if setting.Config.MustBool("upload."+uploadType+".decode", false) {
+		if err = image.Verify(r); err != nil {
+			return errors.ErrUploadImageInvalid
+		}
+		if _, err = r.Seek(0, io.SeekStart); err != nil {
+			return Errorf("文件读取失败: %s", err)
+		}
+	}
+
+	return nil
+}
+
+// sniffContentType 读取文件开头识别文件类型，并重置到开头
+func sniffContentType(r io.ReadSeeker) (string, error) {
+	buf := make([]byte, sniffLen)
+	n, err := io.ReadFull(r, buf)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return "", err
+	}
+	if _, err = r.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+	if bytes.HasPrefix(buf[:n], oleMagic) {
+		return oleContentType, nil
+	}
+	contentType := http.DetectContentType(buf[:n])
+	if i := strings.IndexByte(contentType, ';'); i > 0 {
+		contentType = contentType[:i]
+	}
+	return contentType, nil
+}
+
+// matchMime 检查文件类型是否在允许的列表中
+func matchMime(allow []string, contentType string) bool {
+	for _, v := range allow {
+		v = strings.TrimSpace(v)
+		if v == contentType {
+			return true
+		}
+		if strings.HasSuffix(v, "/*") && strings.HasPrefix(contentType, v[:len(v)-1]) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,60 @@
+package controller
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/go-baa/common/modules/errors"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestCheckUpload(t *testing.T) {
+	exe := append([]byte("MZ\x90\x00\x03\x00\x00\x00"), make([]byte, 64)...)
+	ole := append(append([]byte{}, oleMagic...), make([]byte, 64)...)
+	docx := append([]byte("PK\x03\x04"), make([]byte, 64)...)
+	image := pngData(20, 10)
+	corrupted := image[:len(image)-20]
+
+	tests := []struct {
+		name   string
+		config map[string]string
+		ext    string
+		body   []byte
+		err    error
+	}{
+		{"正常的图片", nil, ".png", image, nil},
+		{"改名的非图片", nil, ".png", []byte("hello world"), errors.ErrUploadMimeMismatch},
+		{"扩展名与图片格式不符", nil, ".jpg", image, errors.ErrUploadMimeMismatch},
+		{"改名为 pdf 的可执行文件", nil, ".pdf", exe, errors.ErrUploadMimeMismatch},
+		{"改名为 doc 的可执行文件", nil, ".doc", exe, errors.ErrUploadMimeMismatch},
+		{"改名为 docx 的可执行文件", nil, ".docx", exe, errors.ErrUploadMimeMismatch},
+		{"旧版 office 文件", nil, ".doc", ole, nil},
+		{"新版 office 文件", nil, ".xlsx", docx, nil},
+		{"无法识别的扩展名", nil, ".txt", []byte("hello world"), nil},
+		{"允许的类型", map[string]string{"upload.test.mime": "image/*;text/plain"}, ".txt", []byte("hello world"), nil},
+		{"不允许的类型", map[string]string{"upload.test.mime": "image/*"}, ".txt", []byte("hello world"), errors.ErrUploadMimeNotAllowed},
+		{"允许旧版 office 文件", map[string]string{"upload.test.mime": "application/x-ole-storage"}, ".xls", ole, nil},
+		{"图片尺寸符合", map[string]string{"upload.test.minWidth": "20", "upload.test.maxHeight": "10"}, ".png", image, nil},
+		{"图片宽度过小", map[string]string{"upload.test.minWidth": "21"}, ".png", image, errors.ErrUploadImageTooSmall},
+		{"图片高度过小", map[string]string{"upload.test.minHeight": "11"}, ".png", image, errors.ErrUploadImageTooSmall},
+		{"图片宽度过大", map[string]string{"upload.test.maxWidth": "19"}, ".png", image, errors.ErrUploadImageTooLarge},
+		{"图片高度过大", map[string]string{"upload.test.maxHeight": "9"}, ".png", image, errors.ErrUploadImageTooLarge},
+		{"不检查损坏的图片", nil, ".png", corrupted, nil},
+		{"损坏的图片", map[string]string{"upload.test.decode": "true"}, ".png", corrupted, errors.ErrUploadImageInvalid},
+		{"解码正常的图片", map[string]string{"upload.test.decode": "true"}, ".png", image, nil},
+	}
+
+	Convey("测试根据内容检查上传文件", t, func() {
+		for _, tt := range tests {
+			Convey(tt.name, func() {
+				defer setConfig(tt.config)()
+				r := bytes.NewReader(tt.body)
+				err := checkUpload("test", tt.ext, r)
+				So(err, ShouldEqual, tt.err)
+				if err == nil {
+					So(r.Len(), ShouldEqual, len(tt.body))
+				}
+			})
+		}
+	})
+}
@@ -0,0 +1,254 @@
+package controller
+
+import (
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-baa/common/util"
+	"github.com/go-baa/common/util/uuid"
+	"github.com/go-baa/setting"
+)
+
+const (
+	// DefaultChunkSize 默认分片大小 2m
+	DefaultChunkSize = 2097152
+	// DefaultChunkExpire 未完成的分片上传保留时间，单位：小时
+	DefaultChunkExpire = 24
+)
+
+// chunkIDPattern 分片上传ID格式，防止拼接出上传目录之外的路径
+var chunkIDPattern = regexp.MustCompile(`^[0-9a-f]{32}$`)
+
+// ChunkUpload 分片上传任务
+// 分片保存在 upload.chunk.path 目录，多实例部署时该目录需要共享
+type ChunkUpload struct {
+	ID         string    `json:"id"`
+	UploadType string    `json:"upload_type"`
+	Filename   string    `json:"filename"`
+	Size       int64     `json:"size"`
+	MD5        string    `json:"md5"`
+	ChunkSize  int64     `json:"chunk_size"`
+	ChunkCount int       `json:"chunk_count"`
+	Uploaded   []int     `json:"uploaded"` // 已上传的分片序号，从 0 开始
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// ChunkUploadInit 创建一个分片上传任务
+// size 为文件总大小，md5 为文件内容的 md5 值，为空时不做校验
+func ChunkUploadInit(uploadType, filename string, size int64, md5 string) (*ChunkUpload, error) {
+	ext := strings.ToLower(filepath.Ext(filename))
+	if err := checkExtension(uploadType, ext); err != nil {
+		return nil, err
+	}
+
+	maxSize := setting.Config.MustInt64("upload."+uploadType+".maxsize", globalUploadMaxsize)
+	if size <= 0 || size > maxSize {
+		return nil, Errorf("超过上传限制，最大允许 %d m", maxSize)
+	}
+
+	chunkSize := setting.Config.MustInt64("upload.chunk.size", DefaultChunkSize)
+	if chunkSize <= 0 {
+		chunkSize = DefaultChunkSize
+	}
+	t := &ChunkUpload{
+		ID:         strings.Replace(uuid.NewV4().String(), "-", "", -1),
+		UploadType: uploadType,
+		Filename:   filename,
+		Size:       size,
+		MD5:        strings.ToLower(md5),
+		ChunkSize:  chunkSize,
+		ChunkCount: int(math.Ceil(float64(size) / float64(chunkSize))),
+		Uploaded:   []int{},
+		CreatedAt:  time.Now(),
+	}
+
+	cleanChunkUploads()
+
+	dir := chunkDir(t.ID)
+	if err := util.MkdirAll(dir); err != nil {
+		return nil, Errorf("上传目录创建失败: %s", err)
+	}
+	body, err := json.Marshal(t)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = util.WriteFile(dir+"/meta.json", body); err != nil {
+		return nil, Errorf("文件写入失败: %s", err)
+	}
+
+	return t, nil
+}
+
+// ChunkUploadStatus 获取分片上传任务的状态，客户端可据此跳过已上传的分片继续上传
+func ChunkUploadStatus(id string) (*ChunkUpload, error) {
+	if !chunkIDPattern.MatchString(id) {
+		return nil, Errorf("上传任务不存在")
+	}
+	body, err := util.ReadFile(chunkDir(id) + "/meta.json")
+	if err != nil {
+		return nil, Errorf("上传任务不存在")
+	}
+	t := new(ChunkUpload)
+	if err = json.Unmarshal(body, t); err != nil {
+		return nil, Errorf("上传任务解析失败: %s", err)
+	}
+
+	t.Uploaded = []int{}
+	files, err := util.ReadDir(chunkDir(id))
+	if err != nil {
+		return nil, Errorf("上传任务读取失败: %s", err)
+	}
+	for _, f := range files {
+		if !strings.HasSuffix(f.Name(), ".part") {
+			continue
+		}
+		index, err := strconv.Atoi(strings.TrimSuffix(f.Name(), ".part"))
+		if err == nil {
+			t.Uploaded = append(t.Uploaded, index)
+		}
+	}
+	sort.Ints(t.Uploaded)
+
+	return t, nil
+}
+
+// ChunkUploadAppend 上传一个分片，重复上传同一分片会覆盖之前的内容
+func ChunkUploadAppend(id string, index int, r io.Reader) (*ChunkUpload, error) {
+	t, err := ChunkUploadStatus(id)
+	if err != nil {
+		return nil, err
+	}
+	if index < 0 || index >= t.ChunkCount {
+		return nil, Errorf("分片序号超出范围: %d", index)
+	}
+
+	expectSize := t.ChunkSize
+	if index == t.ChunkCount-1 {
+		expectSize = t.Size - t.ChunkSize*int64(t.ChunkCount-1)
+	}
+
+	// 先写入临时文件，完整后再改名，避免中断时留下不完整的分片
+	part := chunkDir(id) + "/" + strconv.Itoa(index) + ".part"
+	tmp, err := ioutil.TempFile(chunkDir(id), "tmp")
+	if err != nil {
+		return nil, Errorf("文件创建失败: %s", err)
+	}
+	size, err := io.Copy(tmp, io.LimitReader(r, expectSize+1))
+	tmp.Close()
+	if err != nil {
+		os.Remove(tmp.Name())
+		return nil, Errorf("文件写入失败: %s", err)
+	}
+	if size != expectSize {
+		os.Remove(tmp.Name())
+		return nil, Errorf("分片大小不正确，期望 %d 实际 %d", expectSize, size)
+	}
+	if err = os.Rename(tmp.Name(), part); err != nil {
+		os.Remove(tmp.Name())
+		return nil, Errorf("文件写入失败: %s", err)
+	}
+
+	if !util.InSlice(t.Uploaded, index, "int") {
+		t.Uploaded = append(t.Uploaded, index)
+		sort.Ints(t.Uploaded)
+	}
+	return t, nil
+}
+
+// ChunkUploadComplete 合并所有分片并保存到存储，返回上传后的文件地址
+func ChunkUploadComplete(id string, addonPath string) (string, string, error) {
+	t, err := ChunkUploadStatus(id)
+	if err != nil {
+		return "", "", err
+	}
+	if len(t.Uploaded) != t.ChunkCount {
+		return "", "", Errorf("分片未上传完成，已上传 %d/%d", len(t.Uploaded), t.ChunkCount)
+	}
+
+	dir := chunkDir(id)
+	merged := dir + "/merged"
+	if err = mergeChunks(dir, t.ChunkCount, merged); err != nil {
+		return "", "", Errorf("分片合并失败: %s", err)
+	}
+	if t.MD5 != "" && util.MD5File(merged) != t.MD5 {
+		os.Remove(merged)
+		return "", "", Errorf("文件校验失败，md5 不一致")
+	}
+
+	file, err := os.Open(merged)
+	if err != nil {
+		return "", "", Errorf("文件读取失败: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	defer file.Close()
+
+	ext := strings.ToLower(filepath.Ext(t.Filename))
+	if err = checkUpload(t.UploadType, ext, file); err != nil {
+		return "", "", err
+	}
+
+	return saveUpload(t.UploadType, t.Filename, ext, file, addonPath)
+}
+
+// ChunkUploadAbort 取消分片上传任务，删除已上传的分片
+func ChunkUploadAbort(id string) error {
+	if !chunkIDPattern.MatchString(id) {
+		return Errorf("上传任务不存在")
+	}
+	return os.RemoveAll(chunkDir(id))
+}
+
+// mergeChunks 按序号合并分片到 dst
+func mergeChunks(dir string, count int, dst string) error {
+	f, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	for i := 0; i < count; i++ {
+		part, err := os.Open(dir + "/" + strconv.Itoa(i) + ".part")
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(f, part)
+		part.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// chunkBasePath 分片的保存目录
+func chunkBasePath() string {
+	return strings.TrimRight(setting.Config.MustString("upload.chunk.path", os.TempDir()+"/upload-chunks"), "/")
+}
+
+// chunkDir 分片上传任务的保存目录
+func chunkDir(id string) string {
+	return chunkBasePath() + "/" + id
+}
+
+// cleanChunkUploads 清理超过 upload.chunk.expire 小时未完成的任务
+func cleanChunkUploads() {
+	expire := setting.Config.MustInt("upload.chunk.expire", DefaultChunkExpire)
+	files, err := util.ReadDir(chunkBasePath())
+	if err != nil {
+		return
+	}
+	for _, f := range files {
+		if f.IsDir() && chunkIDPattern.MatchString(f.Name()) &&
+			time.Since(f.ModTime()) > time.Hour*time.Duration(expire) {
+			os.RemoveAll(chunkDir(f.Name()))
+		}
+	}
+}
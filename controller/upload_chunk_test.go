@@ -0,0 +1,157 @@
+package controller
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestChunkUpload(t *testing.T) {
+	Convey("测试分片上传", t, func() {
+		dir, reset := setUploadConfig(map[string]string{"upload.chunk.size": "32"})
+		defer reset()
+		chunkPath, err := ioutil.TempDir("", "upload-chunks")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(chunkPath)
+		defer setConfig(map[string]string{"upload.chunk.path": chunkPath})()
+
+		data := pngData(10, 10)
+		sum := md5.Sum(data)
+		chunk := func(i int) []byte {
+			end := (i + 1) * 32
+			if end > len(data) {
+				end = len(data)
+			}
+			return data[i*32 : end]
+		}
+
+		task, err := ChunkUploadInit("test", "a.png", int64(len(data)), strings.ToUpper(hex.EncodeToString(sum[:])))
+		So(err, ShouldBeNil)
+		So(task.ChunkSize, ShouldEqual, 32)
+		So(task.ChunkCount, ShouldEqual, (len(data)+31)/32)
+		So(task.ChunkCount, ShouldBeGreaterThan, 2)
+
+		Convey("乱序和重复上传分片", func() {
+			for i := task.ChunkCount - 1; i >= 0; i-- {
+				_, err := ChunkUploadAppend(task.ID, i, bytes.NewReader(chunk(i)))
+				So(err, ShouldBeNil)
+			}
+			status, err := ChunkUploadAppend(task.ID, 0, bytes.NewReader(chunk(0)))
+			So(err, ShouldBeNil)
+			So(len(status.Uploaded), ShouldEqual, task.ChunkCount)
+
+			path, uri, err := ChunkUploadComplete(task.ID, "big")
+			So(err, ShouldBeNil)
+			So(path, ShouldStartWith, dir+"/test/big/")
+			So(uri, ShouldStartWith, "/upload/test/big/")
+			body, err := ioutil.ReadFile(path)
+			So(err, ShouldBeNil)
+			So(body, ShouldResemble, data)
+
+			// 完成后删除任务
+			_, err = ChunkUploadStatus(task.ID)
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("分片未上传完成", func() {
+			_, err := ChunkUploadAppend(task.ID, 1, bytes.NewReader(chunk(1)))
+			So(err, ShouldBeNil)
+			status, err := ChunkUploadStatus(task.ID)
+			So(err, ShouldBeNil)
+			So(status.Uploaded, ShouldResemble, []int{1})
+			_, _, err = ChunkUploadComplete(task.ID, "")
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("分片序号和大小不正确", func() {
+			_, err := ChunkUploadAppend(task.ID, task.ChunkCount, bytes.NewReader(chunk(0)))
+			So(err, ShouldNotBeNil)
+			_, err = ChunkUploadAppend(task.ID, -1, bytes.NewReader(chunk(0)))
+			So(err, ShouldNotBeNil)
+			_, err = ChunkUploadAppend(task.ID, 0, bytes.NewReader(chunk(0)[:10]))
+			So(err, ShouldNotBeNil)
+			_, err = ChunkUploadAppend(task.ID, 0, bytes.NewReader(append(chunk(0), 'x')))
+			So(err, ShouldNotBeNil)
+			status, err := ChunkUploadStatus(task.ID)
+			So(err, ShouldBeNil)
+			So(status.Uploaded, ShouldBeEmpty)
+		})
+
+		Convey("md5 不一致", func() {
+			data[len(data)-1] ^= 0xff
+			for i := 0; i < task.ChunkCount; i++ {
+				_, err := ChunkUploadAppend(task.ID, i, bytes.NewReader(chunk(i)))
+				So(err, ShouldBeNil)
+			}
+			_, _, err := ChunkUploadComplete(task.ID, "")
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "md5")
+			// 校验失败时保留分片，可以重新上传
+			_, err = ChunkUploadStatus(task.ID)
+			So(err, ShouldBeNil)
+		})
+
+		Convey("取消上传", func() {
+			So(ChunkUploadAbort(task.ID), ShouldBeNil)
+			_, err := ChunkUploadStatus(task.ID)
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("非法的上传ID", func() {
+			for _, id := range []string{"", "../../etc", task.ID + "/..", strings.ToUpper(task.ID), "0123456789abcdef0123456789abcdeg"} {
+				_, err := ChunkUploadStatus(id)
+				So(err, ShouldNotBeNil)
+				_, err = ChunkUploadAppend(id, 0, bytes.NewReader(chunk(0)))
+				So(err, ShouldNotBeNil)
+				_, _, err = ChunkUploadComplete(id, "")
+				So(err, ShouldNotBeNil)
+				So(ChunkUploadAbort(id), ShouldNotBeNil)
+			}
+			_, err := ChunkUploadStatus(task.ID)
+			So(err, ShouldBeNil)
+		})
+
+		Convey("清理过期的任务", func() {
+			old := time.Now().Add(-25 * time.Hour)
+			So(os.Chtimes(chunkDir(task.ID), old, old), ShouldBeNil)
+			other := chunkPath + "/other"
+			So(os.Mkdir(other, 0755), ShouldBeNil)
+			So(os.Chtimes(other, old, old), ShouldBeNil)
+
+			next, err := ChunkUploadInit("test", "b.png", 10, "")
+			So(err, ShouldBeNil)
+			_, err = ChunkUploadStatus(task.ID)
+			So(err, ShouldNotBeNil)
+			_, err = ChunkUploadStatus(next.ID)
+			So(err, ShouldBeNil)
+			_, err = os.Stat(other)
+			So(err, ShouldBeNil)
+		})
+	})
+
+	Convey("测试分片大小配置", t, func() {
+		_, reset := setUploadConfig(map[string]string{"upload.chunk.size": "-1", "upload.test.maxsize": "10485760"})
+		defer reset()
+		chunkPath, err := ioutil.TempDir("", "upload-chunks")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(chunkPath)
+		defer setConfig(map[string]string{"upload.chunk.path": chunkPath})()
+
+		task, err := ChunkUploadInit("test", "a.png", DefaultChunkSize+1, "")
+		So(err, ShouldBeNil)
+		So(task.ChunkSize, ShouldEqual, DefaultChunkSize)
+		So(task.ChunkCount, ShouldEqual, 2)
+
+		_, err = ChunkUploadInit("test", "a.exe", 10, "")
+		So(err, ShouldNotBeNil)
+		_, err = ChunkUploadInit("test", "a.png", 0, "")
+		So(err, ShouldNotBeNil)
+	})
+}
@@ -0,0 +1,180 @@
+package controller
+
+import (
+	"bytes"
+	"encoding/base64"
+	"image"
+	"image/color"
+	"image/png"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/go-baa/baa"
+	"github.com/go-baa/setting"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// uploadFile 测试用的表单文件
+type uploadFile struct {
+	field, name string
+	body        []byte
+}
+
+// pngData 生成 width x height 的 png 图片
+func pngData(width, height int) []byte {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	img.Set(0, 0, color.White)
+	buf := new(bytes.Buffer)
+	png.Encode(buf, img)
+	return buf.Bytes()
+}
+
+// newUploadContext 创建包含上传文件的请求
+func newUploadContext(files ...uploadFile) *baa.Context {
+	body := new(bytes.Buffer)
+	w := multipart.NewWriter(body)
+	for _, f := range files {
+		part, _ := w.CreateFormFile(f.field, f.name)
+		part.Write(f.body)
+	}
+	w.Close()
+	req := httptest.NewRequest("POST", "/upload", body)
+	req.Header.Set("Content-Type", w.FormDataContentType())
+	return baa.NewContext(httptest.NewRecorder(), req, baa.New())
+}
+
+// setConfig 设置配置，返回恢复配置的函数
+func setConfig(values map[string]string) func() {
+	for k, v := range values {
+		setting.Config.Set(k, v)
+	}
+	return func() {
+		for k := range values {
+			setting.Config.Remove(k)
+		}
+	}
+}
+
+// setUploadConfig 设置 test 上传类型保存到临时目录，返回清理的函数
+func setUploadConfig(values map[string]string) (string, func()) {
+	dir, err := ioutil.TempDir("", "upload")
+	if err != nil {
+		panic(err)
+	}
+	config := map[string]string{
+		"upload.basePath":       dir,
+		"upload.baseUri":        "/upload",
+		"upload.test.extension": ".png;.txt",
+		"upload.test.maxsize":   "1048576",
+	}
+	for k, v := range values {
+		config[k] = v
+	}
+	reset := setConfig(config)
+	return dir, func() {
+		reset()
+		os.RemoveAll(dir)
+	}
+}
+
+func TestUploadFile(t *testing.T) {
+	Convey("测试上传文件", t, func() {
+		dir, reset := setUploadConfig(nil)
+		defer reset()
+
+		c := newUploadContext(uploadFile{"file", "a.png", pngData(2, 2)})
+		path, uri, err := UploadFile("test", "", c, "/avatar/")
+		So(err, ShouldBeNil)
+		So(path, ShouldStartWith, dir+"/test/avatar/")
+		So(path, ShouldEndWith, ".png")
+		So(uri, ShouldStartWith, "/upload/test/avatar/")
+		body, err := ioutil.ReadFile(path)
+		So(err, ShouldBeNil)
+		So(body, ShouldResemble, pngData(2, 2))
+
+		Convey("没有指定字段的文件", func() {
+			c := newUploadContext(uploadFile{"file", "a.png", pngData(2, 2)})
+			_, _, err := UploadFile("test", "avatar", c, "")
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("不允许的扩展名", func() {
+			c := newUploadContext(uploadFile{"file", "a.exe", []byte("MZ")})
+			_, _, err := UploadFile("test", "file", c, "")
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
+
+func TestUploadBase64(t *testing.T) {
+	Convey("测试上传 base64 文件", t, func() {
+		dir, reset := setUploadConfig(map[string]string{"upload.test.maxsize": "1024"})
+		defer reset()
+
+		data := "data:image/png;base64," + base64.StdEncoding.EncodeToString(pngData(2, 2))
+		path, uri, err := UploadBase64("test", "a.png", data, "")
+		So(err, ShouldBeNil)
+		So(path, ShouldStartWith, dir+"/test/")
+		So(uri, ShouldStartWith, "/upload/test/")
+		body, err := ioutil.ReadFile(path)
+		So(err, ShouldBeNil)
+		So(body, ShouldResemble, pngData(2, 2))
+
+		_, _, err = UploadBase64("test", "a.png", "image/png;base64", "")
+		So(err, ShouldNotBeNil)
+		_, _, err = UploadBase64("test", "a.png", "data:image/png;base64,!!!", "")
+		So(err, ShouldNotBeNil)
+		_, _, err = UploadBase64("test", "a.png", "data:image/png;base64,"+base64.StdEncoding.EncodeToString(make([]byte, 2048)), "")
+		So(err, ShouldNotBeNil)
+		_, _, err = UploadBase64("test", "a.png", "data:text/plain;base64,"+base64.StdEncoding.EncodeToString([]byte("hello")), "")
+		So(err, ShouldNotBeNil)
+	})
+}
+
+func TestUploadFiles(t *testing.T) {
+	Convey("测试批量上传文件", t, func() {
+		dir, reset := setUploadConfig(nil)
+		defer reset()
+
+		c := newUploadContext(
+			uploadFile{"photos", "a.png", pngData(2, 2)},
+			uploadFile{"photos", "fake.png", []byte("hello")},
+			uploadFile{"attachment", "a.exe", []byte("MZ")},
+			uploadFile{"attachment", "b.txt", []byte("hello")},
+		)
+		results, err := UploadFiles("test", "", c, "")
+		So(err, ShouldBeNil)
+		So(len(results), ShouldEqual, 4)
+
+		// 按字段名排序，单个文件失败不影响其它文件
+		So(results[0].Field, ShouldEqual, "attachment")
+		So(results[0].Filename, ShouldEqual, "a.exe")
+		So(results[0].Err, ShouldNotBeNil)
+		So(results[1].Filename, ShouldEqual, "b.txt")
+		So(results[1].Err, ShouldBeNil)
+		So(results[1].Path, ShouldStartWith, dir+"/test/")
+		So(results[2].Field, ShouldEqual, "photos")
+		So(results[2].Err, ShouldBeNil)
+		So(results[2].URI, ShouldStartWith, "/upload/test/")
+		So(results[3].Filename, ShouldEqual, "fake.png")
+		So(results[3].Err, ShouldNotBeNil)
+
+		Convey("只上传指定字段的文件", func() {
+			c := newUploadContext(
+				uploadFile{"photos", "a.png", pngData(2, 2)},
+				uploadFile{"attachment", "b.txt", []byte("hello")},
+			)
+			results, err := UploadFiles("test", "photos", c, "")
+			So(err, ShouldBeNil)
+			So(len(results), ShouldEqual, 1)
+			So(results[0].Filename, ShouldEqual, "a.png")
+
+			c = newUploadContext(uploadFile{"photos", "a.png", pngData(2, 2)})
+			_, err = UploadFiles("test", "attachment", c, "")
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
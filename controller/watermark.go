@@ -0,0 +1,261 @@
+package controller
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/go-baa/common/util"
+	"github.com/go-baa/setting"
+	"golang.org/x/image/draw"
+)
+
+// WatermarkPosition 水印位置，九宫格或自定义坐标
+type WatermarkPosition int
+
+// 水印位置
+const (
+	WatermarkBottomRight WatermarkPosition = iota // 右下角，默认
+	WatermarkTopLeft
+	WatermarkTop
+	WatermarkTopRight
+	WatermarkLeft
+	WatermarkCenter
+	WatermarkRight
+	WatermarkBottomLeft
+	WatermarkBottom
+	WatermarkCustom // 使用 X, Y 指定水印左上角的坐标
+)
+
+const (
+	// DefaultWatermarkFontSize 文字水印默认字号
+	DefaultWatermarkFontSize = 24
+	// DefaultWatermarkQuality JPEG 默认质量
+	DefaultWatermarkQuality = 90
+	// DefaultWatermarkOpacity 默认不透明度
+	DefaultWatermarkOpacity = 1
+)
+
+// WatermarkOptions 水印配置
+type WatermarkOptions struct {
+	Image      string            // 水印图片路径
+	Text       string            // 文字水印，设置了 Image 时忽略
+	FontFamily []byte            // 文字水印的字体，默认 gomono
+	FontSize   float64           // 文字水印的字号，默认 24
+	Color      string            // 文字水印的颜色，如 #FFFFFF，默认白色
+	Position   WatermarkPosition // 水印位置，默认右下角
+	X, Y       int               // Position 为 WatermarkCustom 时水印左上角的坐标
+	MarginX    int               // 水印距左右边缘的距离
+	MarginY    int               // 水印距上下边缘的距离
+	Opacity    float64           // 不透明度 0~1，默认 1 即完全不透明，0 表示未设置
+	Scale      float64           // 水印宽度占原图宽度的比例，0 表示保持原始大小
+	Quality    int               // JPEG 图片质量，默认 90
+}
+
+// Watermark 添加图片水印到右下角，watermarkImg 为空时使用 static.basePath 下的默认水印
+// newImg 为空时覆盖原图
+func Watermark(sourceImg, newImg, watermarkImg string) (string, error) {
+	if watermarkImg == "" {
+		staticPath := setting.Config.MustString("static.basePath", "")
+		staticPath, err := filepath.Abs(staticPath)
+		if err != nil {
+			return "", err
+		}
+		watermarkImg = staticPath + "/images/watermark/watermark.png"
+	}
+	return WatermarkWithOptions(sourceImg, newImg, &WatermarkOptions{
+		Image:    watermarkImg,
+		Position: WatermarkBottomRight,
+		MarginX:  20,
+		MarginY:  10,
+		Quality:  100,
+	})
+}
+
+// WatermarkWithOptions 按配置添加图片或文字水印，保持原图的格式，支持 JPEG, PNG, GIF
+// newImg 为空时覆盖原图
+func WatermarkWithOptions(sourceImg, newImg string, opts *WatermarkOptions) (string, error) {
+	if opts == nil || (opts.Image == "" && opts.Text == "") {
+		return "", Errorf("水印图片和文字不能同时为空")
+	}
+	if newImg == "" {
+		newImg = sourceImg
+	}
+
+	body, err := ioutil.ReadFile(sourceImg)
+	if err != nil {
+		return "", Errorf("原图读取失败: %s", err)
+	}
+	config, format, err := image.DecodeConfig(bytes.NewReader(body))
+	if err != nil {
+		return "", Errorf("原图解析失败: %s", err)
+	}
+	if format != "jpeg" && format != "png" && format != "gif" {
+		return "", Errorf("不支持的图片格式: %s", format)
+	}
+
+	mark, err := watermarkImage(opts, config.Width)
+	if err != nil {
+		return "", err
+	}
+	offset := watermarkOffset(opts, config.Width, config.Height, mark.Bounds().Dx(), mark.Bounds().Dy())
+	opacity := opts.Opacity
+	if opacity <= 0 || opacity > 1 {
+		opacity = DefaultWatermarkOpacity
+	}
+	var mask image.Image
+	if opacity < 1 {
+		mask = image.NewUniform(color.Alpha{uint8(opacity * 255)})
+	}
+	markRect := mark.Bounds().Sub(mark.Bounds().Min).Add(offset)
+
+	if err = util.MkdirAll(filepath.Dir(newImg)); err != nil {
+		return "", Errorf("目录创建失败: %s", err)
+	}
+	var buf bytes.Buffer
+	switch format {
+	case "gif":
+		g, err := gif.DecodeAll(bytes.NewReader(body))
+		if err != nil {
+			return "", Errorf("原图解析失败: %s", err)
+		}
+		for _, frame := range g.Image {
+			r := markRect.Intersect(frame.Bounds())
+			if r.Empty() {
+				continue
+			}
+			draw.DrawMask(frame, r, mark, mark.Bounds().Min.Add(r.Min.Sub(offset)), mask, image.ZP, draw.Over)
+		}
+		err = gif.EncodeAll(&buf, g)
+		if err != nil {
+			return "", Errorf("图片编码失败: %s", err)
+		}
+	default:
+		img, _, err := image.Decode(bytes.NewReader(body))
+		if err != nil {
+			return "", Errorf("原图解析失败: %s", err)
+		}
+		b := img.Bounds()
+		m := image.NewNRGBA(b)
+		draw.Draw(m, b, img, b.Min, draw.Src)
+		draw.DrawMask(m, markRect.Add(b.Min), mark, mark.Bounds().Min, mask, image.ZP, draw.Over)
+		if format == "png" {
+			err = png.Encode(&buf, m)
+		} else {
+			quality := opts.Quality
+			if quality <= 0 || quality > 100 {
+				quality = DefaultWatermarkQuality
+			}
+			err = jpeg.Encode(&buf, m, &jpeg.Options{Quality: quality})
+		}
+		if err != nil {
+			return "", Errorf("图片编码失败: %s", err)
+		}
+	}
+
+	if err = ioutil.WriteFile(newImg, buf.Bytes(), 0666); err != nil {
+		return "", Errorf("图片保存失败: %s", err)
+	}
+	return newImg, nil
+}
+
+// watermarkImage 生成水印图像，按 Scale 缩放到原图宽度的比例
+func watermarkImage(opts *WatermarkOptions, width int) (image.Image, error) {
+	var mark image.Image
+	if opts.Image != "" {
+		f, err := os.Open(opts.Image)
+		if err != nil {
+			return nil, Errorf("水印图片读取失败: %s", err)
+		}
+		defer f.Close()
+		mark, _, err = image.Decode(f)
+		if err != nil {
+			return nil, Errorf("水印图片解析失败: %s", err)
+		}
+	} else {
+		var err error
+		mark, err = watermarkText(opts)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if opts.Scale <= 0 {
+		return mark, nil
+	}
+	b := mark.Bounds()
+	w := int(float64(width) * opts.Scale)
+	h := w * b.Dy() / b.Dx()
+	if w <= 0 || h <= 0 {
+		return mark, nil
+	}
+	scaled := image.NewNRGBA(image.Rect(0, 0, w, h))
+	draw.CatmullRom.Scale(scaled, scaled.Bounds(), mark, b, draw.Src, nil)
+	return scaled, nil
+}
+
+// watermarkText 绘制文字水印
+func watermarkText(opts *WatermarkOptions) (image.Image, error) {
+	fontSize := opts.FontSize
+	if fontSize <= 0 {
+		fontSize = DefaultWatermarkFontSize
+	}
+	c := color.RGBA{255, 255, 255, 255}
+	if opts.Color != "" {
+		var err error
+		c, err = util.HexColor2RGBA(opts.Color)
+		if err != nil {
+			return nil, Errorf("水印颜色不正确: %s", err)
+		}
+	}
+	if opts.Text == "" {
+		return nil, Errorf("水印文字不能为空")
+	}
+
+	mark, err := util.GenerateTextImageWithSize(opts.Text, opts.FontFamily, fontSize, c)
+	if err != nil {
+		return nil, Errorf("水印文字绘制失败: %s", err)
+	}
+	return mark, nil
+}
+
+// watermarkOffset 计算水印左上角在原图中的坐标
+func watermarkOffset(opts *WatermarkOptions, width, height, markWidth, markHeight int) image.Point {
+	if opts.Position == WatermarkCustom {
+		return image.Pt(opts.X, opts.Y)
+	}
+
+	left := opts.MarginX
+	center := (width - markWidth) / 2
+	right := width - markWidth - opts.MarginX
+	top := opts.MarginY
+	middle := (height - markHeight) / 2
+	bottom := height - markHeight - opts.MarginY
+
+	switch opts.Position {
+	case WatermarkTopLeft:
+		return image.Pt(left, top)
+	case WatermarkTop:
+		return image.Pt(center, top)
+	case WatermarkTopRight:
+		return image.Pt(right, top)
+	case WatermarkLeft:
+		return image.Pt(left, middle)
+	case WatermarkCenter:
+		return image.Pt(center, middle)
+	case WatermarkRight:
+		return image.Pt(right, middle)
+	case WatermarkBottomLeft:
+		return image.Pt(left, bottom)
+	case WatermarkBottom:
+		return image.Pt(center, bottom)
+	default:
+		return image.Pt(right, bottom)
+	}
+}
@@ -0,0 +1,133 @@
+package controller
+
+import (
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func writeTestImage(file string, w, h int, c color.Color) {
+	m := image.NewRGBA(image.Rect(0, 0, w, h))
+	for x := 0; x < w; x++ {
+		for y := 0; y < h; y++ {
+			m.Set(x, y, c)
+		}
+	}
+	f, _ := os.Create(file)
+	defer f.Close()
+	switch filepath.Ext(file) {
+	case ".jpg":
+		jpeg.Encode(f, m, nil)
+	case ".gif":
+		gif.Encode(f, m, nil)
+	default:
+		png.Encode(f, m)
+	}
+}
+
+func TestWatermark(t *testing.T) {
+	dir := t.TempDir()
+	writeTestImage(dir+"/src.jpg", 200, 100, color.Black)
+	writeTestImage(dir+"/src.png", 200, 100, color.Black)
+	writeTestImage(dir+"/src.gif", 200, 100, color.Black)
+	writeTestImage(dir+"/mark.png", 20, 10, color.White)
+
+	Convey("测试图片水印", t, func() {
+		dst, err := Watermark(dir+"/src.jpg", dir+"/dst.jpg", dir+"/mark.png")
+		So(err, ShouldBeNil)
+		So(dst, ShouldEqual, dir+"/dst.jpg")
+		f, _ := os.Open(dst)
+		img, format, err := image.Decode(f)
+		f.Close()
+		So(err, ShouldBeNil)
+		So(format, ShouldEqual, "jpeg")
+		r, _, _, _ := img.At(200-20-10, 100-10-5).RGBA()
+		So(r>>8, ShouldBeGreaterThan, 200)
+		r, _, _, _ = img.At(5, 5).RGBA()
+		So(r>>8, ShouldBeLessThan, 50)
+	})
+
+	Convey("测试水印位置和缩放", t, func() {
+		dst, err := WatermarkWithOptions(dir+"/src.png", dir+"/dst.png", &WatermarkOptions{
+			Image:    dir + "/mark.png",
+			Position: WatermarkTopLeft,
+			MarginX:  5,
+			MarginY:  5,
+			Scale:    0.5,
+			Opacity:  0.5,
+		})
+		So(err, ShouldBeNil)
+		f, _ := os.Open(dst)
+		img, format, err := image.Decode(f)
+		f.Close()
+		So(err, ShouldBeNil)
+		So(format, ShouldEqual, "png")
+		r, _, _, _ := img.At(100, 50).RGBA()
+		So(r>>8, ShouldBeBetween, 100, 160)
+		r, _, _, _ = img.At(106, 51).RGBA()
+		So(r>>8, ShouldEqual, 0)
+	})
+
+	Convey("测试GIF文字水印", t, func() {
+		dst, err := WatermarkWithOptions(dir+"/src.gif", dir+"/dst.gif", &WatermarkOptions{
+			Text:     "baa",
+			Position: WatermarkCenter,
+		})
+		So(err, ShouldBeNil)
+		f, _ := os.Open(dst)
+		_, format, err := image.DecodeConfig(f)
+		f.Close()
+		So(err, ShouldBeNil)
+		So(format, ShouldEqual, "gif")
+	})
+
+	Convey("测试文字水印颜色和默认不透明度", t, func() {
+		mark, err := watermarkText(&WatermarkOptions{Text: "baa", Color: "#F00", FontSize: 20})
+		So(err, ShouldBeNil)
+		So(mark.Bounds().Dx(), ShouldEqual, 36)
+
+		dst, err := WatermarkWithOptions(dir+"/src.png", dir+"/text.png", &WatermarkOptions{
+			Text:     "baa",
+			Color:    "#F00",
+			FontSize: 20,
+			Position: WatermarkTopLeft,
+		})
+		So(err, ShouldBeNil)
+		f, _ := os.Open(dst)
+		img, _, err := image.Decode(f)
+		f.Close()
+		So(err, ShouldBeNil)
+		// Opacity 为 0 时不透明，文字的像素是纯红色
+		var red int
+		b := mark.Bounds()
+		for x := 0; x < b.Dx(); x++ {
+			for y := 0; y < b.Dy(); y++ {
+				if r, g, _, _ := img.At(x, y).RGBA(); r>>8 == 255 && g == 0 {
+					red++
+				}
+			}
+		}
+		So(red, ShouldBeGreaterThan, 0)
+
+		_, err = watermarkText(&WatermarkOptions{Text: "baa", Color: "red"})
+		So(err, ShouldNotBeNil)
+		_, err = watermarkText(&WatermarkOptions{Text: "baa", FontFamily: []byte("none")})
+		So(err, ShouldNotBeNil)
+	})
+
+	Convey("测试错误返回", t, func() {
+		_, err := Watermark(dir+"/none.jpg", "", dir+"/mark.png")
+		So(err, ShouldNotBeNil)
+		_, err = Watermark(dir+"/src.jpg", dir+"/dst2.jpg", dir+"/none.png")
+		So(err, ShouldNotBeNil)
+		_, err = WatermarkWithOptions(dir+"/src.jpg", "", &WatermarkOptions{})
+		So(err, ShouldNotBeNil)
+	})
+}
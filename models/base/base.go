@@ -1,9 +1,13 @@
 package base
 
 import (
+	"context"
 	"fmt"
+	"net"
 	"os"
 	"path"
+	"runtime/debug"
+	"strconv"
 	"strings"
 	"time"
 
@@ -13,6 +17,8 @@ import (
 	"github.com/go-baa/setting"
 	"github.com/jinzhu/gorm"
 	_ "github.com/jinzhu/gorm/dialects/mysql"
+	_ "github.com/jinzhu/gorm/dialects/postgres"
+	_ "github.com/jinzhu/gorm/dialects/sqlite"
 )
 
 // MapParams 声明一个通用的参数结构
@@ -21,6 +27,15 @@ type MapParams map[string]interface{}
 // DbConfig database config struct
 type DbConfig struct {
 	Type, Host, Name, User, Passwd, Path, SSLMode string
+
+	MaxOpen     int           // 最大连接数，0 表示不限制
+	MaxIdle     int           // 最大空闲连接数，0 使用驱动默认值
+	MaxLifetime time.Duration // 连接最长复用时间，0 表示不限制
+
+	Replicas []*DbConfig // 只读从库，通过 Cluster 使用
+
+	Migrate    bool   // 连接后执行数据库迁移
+	Migrations string // SQL 迁移文件的目录
 }
 
 // Errorf 对fmt.Errorf()的一个包装
@@ -34,39 +49,93 @@ func Errorf(format string, a ...interface{}) error {
 // LoadConfigs 加载数据库配置
 func LoadConfigs(name string) *DbConfig {
 	config := new(DbConfig)
+	config.Type = setting.Config.MustString("db."+name+".type", "mysql")
+	config.Path = setting.Config.MustString("db."+name+".path", "")
+	config.SSLMode = setting.Config.MustString("db."+name+".sslmode", "")
 	config.Host = setting.Config.MustString("db."+name+".host", "")
 	config.Name = setting.Config.MustString("db."+name+".name", "")
 	config.User = setting.Config.MustString("db."+name+".user", "")
 	config.Passwd = setting.Config.MustString("db."+name+".pass", "")
+	config.MaxOpen = setting.Config.MustInt("db."+name+".maxOpen", 0)
+	config.MaxIdle = setting.Config.MustInt("db."+name+".maxIdle", 0)
+	config.MaxLifetime = time.Duration(setting.Config.MustInt("db."+name+".maxLifetime", 0)) * time.Second
+	config.Migrate = setting.Config.MustBool("db."+name+".migrate", false)
+	config.Migrations = setting.Config.MustString("db."+name+".migrations", "")
+
+	// 从库使用 db.<name>.replicas 配置，多个地址用 ; 分隔，默认使用主库的账号和库名
+	for _, host := range strings.Split(setting.Config.MustString("db."+name+".replicas", ""), ";") {
+		host = strings.TrimSpace(host)
+		if host == "" {
+			continue
+		}
+		replica := *config
+		replica.Host = host
+		replica.User = setting.Config.MustString("db."+name+".replica.user", config.User)
+		replica.Passwd = setting.Config.MustString("db."+name+".replica.pass", config.Passwd)
+		replica.Replicas = nil
+		replica.Migrate = false
+		config.Replicas = append(config.Replicas, &replica)
+	}
 	return config
 }
 
-// setLogger 切换日志
-func setLogger(db *gorm.DB, date string) {
-	logpath := strings.TrimRight(setting.Config.MustString("orm.logpath", "data/log"), "/")
-	logfile := logpath + "/orm-" + date + ".log"
-
-	if logpath == "os.Stderr" || logpath == "os.Stdout" {
-		db.SetLogger(gorm.Logger{LogWriter: log.New(os.Stdout, "[orm]", 0)})
-	} else {
-		os.MkdirAll(path.Dir(logfile), os.ModePerm)
-		f, err := os.OpenFile(logfile, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0666)
-		if err == nil {
-			db.SetLogger(log.New(f, "[orm]", 0))
+// dataSource 根据数据库类型返回 gorm 的方言名称和连接字符串
+func dataSource(config *DbConfig) (string, string, error) {
+	switch config.Type {
+	case "", "mysql":
+		if config.Host == "" {
+			return "", "", Errorf("mysql host is empty")
+		}
+		if config.Host[0] == '/' { // looks like a unix socket
+			return "mysql", fmt.Sprintf("%s:%s@unix(%s)/%s?charset=utf8mb4&timeout=3s&parseTime=true&loc=Local",
+				config.User, config.Passwd, config.Host, config.Name), nil
 		}
+		return "mysql", fmt.Sprintf("%s:%s@tcp(%s)/%s?charset=utf8mb4&timeout=3s&parseTime=true&loc=Local",
+			config.User, config.Passwd, config.Host, config.Name), nil
+	case "postgres":
+		host, port := config.Host, "5432"
+		if h, p, err := net.SplitHostPort(config.Host); err == nil {
+			host, port = h, p
+		}
+		sslMode := config.SSLMode
+		if sslMode == "" {
+			sslMode = "disable"
+		}
+		return "postgres", fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=%s connect_timeout=3",
+			pgQuote(host), port, pgQuote(config.User), pgQuote(config.Passwd), pgQuote(config.Name), sslMode), nil
+	case "sqlite3", "sqlite":
+		dsn := config.Path
+		if dsn == "" {
+			return "", "", Errorf("sqlite3 path is empty")
+		}
+		if dsn != ":memory:" && !strings.HasPrefix(dsn, "file:") {
+			os.MkdirAll(path.Dir(dsn), os.ModePerm)
+		}
+		if strings.IndexByte(dsn, '?') < 0 {
+			dsn += "?"
+		} else {
+			dsn += "&"
+		}
+		return "sqlite3", dsn + "_loc=auto&_busy_timeout=3000", nil
+	default:
+		return "", "", Errorf("unsupported database type: %s", config.Type)
+	}
+}
+
+// pgQuote 按 postgres 连接字符串的规则转义参数值
+func pgQuote(v string) string {
+	if v != "" && !strings.ContainsAny(v, ` '\`) {
+		return v
 	}
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(v) + "'"
 }
 
 func getEngine(config *DbConfig) (*gorm.DB, error) {
-	cnnstr := ""
-	if config.Host[0] == '/' { // looks like a unix socket
-		cnnstr = fmt.Sprintf("%s:%s@unix(%s)/%s?charset=utf8mb4&timeout=3s&parseTime=true&loc=Local",
-			config.User, config.Passwd, config.Host, config.Name)
-	} else {
-		cnnstr = fmt.Sprintf("%s:%s@tcp(%s)/%s?charset=utf8mb4&timeout=3s&parseTime=true&loc=Local",
-			config.User, config.Passwd, config.Host, config.Name)
+	dialect, dsn, err := dataSource(config)
+	if err != nil {
+		return nil, err
 	}
-	return gorm.Open("mysql", cnnstr)
+	return gorm.Open(dialect, dsn)
 }
 
 // NewEngine ...
@@ -76,37 +145,40 @@ func NewEngine(config *DbConfig) (*gorm.DB, error) {
 		return nil, fmt.Errorf("Fail to connect to database: %v", err)
 	}
 
+	// 连接池
+	if config.MaxOpen > 0 {
+		db.DB().SetMaxOpenConns(config.MaxOpen)
+	}
+	if config.MaxIdle > 0 {
+		db.DB().SetMaxIdleConns(config.MaxIdle)
+	}
+	if config.MaxLifetime > 0 {
+		db.DB().SetConnMaxLifetime(config.MaxLifetime)
+	}
+
 	// 关闭tableName自动复数
 	db.SingularTable(true)
 
-	// 默认不打印日志
-	db.LogMode(false)
-
-	// 设置日志
-	if baa.Env != baa.PROD {
-		// 设置日志
+	// 设置日志，不记录任何日志时关闭
+	if logger := DefaultLogger(); logger != nil {
 		db.LogMode(true)
-		date := time.Now().Format("2006-01-02")
-		setLogger(db, date)
-		// 设置日志轮询
-		go func(x *gorm.DB, date string) {
-			var dateNew string
-			for {
-				dateNew = time.Now().Format("2006-01-02")
-				if dateNew == date {
-					time.Sleep(time.Second * 1)
-					continue
-				}
-				date = dateNew
-				setLogger(db, date)
-			}
-		}(db, date)
+		db.SetLogger(logger)
+	} else {
+		db.LogMode(false)
+	}
+
+	// 数据库迁移
+	if config.Migrate {
+		if err = Migrate(db, config.Migrations); err != nil {
+			db.Close()
+			return nil, fmt.Errorf("Fail to migrate database: %v", err)
+		}
 	}
 
 	return db, nil
 }
 
-// DB 在gorm.DB基础上封装了嵌套事务的支持，实际上是一次性提交
+// DB 在gorm.DB基础上封装了嵌套事务的支持，内层事务使用保存点实现，可以单独回滚
 type DB struct {
 	*gorm.DB
 	ox               *gorm.DB
@@ -122,25 +194,52 @@ func NewDB(db *gorm.DB, tx bool) *DB {
 	return &DB{db, nil, false, 0}
 }
 
-// SetLogger 设置日志
+// SetLogger 使用 orm.* 配置的日志，日志会自动按日期切分，date 参数已不再使用
 func (t *DB) SetLogger(date string) {
-	setLogger(t.DB, date)
+	if logger := DefaultLogger(); logger != nil {
+		t.DB.LogMode(true)
+		t.DB.SetLogger(logger)
+	} else {
+		t.DB.LogMode(false)
+	}
 }
 
-// Begin 开启事务
+// Begin 开启事务，已在事务中时创建保存点
+// 失败时事务层级不变，错误记录在 t.Error 中，之后的操作都会返回该错误，不需要再 Commit 或 Rollback
 func (t *DB) Begin() *DB {
+	return t.BeginContext(context.Background())
+}
+
+// BeginContext 使用 ctx 开启事务，已在事务中时创建保存点，失败时同 Begin
+func (t *DB) BeginContext(ctx context.Context) *DB {
+	if err := t.begin(ctx); err != nil {
+		// 复制连接后再记录错误，不影响共享的 gorm.DB
+		t.DB = t.DB.New()
+		t.DB.AddError(err)
+	}
+	return t
+}
+
+// begin 开启事务或创建保存点，失败时恢复原来的连接和事务层级，返回执行的错误
+func (t *DB) begin(ctx context.Context) error {
 	if !t.tx {
 		log.Panic("[orm] db.Begin error: current connection not support transaction\n")
 	}
 	if t.transactionLevel == 0 {
+		tx := t.DB.BeginTx(ctx, nil)
+		if tx.Error != nil {
+			return tx.Error
+		}
 		t.ox = t.DB
-		t.DB = t.DB.Begin()
+		t.DB = tx.Set(cachePendingSetting, new(pendingKeys))
+	} else if err := t.DB.Exec("SAVEPOINT " + savepointName(t.transactionLevel)).Error; err != nil {
+		return err
 	}
 	t.transactionLevel++
-	return t
+	return nil
 }
 
-// Rollback 回滚事务
+// Rollback 回滚事务，内层事务回滚到对应的保存点
 func (t *DB) Rollback() *gorm.DB {
 	t.transactionLevel--
 	if t.transactionLevel == 0 {
@@ -150,30 +249,88 @@ func (t *DB) Rollback() *gorm.DB {
 	} else if t.transactionLevel < 0 {
 		log.Panic("[orm] db.Rollback error: over transaction level\n")
 	}
-	return t.DB
+	return t.DB.Exec("ROLLBACK TO SAVEPOINT " + savepointName(t.transactionLevel))
 }
 
-// Commit 提交事务
+// Commit 提交事务，内层事务释放对应的保存点，修改随最外层事务一起提交
+// 最外层事务提交成功后清除事务中修改过的记录的缓存
 func (t *DB) Commit() *gorm.DB {
 	t.transactionLevel--
 	if t.transactionLevel == 0 {
-		tx := t.DB.Commit()
-		t.DB = t.ox
-		return tx
+		return t.commit()
 	} else if t.transactionLevel < 0 {
 		log.Panic("[orm] db.Commit error: over transaction level\n")
 	}
-	return t.DB
+	return t.DB.Exec("RELEASE SAVEPOINT " + savepointName(t.transactionLevel))
 }
 
 // MustCommit 强制提交所有事务，跳过层级检查
 func (t *DB) MustCommit() *gorm.DB {
+	t.transactionLevel = 0
+	return t.commit()
+}
+
+// commit 提交最外层事务，成功后清除待清除的缓存
+func (t *DB) commit() *gorm.DB {
+	v, _ := t.DB.Get(cachePendingSetting)
 	tx := t.DB.Commit()
 	t.DB = t.ox
-	t.transactionLevel = 0
+	if tx.Error == nil {
+		pending, _ := v.(*pendingKeys)
+		pending.flush()
+	}
 	return tx
 }
 
+// Transaction 在事务中执行 fn，fn 返回错误或 panic 时回滚，否则提交
+// 已在事务中时使用保存点，回滚只撤销 fn 中的修改，panic 会被恢复并作为错误返回
+func (t *DB) Transaction(fn func(tx *DB) error) error {
+	return t.TransactionContext(context.Background(), fn)
+}
+
+// TransactionContext 同 Transaction，使用 ctx 开启最外层的事务
+func (t *DB) TransactionContext(ctx context.Context, fn func(tx *DB) error) (err error) {
+	level := t.transactionLevel
+	if err = t.begin(ctx); err != nil {
+		return err
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			t.rollbackTo(level)
+			err = fmt.Errorf("[orm] transaction panic: %v", r)
+			log.Errorf("%s\n%s", err, debug.Stack())
+		}
+	}()
+
+	if err = fn(t); err != nil {
+		t.rollbackTo(level)
+		return err
+	}
+	// fn 中未结束的内层事务一并提交
+	for t.transactionLevel > level+1 {
+		if err = t.Commit().Error; err != nil {
+			t.rollbackTo(level)
+			return err
+		}
+	}
+	return t.Commit().Error
+}
+
+// rollbackTo 逐层回滚，直到事务层级回到 level
+func (t *DB) rollbackTo(level int) {
+	for t.transactionLevel > level {
+		if err := t.Rollback().Error; err != nil {
+			log.Errorf("[orm] db.Rollback error: %v\n", err)
+		}
+	}
+}
+
+// savepointName 返回指定事务层级的保存点名称
+func savepointName(level int) string {
+	return "sp_" + strconv.Itoa(level)
+}
+
 // Save update value in database, if the value doesn't have primary key, will insert it
 func (t *DB) Save(value interface{}) *gorm.DB {
 	if !t.tx {
@@ -0,0 +1,39 @@
+package base
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestDataSource(t *testing.T) {
+	Convey("测试生成连接字符串", t, func() {
+		dialect, dsn, err := dataSource(&DbConfig{Host: "127.0.0.1:3306", Name: "test", User: "root", Passwd: "123"})
+		So(err, ShouldBeNil)
+		So(dialect, ShouldEqual, "mysql")
+		So(dsn, ShouldEqual, "root:123@tcp(127.0.0.1:3306)/test?charset=utf8mb4&timeout=3s&parseTime=true&loc=Local")
+
+		dialect, dsn, err = dataSource(&DbConfig{Type: "postgres", Host: "127.0.0.1", Name: "test", User: "root", Passwd: "a b'c"})
+		So(err, ShouldBeNil)
+		So(dialect, ShouldEqual, "postgres")
+		So(dsn, ShouldEqual, `host=127.0.0.1 port=5432 user=root password='a b\'c' dbname=test sslmode=disable connect_timeout=3`)
+
+		_, dsn, _ = dataSource(&DbConfig{Type: "postgres", Host: "db:5433", SSLMode: "require", Name: "test", User: "root"})
+		So(dsn, ShouldEqual, `host=db port=5433 user=root password='' dbname=test sslmode=require connect_timeout=3`)
+
+		dialect, dsn, err = dataSource(&DbConfig{Type: "sqlite3", Path: ":memory:"})
+		So(err, ShouldBeNil)
+		So(dialect, ShouldEqual, "sqlite3")
+		So(dsn, ShouldEqual, ":memory:?_loc=auto&_busy_timeout=3000")
+
+		_, _, err = dataSource(&DbConfig{Type: "oracle"})
+		So(err, ShouldNotBeNil)
+	})
+
+	Convey("测试连接 SQLite", t, func() {
+		db, err := getEngine(&DbConfig{Type: "sqlite3", Path: t.TempDir() + "/data/test.db"})
+		So(err, ShouldBeNil)
+		defer db.Close()
+		So(db.DB().Ping(), ShouldBeNil)
+	})
+}
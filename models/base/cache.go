@@ -0,0 +1,263 @@
+package base
+
+import (
+	"bytes"
+	"encoding/gob"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/jinzhu/gorm"
+	"golang.org/x/sync/singleflight"
+)
+
+// CacheNegativeTTL 不存在的记录的最长缓存时间，单位秒
+var CacheNegativeTTL int64 = 60
+
+// cacheNil 缓存中表示记录不存在的值
+const cacheNil = "null"
+
+// cacheGroup 合并同一个缓存键的并发查询，防止缓存击穿
+var cacheGroup singleflight.Group
+
+// cachePendingSetting 事务中记录待清除的缓存键的 gorm 设置名
+const cachePendingSetting = "base:pending_cache_keys"
+
+// CacheKey 返回模型记录的缓存键
+func CacheKey(table string, id interface{}) string {
+	return "orm:" + table + ":" + fmt.Sprint(id)
+}
+
+// FindByIDCached 按主键查询记录，优先读取缓存，缓存 ttl 秒
+// 记录不存在时返回 gorm.ErrRecordNotFound，并在缓存中记录，避免重复查询数据库
+// 没有配置缓存或在事务中时直接查询数据库，避免缓存未提交的修改
+func FindByIDCached(db *DB, out interface{}, id interface{}, ttl int64) error {
+	c := Cacher()
+	if c == nil || db.transactionLevel > 0 {
+		return db.First(out, id).Error
+	}
+
+	key := CacheKey(db.NewScope(out).TableName(), id)
+	var body string
+	if err := c.Get(key, &body); err == nil && body != "" {
+		if body == cacheNil {
+			return gorm.ErrRecordNotFound
+		}
+		// 无法解码的缓存视为未命中
+		if decodeCache(body, out) == nil {
+			return nil
+		}
+	}
+
+	v, err, _ := cacheGroup.Do(key, func() (interface{}, error) {
+		v := reflect.New(reflect.TypeOf(out).Elem()).Interface()
+		err := db.First(v, id).Error
+		if gorm.IsRecordNotFoundError(err) {
+			c.Set(key, cacheNil, negativeTTL(ttl))
+			return cacheNil, nil
+		} else if err != nil {
+			return nil, err
+		}
+		body, err := encodeCache(v)
+		if err != nil {
+			return nil, err
+		}
+		c.Set(key, body, ttl)
+		return body, nil
+	})
+	if err != nil {
+		return err
+	}
+	if v.(string) == cacheNil {
+		return gorm.ErrRecordNotFound
+	}
+	return decodeCache(v.(string), out)
+}
+
+// FindByIDsCached 按主键批量查询记录，out 为模型的切片指针，如 *[]*User
+// 结果按 ids 的顺序排列，不存在的记录会被跳过，缓存未命中的记录用一次查询获取
+func FindByIDsCached(db *DB, out interface{}, ids interface{}, ttl int64) error {
+	sv := reflect.ValueOf(out)
+	if sv.Kind() != reflect.Ptr || sv.Elem().Kind() != reflect.Slice {
+		return Errorf("FindByIDsCached: out must be a pointer of slice")
+	}
+	iv := reflect.ValueOf(ids)
+	if iv.Kind() != reflect.Slice {
+		return Errorf("FindByIDsCached: ids must be a slice")
+	}
+	slice := sv.Elem()
+	elemType := slice.Type().Elem()
+	modelType := elemType
+	if modelType.Kind() == reflect.Ptr {
+		modelType = modelType.Elem()
+	}
+
+	c := Cacher()
+	if c == nil || db.transactionLevel > 0 {
+		return findByIDs(db, out, ids)
+	}
+
+	scope := db.NewScope(reflect.New(modelType).Interface())
+	table := scope.TableName()
+	bodies := make(map[string]string, iv.Len())
+	var missing []interface{}
+	for i := 0; i < iv.Len(); i++ {
+		id := iv.Index(i).Interface()
+		var body string
+		if err := c.Get(CacheKey(table, id), &body); err != nil || body == "" ||
+			(body != cacheNil && decodeCache(body, reflect.New(modelType).Interface()) != nil) {
+			missing = append(missing, id)
+			continue
+		}
+		bodies[fmt.Sprint(id)] = body
+	}
+
+	if len(missing) > 0 {
+		keys := make([]string, len(missing))
+		for i, id := range missing {
+			keys[i] = fmt.Sprint(id)
+		}
+		v, err, _ := cacheGroup.Do(table+":"+strings.Join(keys, ","), func() (interface{}, error) {
+			rows := reflect.New(reflect.SliceOf(reflect.PtrTo(modelType)))
+			if err := findByIDs(db, rows.Interface(), missing); err != nil {
+				return nil, err
+			}
+			found := make(map[string]string, len(missing))
+			for i := 0; i < rows.Elem().Len(); i++ {
+				row := rows.Elem().Index(i).Interface()
+				field := db.NewScope(row).PrimaryField()
+				if field == nil {
+					return nil, Errorf("FindByIDsCached: %s has no primary key", table)
+				}
+				body, err := encodeCache(row)
+				if err != nil {
+					return nil, err
+				}
+				id := fmt.Sprint(field.Field.Interface())
+				found[id] = body
+				c.Set(CacheKey(table, id), body, ttl)
+			}
+			for _, id := range keys {
+				if _, ok := found[id]; !ok {
+					c.Set(CacheKey(table, id), cacheNil, negativeTTL(ttl))
+				}
+			}
+			return found, nil
+		})
+		if err != nil {
+			return err
+		}
+		for k, body := range v.(map[string]string) {
+			bodies[k] = body
+		}
+	}
+
+	result := reflect.MakeSlice(slice.Type(), 0, iv.Len())
+	for i := 0; i < iv.Len(); i++ {
+		body, ok := bodies[fmt.Sprint(iv.Index(i).Interface())]
+		if !ok || body == cacheNil {
+			continue
+		}
+		v := reflect.New(modelType)
+		if err := decodeCache(body, v.Interface()); err != nil {
+			return err
+		}
+		if elemType.Kind() != reflect.Ptr {
+			v = v.Elem()
+		}
+		result = reflect.Append(result, v)
+	}
+	slice.Set(result)
+	return nil
+}
+
+// encodeCache 用 gob 编码要缓存的记录，不受 json 标签影响，json:"-" 的字段也会缓存
+func encodeCache(v interface{}) (string, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(v); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// decodeCache 将缓存的记录解码到 out，out 为模型的指针
+// gob 不会写入零值的字段，先解码到新的记录再整体赋值，避免保留 out 原有的值
+func decodeCache(body string, out interface{}) error {
+	v := reflect.New(reflect.TypeOf(out).Elem())
+	if err := gob.NewDecoder(strings.NewReader(body)).Decode(v.Interface()); err != nil {
+		return err
+	}
+	reflect.ValueOf(out).Elem().Set(v.Elem())
+	return nil
+}
+
+// findByIDs 直接从数据库按主键批量查询
+func findByIDs(db *DB, out interface{}, ids interface{}) error {
+	scope := db.NewScope(out)
+	return db.Where(scope.Quote(scope.PrimaryKey())+" IN (?)", ids).Find(out).Error
+}
+
+// negativeTTL 不存在的记录的缓存时间，不超过 CacheNegativeTTL
+func negativeTTL(ttl int64) int64 {
+	if ttl <= 0 || ttl > CacheNegativeTTL {
+		return CacheNegativeTTL
+	}
+	return ttl
+}
+
+// pendingKeys 事务中修改过的记录的缓存键，最外层事务提交后清除，回滚时丢弃
+type pendingKeys struct {
+	sync.Mutex
+	keys []string
+}
+
+// add 记录一个待清除的缓存键
+func (p *pendingKeys) add(key string) {
+	p.Lock()
+	p.keys = append(p.keys, key)
+	p.Unlock()
+}
+
+// flush 清除记录的所有缓存键
+func (p *pendingKeys) flush() {
+	if p == nil {
+		return
+	}
+	c := Cacher()
+	p.Lock()
+	defer p.Unlock()
+	if c != nil {
+		for _, key := range p.keys {
+			c.Delete(key)
+		}
+	}
+	p.keys = nil
+}
+
+// invalidateCache 记录创建、更新、删除并提交后清除对应的缓存，执行失败或回滚时保留缓存
+// 在 DB 的事务中修改时，缓存键在最外层事务提交成功后再清除，避免并发的读取在提交前重新缓存旧数据
+// 只能清除带主键的记录，不带主键的批量更新和删除需要自行处理缓存
+func invalidateCache(scope *gorm.Scope) {
+	if scope.HasError() {
+		return
+	}
+	field := scope.PrimaryField()
+	if field == nil || field.IsBlank {
+		return
+	}
+	key := CacheKey(scope.TableName(), field.Field.Interface())
+	if v, ok := scope.Get(cachePendingSetting); ok {
+		v.(*pendingKeys).add(key)
+		return
+	}
+	if c := Cacher(); c != nil {
+		c.Delete(key)
+	}
+}
+
+func init() {
+	gorm.DefaultCallback.Create().After("gorm:commit_or_rollback_transaction").Register("base:invalidate_cache", invalidateCache)
+	gorm.DefaultCallback.Update().After("gorm:commit_or_rollback_transaction").Register("base:invalidate_cache", invalidateCache)
+	gorm.DefaultCallback.Delete().After("gorm:commit_or_rollback_transaction").Register("base:invalidate_cache", invalidateCache)
+}
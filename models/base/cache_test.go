@@ -0,0 +1,228 @@
+package base
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-baa/baa"
+	"github.com/go-baa/cache"
+	"github.com/jinzhu/gorm"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestFindByIDCached(t *testing.T) {
+	baa.Default().SetDI("cache", cache.New(cache.Options{Adapter: "memory"}))
+	defer baa.Default().SetDI("cache", nil)
+
+	Convey("测试缓存单条记录", t, func() {
+		Cacher().Flush()
+		db := newTestDB(t)
+		item := &txItem{Name: "a"}
+		db.Create(item)
+
+		out := new(txItem)
+		So(FindByIDCached(db, out, item.ID, 60), ShouldBeNil)
+		So(out.Name, ShouldEqual, "a")
+
+		// 绕过回调直接修改，读到的是缓存
+		db.Exec("UPDATE tx_item SET name = 'b' WHERE id = ?", item.ID)
+		out = new(txItem)
+		So(FindByIDCached(db, out, item.ID, 60), ShouldBeNil)
+		So(out.Name, ShouldEqual, "a")
+
+		// 通过 gorm 保存后缓存失效
+		item.Name = "c"
+		db.Save(item)
+		out = new(txItem)
+		So(FindByIDCached(db, out, item.ID, 60), ShouldBeNil)
+		So(out.Name, ShouldEqual, "c")
+
+		db.Delete(item)
+		So(FindByIDCached(db, new(txItem), item.ID, 60), ShouldEqual, gorm.ErrRecordNotFound)
+	})
+
+	Convey("测试缓存不存在的记录", t, func() {
+		Cacher().Flush()
+		db := newTestDB(t)
+		So(FindByIDCached(db, new(txItem), 99, 60), ShouldEqual, gorm.ErrRecordNotFound)
+
+		db.Exec("INSERT INTO tx_item (id, name) VALUES (99, 'x')")
+		So(FindByIDCached(db, new(txItem), 99, 60), ShouldEqual, gorm.ErrRecordNotFound)
+
+		db.Create(&txItem{ID: 100, Name: "y"})
+		out := new(txItem)
+		So(FindByIDCached(db, out, 100, 60), ShouldBeNil)
+		So(out.Name, ShouldEqual, "y")
+	})
+
+	Convey("测试批量查询", t, func() {
+		Cacher().Flush()
+		db := newTestDB(t)
+		for _, name := range []string{"a", "b", "c"} {
+			db.Create(&txItem{Name: name})
+		}
+		So(FindByIDCached(db, new(txItem), 2, 60), ShouldBeNil)
+		db.Exec("UPDATE tx_item SET name = 'x'")
+
+		var items []*txItem
+		So(FindByIDsCached(db, &items, []int{3, 9, 2, 1}, 60), ShouldBeNil)
+		So(len(items), ShouldEqual, 3)
+		So(items[0].Name, ShouldEqual, "x")
+		So(items[1].Name, ShouldEqual, "b")
+		So(items[2].Name, ShouldEqual, "x")
+
+		var values []txItem
+		So(FindByIDsCached(db, &values, []int{1, 3}, 60), ShouldBeNil)
+		So(len(values), ShouldEqual, 2)
+		So(values[0].ID, ShouldEqual, 1)
+	})
+}
+
+type cacheSecret struct {
+	ID       int        `json:"id"`
+	Name     string     `json:"name"`
+	Password string     `json:"-"`
+	LoginAt  *time.Time `json:"-"`
+}
+
+func TestCacheHiddenFields(t *testing.T) {
+	baa.Default().SetDI("cache", cache.New(cache.Options{Adapter: "memory"}))
+	defer baa.Default().SetDI("cache", nil)
+
+	Convey("测试缓存保留 json:\"-\" 的字段", t, func() {
+		Cacher().Flush()
+		db := newTestDB(t)
+		db.AutoMigrate(new(cacheSecret))
+		now := time.Now().Truncate(time.Second)
+		db.Create(&cacheSecret{ID: 1, Name: "a", Password: "secret", LoginAt: &now})
+		db.Create(&cacheSecret{ID: 2, Name: "b", Password: "secret2"})
+
+		So(FindByIDCached(db, new(cacheSecret), 1, 60), ShouldBeNil)
+		db.Exec("UPDATE cache_secret SET name = 'x'")
+
+		// 缓存命中，与查询数据库的结果一致
+		out := &cacheSecret{Name: "old", Password: "old"}
+		So(FindByIDCached(db, out, 1, 60), ShouldBeNil)
+		So(out.Name, ShouldEqual, "a")
+		So(out.Password, ShouldEqual, "secret")
+		So(out.LoginAt, ShouldNotBeNil)
+		So(out.LoginAt.Equal(now), ShouldBeTrue)
+
+		var items []*cacheSecret
+		So(FindByIDsCached(db, &items, []int{1, 2}, 60), ShouldBeNil)
+		So(len(items), ShouldEqual, 2)
+		So(items[0].Name, ShouldEqual, "a")
+		So(items[0].Password, ShouldEqual, "secret")
+		So(items[1].Password, ShouldEqual, "secret2")
+
+		// 保存缓存读到的记录不会清空隐藏的字段
+		out.Name = "c"
+		db.Save(out)
+		saved := new(cacheSecret)
+		db.First(saved, 1)
+		So(saved.Password, ShouldEqual, "secret")
+		So(saved.LoginAt, ShouldNotBeNil)
+	})
+
+	Convey("测试无法解码的缓存视为未命中", t, func() {
+		Cacher().Flush()
+		db := newTestDB(t)
+		db.AutoMigrate(new(cacheSecret))
+		db.Create(&cacheSecret{ID: 1, Name: "a", Password: "secret"})
+		Cacher().Set(CacheKey("cache_secret", 1), `{"id":1,"name":"json"}`, 60)
+
+		out := new(cacheSecret)
+		So(FindByIDCached(db, out, 1, 60), ShouldBeNil)
+		So(out.Name, ShouldEqual, "a")
+		So(out.Password, ShouldEqual, "secret")
+
+		Cacher().Set(CacheKey("cache_secret", 1), `{"id":1,"name":"json"}`, 60)
+		var items []cacheSecret
+		So(FindByIDsCached(db, &items, []int{1}, 60), ShouldBeNil)
+		So(len(items), ShouldEqual, 1)
+		So(items[0].Name, ShouldEqual, "a")
+	})
+}
+
+func TestInvalidateCacheAfterCommit(t *testing.T) {
+	baa.Default().SetDI("cache", cache.New(cache.Options{Adapter: "memory"}))
+	defer baa.Default().SetDI("cache", nil)
+
+	Convey("测试事务提交后清除缓存", t, func() {
+		Cacher().Flush()
+		db := newTestDB(t)
+		item := &txItem{Name: "a"}
+		db.Create(item)
+		So(FindByIDCached(db, new(txItem), item.ID, 60), ShouldBeNil)
+
+		// 事务中更新时，其它连接并发读取的是已提交的数据，不能在提交后留下旧的缓存
+		tx := NewDB(db.DB, true)
+		tx.Begin()
+		So(tx.Model(item).Update("name", "b").Error, ShouldBeNil)
+		var wg sync.WaitGroup
+		names := make(chan string, 10)
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				out := new(txItem)
+				if err := FindByIDCached(db, out, item.ID, 60); err == nil {
+					names <- out.Name
+				}
+			}()
+		}
+		wg.Wait()
+		close(names)
+		for name := range names {
+			So(name, ShouldEqual, "a")
+		}
+
+		// 事务中的读取不使用缓存
+		out := new(txItem)
+		So(FindByIDCached(tx, out, item.ID, 60), ShouldBeNil)
+		So(out.Name, ShouldEqual, "b")
+
+		So(tx.Commit().Error, ShouldBeNil)
+		out = new(txItem)
+		So(FindByIDCached(db, out, item.ID, 60), ShouldBeNil)
+		So(out.Name, ShouldEqual, "b")
+
+		Convey("保存点提交后等到最外层事务提交再清除", func() {
+			err := tx.Transaction(func(tx *DB) error {
+				err := tx.Transaction(func(tx *DB) error {
+					return tx.Model(item).Update("name", "c").Error
+				})
+				So(err, ShouldBeNil)
+				var body string
+				Cacher().Get(CacheKey("tx_item", item.ID), &body)
+				cached := new(txItem)
+				So(decodeCache(body, cached), ShouldBeNil)
+				So(cached.Name, ShouldEqual, "b")
+				return nil
+			})
+			So(err, ShouldBeNil)
+			out := new(txItem)
+			So(FindByIDCached(db, out, item.ID, 60), ShouldBeNil)
+			So(out.Name, ShouldEqual, "c")
+		})
+
+		Convey("回滚和执行失败时保留缓存", func() {
+			err := tx.Transaction(func(tx *DB) error {
+				tx.Model(item).Update("name", "c")
+				return errors.New("rollback")
+			})
+			So(err, ShouldNotBeNil)
+			db.Exec("UPDATE tx_item SET name = 'd' WHERE id = ?", item.ID)
+			out := new(txItem)
+			So(FindByIDCached(db, out, item.ID, 60), ShouldBeNil)
+			So(out.Name, ShouldEqual, "b")
+
+			So(db.Table("none").Save(&txItem{ID: item.ID, Name: "e"}).Error, ShouldNotBeNil)
+			out = new(txItem)
+			So(FindByIDCached(db, out, item.ID, 60), ShouldBeNil)
+			So(out.Name, ShouldEqual, "b")
+		})
+	})
+}
@@ -0,0 +1,156 @@
+package base
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-baa/log"
+	"github.com/go-baa/setting"
+	"github.com/jinzhu/gorm"
+)
+
+// DefaultHealthInterval 从库健康检查的默认间隔
+const DefaultHealthInterval = 10 * time.Second
+
+// Cluster 一主多从的数据库连接，写操作和事务使用主库，读操作轮询健康的从库
+// 可以用 Master, Slave 显式选择连接，或用 Query 按执行的操作自动选择
+type Cluster struct {
+	master   *gorm.DB
+	replicas []*replica
+	next     uint32
+	stop     chan struct{}
+	once     sync.Once
+}
+
+// replica 从库连接及其健康状态
+type replica struct {
+	db      *gorm.DB
+	healthy int32
+}
+
+// clusters 按名称缓存的连接
+var clusters = struct {
+	sync.Mutex
+	m map[string]*Cluster
+}{m: make(map[string]*Cluster)}
+
+// Connect 返回名称为 name 的数据库连接，首次调用时按 db.<name>.* 的配置创建
+// db.<name>.healthInterval 从库健康检查的间隔秒数，默认 10 秒
+func Connect(name string) (*Cluster, error) {
+	clusters.Lock()
+	defer clusters.Unlock()
+	if c, ok := clusters.m[name]; ok {
+		return c, nil
+	}
+	c, err := NewCluster(LoadConfigs(name))
+	if err != nil {
+		return nil, err
+	}
+	interval := time.Duration(setting.Config.MustInt("db."+name+".healthInterval", 0)) * time.Second
+	c.HealthCheck(interval)
+	clusters.m[name] = c
+	return c, nil
+}
+
+// NewCluster 使用配置创建主库和从库的连接
+func NewCluster(config *DbConfig) (*Cluster, error) {
+	master, err := NewEngine(config)
+	if err != nil {
+		return nil, err
+	}
+	replicas := make([]*gorm.DB, 0, len(config.Replicas))
+	for _, v := range config.Replicas {
+		db, err := NewEngine(v)
+		if err != nil {
+			master.Close()
+			for _, r := range replicas {
+				r.Close()
+			}
+			return nil, err
+		}
+		replicas = append(replicas, db)
+	}
+	return newCluster(master, replicas), nil
+}
+
+func newCluster(master *gorm.DB, replicas []*gorm.DB) *Cluster {
+	c := &Cluster{
+		master: master,
+		stop:   make(chan struct{}),
+	}
+	for _, db := range replicas {
+		c.replicas = append(c.replicas, &replica{db: db, healthy: 1})
+	}
+	return c
+}
+
+// Master 返回主库连接，支持写操作和事务
+func (c *Cluster) Master() *DB {
+	return NewDB(c.master, true)
+}
+
+// Slave 轮询返回一个健康的从库连接，只能用于读操作
+// 没有配置从库或从库都不可用时使用主库
+func (c *Cluster) Slave() *DB {
+	n := len(c.replicas)
+	for i := 0; i < n; i++ {
+		r := c.replicas[int(atomic.AddUint32(&c.next, 1)-1)%n]
+		if atomic.LoadInt32(&r.healthy) == 1 {
+			return NewDB(r.db, false)
+		}
+	}
+	return NewDB(c.master, false)
+}
+
+// HealthCheck 开始定期检查从库，检查失败的从库不再分配读请求，恢复后重新加入
+// interval 小于等于 0 时使用 DefaultHealthInterval
+func (c *Cluster) HealthCheck(interval time.Duration) {
+	if len(c.replicas) == 0 {
+		return
+	}
+	if interval <= 0 {
+		interval = DefaultHealthInterval
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-c.stop:
+				return
+			case <-ticker.C:
+				c.checkReplicas()
+			}
+		}
+	}()
+}
+
+// checkReplicas 检查所有从库的连通性
+func (c *Cluster) checkReplicas() {
+	for i, r := range c.replicas {
+		var healthy int32 = 1
+		if err := r.db.DB().Ping(); err != nil {
+			healthy = 0
+		}
+		if atomic.SwapInt32(&r.healthy, healthy) != healthy {
+			if healthy == 0 {
+				log.Errorf("[orm] replica %d is unavailable\n", i)
+			} else {
+				log.Infof("[orm] replica %d is available again\n", i)
+			}
+		}
+	}
+}
+
+// Close 停止健康检查并关闭所有连接
+func (c *Cluster) Close() error {
+	c.once.Do(func() { close(c.stop) })
+	err := c.master.Close()
+	for _, r := range c.replicas {
+		if e := r.db.Close(); e != nil && err == nil {
+			err = e
+		}
+	}
+	return err
+}
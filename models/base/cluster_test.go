@@ -0,0 +1,133 @@
+package base
+
+import (
+	"testing"
+
+	"github.com/go-baa/setting"
+	"github.com/jinzhu/gorm"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func openSqlite(t *testing.T) *gorm.DB {
+	db, err := gorm.Open("sqlite3", t.TempDir()+"/test.db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.SingularTable(true)
+	return db
+}
+
+type clusterUser struct {
+	ID   int
+	Name string
+}
+
+func TestCluster(t *testing.T) {
+	Convey("测试读写分离", t, func() {
+		master := openSqlite(t)
+		r1, r2 := openSqlite(t), openSqlite(t)
+		c := newCluster(master, []*gorm.DB{r1, r2})
+
+		So(c.Master().DB, ShouldEqual, master)
+		So(c.Master().tx, ShouldBeTrue)
+
+		Convey("从库轮询", func() {
+			So(c.Slave().tx, ShouldBeFalse)
+			So(c.Slave().DB, ShouldEqual, r2)
+			So(c.Slave().DB, ShouldEqual, r1)
+			So(c.Slave().DB, ShouldEqual, r2)
+			So(c.Slave().DB, ShouldEqual, r1)
+		})
+
+		Convey("跳过不可用的从库", func() {
+			r1.Close()
+			c.checkReplicas()
+			So(c.Slave().DB, ShouldEqual, r2)
+			So(c.Slave().DB, ShouldEqual, r2)
+
+			r2.Close()
+			c.checkReplicas()
+			So(c.Slave().DB, ShouldEqual, master)
+		})
+
+		Reset(func() {
+			c.Close()
+		})
+	})
+
+	Convey("测试自动读写分离", t, func() {
+		master, replica := openSqlite(t), openSqlite(t)
+		c := newCluster(master, []*gorm.DB{replica})
+		defer c.Close()
+		for _, db := range []*gorm.DB{master, replica} {
+			So(db.AutoMigrate(&clusterUser{}).Error, ShouldBeNil)
+		}
+		So(replica.Create(&clusterUser{ID: 1, Name: "replica"}).Error, ShouldBeNil)
+
+		q := c.Query().Model(&clusterUser{}).Where("id = ?", 1)
+		var u clusterUser
+		So(q.First(&u).Error, ShouldBeNil)
+		So(u.Name, ShouldEqual, "replica")
+
+		// 写操作使用主库
+		So(c.Query().Create(&clusterUser{ID: 1, Name: "master"}).Error, ShouldBeNil)
+		So(q.Update("name", "updated").Error, ShouldBeNil)
+		var name string
+		So(master.Model(&clusterUser{}).Where("id = ?", 1).Select("name").Row().Scan(&name), ShouldBeNil)
+		So(name, ShouldEqual, "updated")
+		So(c.Query().Exec("INSERT INTO cluster_user (id, name) VALUES (2, 'exec')").Error, ShouldBeNil)
+
+		// 读操作使用从库
+		var count int
+		So(c.Query().Model(&clusterUser{}).Count(&count).Error, ShouldBeNil)
+		So(count, ShouldEqual, 1)
+		var names []string
+		So(q.Pluck("name", &names).Error, ShouldBeNil)
+		So(names, ShouldResemble, []string{"replica"})
+		var rows []clusterUser
+		So(c.Query().Raw("SELECT * FROM cluster_user").Scan(&rows).Error, ShouldBeNil)
+		So(len(rows), ShouldEqual, 1)
+		So(q.Find(&rows).Error, ShouldBeNil)
+		So(rows[0].Name, ShouldEqual, "replica")
+
+		// 链式调用不会修改原查询
+		So(q.Where("name = ?", "none").First(&u).RecordNotFound(), ShouldBeTrue)
+		So(q.First(&u).Error, ShouldBeNil)
+
+		// 事务使用主库
+		err := c.Query().Transaction(func(tx *DB) error {
+			return tx.Delete(&clusterUser{}, "id = ?", 2).Error
+		})
+		So(err, ShouldBeNil)
+		So(master.Model(&clusterUser{}).Count(&count).Error, ShouldBeNil)
+		So(count, ShouldEqual, 1)
+
+		So(q.Delete(&clusterUser{}).Error, ShouldBeNil)
+		So(master.Model(&clusterUser{}).Count(&count).Error, ShouldBeNil)
+		So(count, ShouldEqual, 0)
+		So(replica.Model(&clusterUser{}).Count(&count).Error, ShouldBeNil)
+		So(count, ShouldEqual, 1)
+	})
+
+	Convey("测试加载从库和连接池配置", t, func() {
+		setting.Config.Set("db.test.host", "127.0.0.1:3306")
+		setting.Config.Set("db.test.user", "root")
+		setting.Config.Set("db.test.replicas", "10.0.0.1:3306; 10.0.0.2:3306")
+		setting.Config.Set("db.test.replica.user", "reader")
+		setting.Config.Set("db.test.maxOpen", "20")
+		setting.Config.Set("db.test.maxLifetime", "60")
+		defer func() {
+			for _, k := range []string{"host", "user", "replicas", "replica.user", "maxOpen", "maxLifetime"} {
+				setting.Config.Remove("db.test." + k)
+			}
+		}()
+
+		config := LoadConfigs("test")
+		So(config.MaxOpen, ShouldEqual, 20)
+		So(config.MaxLifetime.Seconds(), ShouldEqual, 60)
+		So(len(config.Replicas), ShouldEqual, 2)
+		So(config.Replicas[1].Host, ShouldEqual, "10.0.0.2:3306")
+		So(config.Replicas[1].User, ShouldEqual, "reader")
+		So(config.Replicas[1].MaxOpen, ShouldEqual, 20)
+	})
+}
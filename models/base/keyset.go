@@ -0,0 +1,79 @@
+package base
+
+import (
+	"reflect"
+	"strings"
+
+	"github.com/go-baa/common/modules/cursor"
+	"github.com/jinzhu/gorm"
+)
+
+// Keyset 游标分页的查询条件，按 columns 排序，从 values 之后开始多取一条用于判断是否还有下一页
+// values 为上一页最后一条记录在 columns 上的值，为空时从第一条开始
+// columns 的组合必须唯一，通常以主键结尾，如 []string{"created_at", "id"}
+func Keyset(columns []string, values []interface{}, desc bool, limit int) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		scope := db.NewScope(db.Value)
+		quoted := make([]string, len(columns))
+		for i, v := range columns {
+			quoted[i] = scope.Quote(v)
+		}
+
+		op, order := ">", " ASC"
+		if desc {
+			op, order = "<", " DESC"
+		}
+		if len(values) > 0 {
+			if len(values) != len(columns) {
+				db.AddError(cursor.ErrInvalid)
+				return db
+			}
+			placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(values)), ", ")
+			db = db.Where("("+strings.Join(quoted, ", ")+") "+op+" ("+placeholders+")", values...)
+		}
+		for _, v := range quoted {
+			db = db.Order(v + order)
+		}
+		return db.Limit(limit + 1)
+	}
+}
+
+// KeysetPage 按游标分页查询，items 为模型的切片指针，token 为上一页返回的游标
+// 返回下一页的游标和是否还有下一页，limit 小于 1 时取 10 条
+func KeysetPage(db *gorm.DB, items interface{}, token string, columns []string, desc bool, limit int) (string, bool, error) {
+	if limit < 1 {
+		limit = 10
+	}
+	values, err := cursor.Decode(token)
+	if err != nil {
+		return "", false, err
+	}
+	if err = db.Scopes(Keyset(columns, values, desc, limit)).Find(items).Error; err != nil {
+		return "", false, err
+	}
+
+	slice := reflect.ValueOf(items).Elem()
+	if slice.Len() <= limit {
+		return "", false, nil
+	}
+	slice.Set(slice.Slice(0, limit))
+
+	last := slice.Index(limit - 1).Interface()
+	if reflect.TypeOf(last).Kind() != reflect.Ptr {
+		last = slice.Index(limit - 1).Addr().Interface()
+	}
+	scope := db.NewScope(last)
+	next := make([]interface{}, len(columns))
+	for i, v := range columns {
+		field, ok := scope.FieldByName(v)
+		if !ok {
+			return "", false, Errorf("KeysetPage: unknown column %s", v)
+		}
+		next[i] = field.Field.Interface()
+	}
+	token, err = cursor.Encode(next...)
+	if err != nil {
+		return "", false, err
+	}
+	return token, true, nil
+}
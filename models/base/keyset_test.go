@@ -0,0 +1,47 @@
+package base
+
+import (
+	"testing"
+
+	"github.com/go-baa/common/modules/cursor"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestKeysetPage(t *testing.T) {
+	Convey("测试游标分页", t, func() {
+		db := newTestDB(t)
+		for _, name := range []string{"b", "a", "b", "c", "a"} {
+			db.Create(&txItem{Name: name})
+		}
+
+		var names []string
+		token, more := "", true
+		for more {
+			var items []*txItem
+			var err error
+			token, more, err = KeysetPage(db.DB, &items, token, []string{"name", "id"}, false, 2)
+			So(err, ShouldBeNil)
+			for _, v := range items {
+				names = append(names, v.Name)
+			}
+		}
+		So(names, ShouldResemble, []string{"a", "a", "b", "b", "c"})
+
+		var items []txItem
+		token, more, err := KeysetPage(db.DB, &items, "", []string{"id"}, true, 3)
+		So(err, ShouldBeNil)
+		So(more, ShouldBeTrue)
+		So(items[0].ID, ShouldEqual, 5)
+		So(len(items), ShouldEqual, 3)
+
+		token, more, err = KeysetPage(db.DB, &items, token, []string{"id"}, true, 3)
+		So(err, ShouldBeNil)
+		So(more, ShouldBeFalse)
+		So(token, ShouldEqual, "")
+		So(items[0].ID, ShouldEqual, 2)
+		So(len(items), ShouldEqual, 2)
+
+		_, _, err = KeysetPage(db.DB, &items, "bad", []string{"id"}, true, 3)
+		So(err, ShouldEqual, cursor.ErrInvalid)
+	})
+}
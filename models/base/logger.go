@@ -0,0 +1,291 @@
+package base
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-baa/baa"
+	"github.com/go-baa/setting"
+)
+
+// LoggerConfig ORM 日志配置
+type LoggerConfig struct {
+	Path          string        // 日志目录，os.Stdout 或 os.Stderr 时输出到标准输出
+	Verbose       bool          // 记录所有 SQL，关闭时只记录慢查询和错误
+	SlowThreshold time.Duration // 慢查询阈值，0 表示不单独记录慢查询
+	MaxSize       int64         // 单个日志文件的最大字节数，0 表示不按大小切分
+	MaxAge        int           // 日志文件保留天数，0 表示不清理
+}
+
+// LogEntry 一条 ORM 日志，以 JSON 格式逐行输出
+type LogEntry struct {
+	Time     string        `json:"time"`
+	Level    string        `json:"level"` // sql, slow, error, log
+	Caller   string        `json:"caller,omitempty"`
+	SQL      string        `json:"sql,omitempty"`
+	Args     []interface{} `json:"args,omitempty"`
+	Duration float64       `json:"duration_ms,omitempty"`
+	Rows     int64         `json:"rows"`
+	Message  string        `json:"message,omitempty"`
+}
+
+// Logger 实现 gorm 的日志接口，输出 JSON 格式的日志，支持慢查询记录，按日期和大小切分文件
+type Logger struct {
+	config LoggerConfig
+
+	mu   sync.Mutex
+	w    io.Writer
+	file *os.File
+	date string
+	size int64
+}
+
+// NewLogger 创建 ORM 日志
+func NewLogger(config LoggerConfig) *Logger {
+	l := &Logger{config: config}
+	switch config.Path {
+	case "os.Stdout":
+		l.w = os.Stdout
+	case "os.Stderr":
+		l.w = os.Stderr
+	}
+	return l
+}
+
+// defaultLogger 所有连接共享的日志，由 orm.* 配置创建
+var defaultLogger struct {
+	once   sync.Once
+	logger *Logger
+}
+
+// DefaultLogger 返回按配置创建的 ORM 日志，配置为不记录任何日志时返回 nil
+// orm.log 是否记录所有 SQL，默认 PROD 环境关闭
+// orm.logpath 日志目录，默认 data/log
+// orm.slowThreshold 慢查询阈值毫秒数，PROD 环境同样生效
+// orm.maxSize 单个日志文件的最大 MB 数，orm.maxAge 日志保留天数
+func DefaultLogger() *Logger {
+	defaultLogger.once.Do(func() {
+		config := LoggerConfig{
+			Path:          strings.TrimRight(setting.Config.MustString("orm.logpath", "data/log"), "/"),
+			Verbose:       setting.Config.MustBool("orm.log", baa.Env != baa.PROD),
+			SlowThreshold: time.Duration(setting.Config.MustInt("orm.slowThreshold", 0)) * time.Millisecond,
+			MaxSize:       setting.Config.MustInt64("orm.maxSize", 0) << 20,
+			MaxAge:        setting.Config.MustInt("orm.maxAge", 0),
+		}
+		if config.Verbose || config.SlowThreshold > 0 {
+			defaultLogger.logger = NewLogger(config)
+		}
+	})
+	return defaultLogger.logger
+}
+
+// Print 实现 gorm.logger 接口
+func (l *Logger) Print(v ...interface{}) {
+	if len(v) < 2 {
+		return
+	}
+	entry := &LogEntry{
+		Level:  fmt.Sprint(v[0]),
+		Caller: caller(fmt.Sprint(v[1])),
+	}
+	switch entry.Level {
+	case "sql":
+		if len(v) < 6 {
+			return
+		}
+		duration, _ := v[2].(time.Duration)
+		slow := l.config.SlowThreshold > 0 && duration >= l.config.SlowThreshold
+		if !slow && !l.config.Verbose {
+			return
+		}
+		if slow {
+			entry.Level = "slow"
+		}
+		entry.SQL = strings.TrimSpace(fmt.Sprint(v[3]))
+		entry.Args = logArgs(v[4])
+		entry.Duration = float64(duration.Microseconds()) / 1000
+		entry.Rows, _ = v[5].(int64)
+	default:
+		// 错误总是记录
+		for _, m := range v[2:] {
+			if _, ok := m.(error); ok {
+				entry.Level = "error"
+			}
+		}
+		if entry.Level != "error" && !l.config.Verbose {
+			return
+		}
+		entry.Message = fmt.Sprint(v[2:]...)
+	}
+	l.write(entry)
+}
+
+// Close 关闭当前的日志文件，之后的日志会重新打开文件
+func (l *Logger) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.closeFile()
+}
+
+// write 输出一条日志，必要时切换日志文件
+func (l *Logger) write(entry *LogEntry) {
+	now := time.Now()
+	entry.Time = now.Format(TimeFormatDefault)
+	body, err := json.Marshal(entry)
+	if err != nil {
+		entry.Args = []interface{}{fmt.Sprint(entry.Args...)}
+		if body, err = json.Marshal(entry); err != nil {
+			return
+		}
+	}
+	body = append(body, '\n')
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.config.Path != "os.Stdout" && l.config.Path != "os.Stderr" {
+		if err = l.rotate(now, int64(len(body))); err != nil {
+			fmt.Fprintf(os.Stderr, "[orm] logger error: %v\n", err)
+			return
+		}
+	}
+	n, _ := l.w.Write(body)
+	l.size += int64(n)
+}
+
+// rotate 日期变化或文件超过大小限制时切换日志文件
+func (l *Logger) rotate(now time.Time, n int64) error {
+	date := now.Format(TimeFormatDate)
+	if l.file != nil && date == l.date && (l.config.MaxSize <= 0 || l.size+n <= l.config.MaxSize || l.size == 0) {
+		return nil
+	}
+	if err := l.closeFile(); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(l.config.Path, os.ModePerm); err != nil {
+		return err
+	}
+
+	filename := l.filename(date, 0)
+	if l.config.MaxSize > 0 {
+		// 当前文件已满时改名为 orm-日期.序号.log
+		if info, err := os.Stat(filename); err == nil && info.Size()+n > l.config.MaxSize && info.Size() > 0 {
+			seq := 1
+			for ; ; seq++ {
+				if _, err := os.Stat(l.filename(date, seq)); os.IsNotExist(err) {
+					break
+				}
+			}
+			if err := os.Rename(filename, l.filename(date, seq)); err != nil {
+				return err
+			}
+		}
+	}
+
+	f, err := os.OpenFile(filename, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	l.file, l.w, l.date, l.size = f, f, date, info.Size()
+	l.cleanup(now)
+	return nil
+}
+
+// filename 返回日志文件名，seq 大于 0 时为切分出的历史文件
+func (l *Logger) filename(date string, seq int) string {
+	if seq > 0 {
+		return fmt.Sprintf("%s/orm-%s.%d.log", l.config.Path, date, seq)
+	}
+	return l.config.Path + "/orm-" + date + ".log"
+}
+
+// cleanup 删除超过保留天数的日志文件
+func (l *Logger) cleanup(now time.Time) {
+	if l.config.MaxAge <= 0 {
+		return
+	}
+	files, err := filepath.Glob(l.config.Path + "/orm-*.log")
+	if err != nil {
+		return
+	}
+	deadline := now.AddDate(0, 0, -l.config.MaxAge)
+	for _, v := range files {
+		info, err := os.Stat(v)
+		if err == nil && info.ModTime().Before(deadline) {
+			os.Remove(v)
+		}
+	}
+}
+
+// closeFile 关闭当前的日志文件
+func (l *Logger) closeFile() error {
+	if l.file == nil {
+		return nil
+	}
+	err := l.file.Close()
+	l.file, l.w = nil, nil
+	return err
+}
+
+// pkgDir 当前包所在的目录
+var pkgDir = func() string {
+	_, file, _, _ := runtime.Caller(0)
+	return filepath.Dir(file)
+}()
+
+// caller 查找调用 ORM 的业务代码位置，跳过 gorm 和当前包的封装，找不到时返回 def
+func caller(def string) string {
+	pcs := make([]uintptr, 32)
+	frames := runtime.CallersFrames(pcs[:runtime.Callers(3, pcs)])
+	for {
+		frame, more := frames.Next()
+		inPkg := filepath.Dir(frame.File) == pkgDir && !strings.HasSuffix(frame.File, "_test.go")
+		if !inPkg && !strings.Contains(frame.File, "/jinzhu/gorm") && frame.File != "" {
+			return fmt.Sprintf("%s:%d", frame.File, frame.Line)
+		}
+		if !more {
+			return def
+		}
+	}
+}
+
+// logArgs 将 SQL 参数转换为便于阅读的 JSON 值
+func logArgs(v interface{}) []interface{} {
+	vars, ok := v.([]interface{})
+	if !ok {
+		return nil
+	}
+	args := make([]interface{}, len(vars))
+	for i, arg := range vars {
+		if valuer, ok := arg.(driver.Valuer); ok {
+			if val, err := valuer.Value(); err == nil {
+				arg = val
+			}
+		}
+		switch a := arg.(type) {
+		case time.Time:
+			args[i] = a.Format(TimeFormatDefault)
+		case *time.Time:
+			if a != nil {
+				args[i] = a.Format(TimeFormatDefault)
+			}
+		case []byte:
+			args[i] = string(a)
+		default:
+			args[i] = a
+		}
+	}
+	return args
+}
@@ -0,0 +1,84 @@
+package base
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func readLogEntries(dir string) []*LogEntry {
+	files, _ := filepath.Glob(dir + "/orm-*.log")
+	var entries []*LogEntry
+	for _, f := range files {
+		body, _ := ioutil.ReadFile(f)
+		for _, line := range strings.Split(strings.TrimSpace(string(body)), "\n") {
+			if line == "" {
+				continue
+			}
+			entry := new(LogEntry)
+			if err := json.Unmarshal([]byte(line), entry); err == nil {
+				entries = append(entries, entry)
+			}
+		}
+	}
+	return entries
+}
+
+func TestLogger(t *testing.T) {
+	Convey("测试记录所有 SQL", t, func() {
+		dir := t.TempDir()
+		l := NewLogger(LoggerConfig{Path: dir, Verbose: true})
+		defer l.Close()
+
+		db := newTestDB(t)
+		db.LogMode(true)
+		db.DB.SetLogger(l)
+		db.Create(&txItem{Name: "a"})
+
+		entries := readLogEntries(dir)
+		So(len(entries), ShouldEqual, 1)
+		So(entries[0].Level, ShouldEqual, "sql")
+		So(entries[0].SQL, ShouldContainSubstring, "INSERT")
+		So(entries[0].Args, ShouldResemble, []interface{}{"a"})
+		So(entries[0].Rows, ShouldEqual, 1)
+		So(entries[0].Caller, ShouldContainSubstring, "logger_test.go")
+	})
+
+	Convey("测试只记录慢查询和错误", t, func() {
+		dir := t.TempDir()
+		l := NewLogger(LoggerConfig{Path: dir, SlowThreshold: 100 * time.Millisecond})
+		defer l.Close()
+
+		l.Print("sql", "a.go:1", 10*time.Millisecond, "SELECT 1", []interface{}{}, int64(1))
+		l.Print("sql", "a.go:2", 200*time.Millisecond, "SELECT 2", []interface{}{time.Date(2020, 1, 2, 3, 4, 5, 0, time.Local)}, int64(1))
+		l.Print("log", "a.go:3", "message")
+		l.Print("log", "a.go:4", errors.New("failed"))
+
+		entries := readLogEntries(dir)
+		So(len(entries), ShouldEqual, 2)
+		So(entries[0].Level, ShouldEqual, "slow")
+		So(entries[0].Duration, ShouldEqual, 200)
+		So(entries[0].Args, ShouldResemble, []interface{}{"2020-01-02 03:04:05"})
+		So(entries[1].Level, ShouldEqual, "error")
+		So(entries[1].Message, ShouldEqual, "failed")
+	})
+
+	Convey("测试按大小切分", t, func() {
+		dir := t.TempDir()
+		l := NewLogger(LoggerConfig{Path: dir, Verbose: true, MaxSize: 300})
+		defer l.Close()
+
+		for i := 0; i < 5; i++ {
+			l.Print("sql", "a.go:1", time.Millisecond, "SELECT 1", []interface{}{}, int64(1))
+		}
+		files, _ := filepath.Glob(dir + "/orm-*.log")
+		So(len(files), ShouldBeGreaterThan, 1)
+		So(len(readLogEntries(dir)), ShouldEqual, 5)
+	})
+}
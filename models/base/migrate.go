@@ -0,0 +1,376 @@
+package base
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// MigrationTable 记录已执行的迁移的表
+const MigrationTable = "schema_migrations"
+
+// MigrationLockTimeout 等待其他实例完成迁移的最长时间
+var MigrationLockTimeout = 60 * time.Second
+
+// Migration 一个版本的数据库迁移，可以使用 Go 函数或 SQL 语句
+type Migration struct {
+	Version int64
+	Name    string
+	Up      func(tx *gorm.DB) error
+	Down    func(tx *gorm.DB) error
+	UpSQL   string
+	DownSQL string
+}
+
+// MigrationStatus 迁移的执行状态
+type MigrationStatus struct {
+	Version   int64
+	Name      string
+	AppliedAt *time.Time // 为空表示未执行
+	Missing   bool       // 已执行但找不到迁移文件
+}
+
+// schemaMigration 已执行的迁移记录
+type schemaMigration struct {
+	Version   int64 `gorm:"primary_key;auto_increment:false"`
+	Name      string
+	AppliedAt time.Time
+}
+
+// TableName ...
+func (schemaMigration) TableName() string {
+	return MigrationTable
+}
+
+// migrations 注册的 Go 迁移
+var migrations = struct {
+	sync.Mutex
+	m map[int64]*Migration
+}{m: make(map[int64]*Migration)}
+
+// RegisterMigration 注册 Go 编写的迁移，通常在 init 中调用，版本号重复时 panic
+func RegisterMigration(version int64, name string, up, down func(tx *gorm.DB) error) {
+	migrations.Lock()
+	defer migrations.Unlock()
+	if up == nil {
+		panic("base.RegisterMigration: up func is nil")
+	}
+	if _, dup := migrations.m[version]; dup {
+		panic("base.RegisterMigration: called twice for version " + strconv.FormatInt(version, 10))
+	}
+	migrations.m[version] = &Migration{Version: version, Name: name, Up: up, Down: down}
+}
+
+// Migrator 执行数据库迁移
+type Migrator struct {
+	DryRun bool      // 只输出将要执行的迁移，不修改数据库
+	Out    io.Writer // 输出执行过程，默认 os.Stdout
+
+	db         *gorm.DB
+	migrations []*Migration
+}
+
+// NewMigrator 创建迁移，包括注册的 Go 迁移和 dir 目录下的 SQL 迁移
+// SQL 迁移文件命名为 版本号_名称.up.sql 和 版本号_名称.down.sql，如 20200101120000_create_user.up.sql
+// 每条语句以行尾的 ; 结束
+func NewMigrator(db *gorm.DB, dir string) (*Migrator, error) {
+	m := &Migrator{db: db, Out: os.Stdout}
+	all := make(map[int64]*Migration)
+	migrations.Lock()
+	for k, v := range migrations.m {
+		all[k] = v
+	}
+	migrations.Unlock()
+
+	if dir != "" {
+		files, err := filepath.Glob(filepath.Join(dir, "*.sql"))
+		if err != nil {
+			return nil, err
+		}
+		for _, file := range files {
+			base := filepath.Base(file)
+			var up bool
+			switch {
+			case strings.HasSuffix(base, ".up.sql"):
+				up, base = true, strings.TrimSuffix(base, ".up.sql")
+			case strings.HasSuffix(base, ".down.sql"):
+				base = strings.TrimSuffix(base, ".down.sql")
+			default:
+				continue
+			}
+			i := strings.IndexByte(base, '_')
+			if i < 0 {
+				return nil, Errorf("migration %s: invalid file name", file)
+			}
+			version, err := strconv.ParseInt(base[:i], 10, 64)
+			if err != nil {
+				return nil, Errorf("migration %s: invalid version", file)
+			}
+			body, err := ioutil.ReadFile(file)
+			if err != nil {
+				return nil, err
+			}
+
+			v, ok := all[version]
+			if !ok {
+				v = &Migration{Version: version, Name: base[i+1:]}
+				all[version] = v
+			} else if v.Up != nil {
+				return nil, Errorf("migration %s: version %d already registered", file, version)
+			}
+			if up {
+				v.UpSQL = string(body)
+			} else {
+				v.DownSQL = string(body)
+			}
+		}
+	}
+
+	for _, v := range all {
+		if v.Up == nil && v.UpSQL == "" {
+			return nil, Errorf("migration %d_%s: missing up migration", v.Version, v.Name)
+		}
+		m.migrations = append(m.migrations, v)
+	}
+	sort.Slice(m.migrations, func(i, j int) bool { return m.migrations[i].Version < m.migrations[j].Version })
+	return m, nil
+}
+
+// Migrate 使用 dir 目录下的迁移将数据库升级到最新版本
+func Migrate(db *gorm.DB, dir string) error {
+	m, err := NewMigrator(db, dir)
+	if err != nil {
+		return err
+	}
+	_, err = m.Up(0)
+	return err
+}
+
+// Up 依次执行未执行的迁移，直到版本 target，target 为 0 时执行全部，返回执行的数量
+func (m *Migrator) Up(target int64) (int, error) {
+	unlock, err := m.lock()
+	if err != nil {
+		return 0, err
+	}
+	defer unlock()
+
+	applied, err := m.applied(!m.DryRun)
+	if err != nil {
+		return 0, err
+	}
+	n := 0
+	for _, v := range m.migrations {
+		if target > 0 && v.Version > target {
+			break
+		}
+		if _, ok := applied[v.Version]; ok {
+			continue
+		}
+		if err = m.run(v, true); err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, nil
+}
+
+// Down 按版本从新到旧回滚 steps 个已执行的迁移，返回回滚的数量
+func (m *Migrator) Down(steps int) (int, error) {
+	unlock, err := m.lock()
+	if err != nil {
+		return 0, err
+	}
+	defer unlock()
+
+	applied, err := m.applied(!m.DryRun)
+	if err != nil {
+		return 0, err
+	}
+	n := 0
+	for i := len(m.migrations) - 1; i >= 0 && n < steps; i-- {
+		v := m.migrations[i]
+		if _, ok := applied[v.Version]; !ok {
+			continue
+		}
+		if v.Down == nil && v.DownSQL == "" {
+			return n, Errorf("migration %d_%s: missing down migration", v.Version, v.Name)
+		}
+		if err = m.run(v, false); err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, nil
+}
+
+// Status 返回所有迁移的执行状态，按版本排序，不修改数据库，迁移表不存在时视为都未执行
+func (m *Migrator) Status() ([]*MigrationStatus, error) {
+	applied, err := m.applied(false)
+	if err != nil {
+		return nil, err
+	}
+	var ret []*MigrationStatus
+	for _, v := range m.migrations {
+		s := &MigrationStatus{Version: v.Version, Name: v.Name}
+		if r, ok := applied[v.Version]; ok {
+			s.AppliedAt = &r.AppliedAt
+			delete(applied, v.Version)
+		}
+		ret = append(ret, s)
+	}
+	for _, r := range applied {
+		t := r.AppliedAt
+		ret = append(ret, &MigrationStatus{Version: r.Version, Name: r.Name, AppliedAt: &t, Missing: true})
+	}
+	sort.Slice(ret, func(i, j int) bool { return ret[i].Version < ret[j].Version })
+	return ret, nil
+}
+
+// applied 返回已执行的迁移，迁移表不存在时 create 为 true 则创建，否则视为没有已执行的迁移
+func (m *Migrator) applied(create bool) (map[int64]*schemaMigration, error) {
+	if !m.db.HasTable(MigrationTable) {
+		if !create {
+			return map[int64]*schemaMigration{}, nil
+		}
+		if err := m.db.CreateTable(new(schemaMigration)).Error; err != nil {
+			return nil, err
+		}
+	}
+	var rows []*schemaMigration
+	if err := m.db.Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	ret := make(map[int64]*schemaMigration, len(rows))
+	for _, v := range rows {
+		ret[v.Version] = v
+	}
+	return ret, nil
+}
+
+// run 在事务中执行一个迁移并记录，MySQL 的 DDL 语句会隐式提交，失败时无法回滚
+func (m *Migrator) run(v *Migration, up bool) (err error) {
+	action, fn, script := "up", v.Up, v.UpSQL
+	if !up {
+		action, fn, script = "down", v.Down, v.DownSQL
+	}
+	fmt.Fprintf(m.Out, "[migrate] %s %d_%s\n", action, v.Version, v.Name)
+	if m.DryRun {
+		if fn != nil {
+			fmt.Fprintf(m.Out, "-- go migration\n")
+		} else {
+			fmt.Fprintf(m.Out, "%s\n", strings.TrimSpace(script))
+		}
+		return nil
+	}
+
+	tx := m.db.Begin()
+	if err = tx.Error; err != nil {
+		return err
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("[migrate] %d_%s panic: %v", v.Version, v.Name, r)
+		}
+		if err != nil {
+			tx.Rollback()
+			return
+		}
+		err = tx.Commit().Error
+	}()
+
+	if fn != nil {
+		err = fn(tx)
+	} else {
+		for _, stmt := range splitSQL(script) {
+			if err = tx.Exec(stmt).Error; err != nil {
+				break
+			}
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("[migrate] %d_%s %s: %v", v.Version, v.Name, action, err)
+	}
+
+	if up {
+		return tx.Create(&schemaMigration{Version: v.Version, Name: v.Name, AppliedAt: time.Now()}).Error
+	}
+	return tx.Where("version = ?", v.Version).Delete(new(schemaMigration)).Error
+}
+
+// lock 获取迁移锁，保证同时只有一个实例执行迁移
+// MySQL 使用 GET_LOCK，PostgreSQL 使用 pg_advisory_lock，SQLite 的写操作本身是串行的
+func (m *Migrator) lock() (func(), error) {
+	if m.DryRun {
+		return func() {}, nil
+	}
+	dialect := m.db.Dialect().GetName()
+	if dialect != "mysql" && dialect != "postgres" {
+		return func() {}, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), MigrationLockTimeout)
+	defer cancel()
+	conn, err := m.db.DB().Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var unlockSQL string
+	var arg interface{}
+	if dialect == "mysql" {
+		var ok sql.NullInt64
+		err = conn.QueryRowContext(ctx, "SELECT GET_LOCK(?, ?)", MigrationTable, int(MigrationLockTimeout.Seconds())).Scan(&ok)
+		if err == nil && ok.Int64 != 1 {
+			err = Errorf("[migrate] wait for lock timeout")
+		}
+		unlockSQL, arg = "SELECT RELEASE_LOCK(?)", MigrationTable
+	} else {
+		key := int64(crc32.ChecksumIEEE([]byte(MigrationTable)))
+		_, err = conn.ExecContext(ctx, "SELECT pg_advisory_lock($1)", key)
+		unlockSQL, arg = "SELECT pg_advisory_unlock($1)", key
+	}
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return func() {
+		conn.ExecContext(context.Background(), unlockSQL, arg)
+		conn.Close()
+	}, nil
+}
+
+// splitSQL 按行尾的 ; 拆分 SQL 语句，忽略空语句和 -- 注释行
+func splitSQL(script string) []string {
+	var stmts []string
+	var buf strings.Builder
+	for _, line := range strings.Split(script, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "--") {
+			continue
+		}
+		buf.WriteString(line)
+		buf.WriteByte('\n')
+		if strings.HasSuffix(trimmed, ";") {
+			if stmt := strings.TrimSpace(buf.String()); stmt != ";" {
+				stmts = append(stmts, stmt)
+			}
+			buf.Reset()
+		}
+	}
+	if stmt := strings.TrimSpace(buf.String()); stmt != "" {
+		stmts = append(stmts, stmt)
+	}
+	return stmts
+}
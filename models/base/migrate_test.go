@@ -0,0 +1,104 @@
+package base
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/jinzhu/gorm"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func writeMigration(dir, name, body string) {
+	ioutil.WriteFile(filepath.Join(dir, name), []byte(body), 0644)
+}
+
+func TestMigrator(t *testing.T) {
+	Convey("测试数据库迁移", t, func() {
+		db := newTestDB(t)
+		dir := t.TempDir()
+		writeMigration(dir, "1_create_user.up.sql", "-- 用户表\nCREATE TABLE user (\n  id INTEGER PRIMARY KEY,\n  name TEXT\n);\nCREATE INDEX idx_user_name ON user (name);\n")
+		writeMigration(dir, "1_create_user.down.sql", "DROP TABLE user;")
+		writeMigration(dir, "3_add_age.up.sql", "ALTER TABLE user ADD COLUMN age INTEGER;")
+		writeMigration(dir, "3_add_age.down.sql", "CREATE TABLE user_bak AS SELECT id, name FROM user;\nDROP TABLE user;\nALTER TABLE user_bak RENAME TO user;")
+
+		m, err := NewMigrator(db.DB, dir)
+		So(err, ShouldBeNil)
+		m.Out = new(bytes.Buffer)
+		m.migrations = append(m.migrations, &Migration{Version: 2, Name: "seed", Up: func(tx *gorm.DB) error {
+			return tx.Exec("INSERT INTO user (name) VALUES ('a')").Error
+		}})
+		m.migrations[1], m.migrations[2] = m.migrations[2], m.migrations[1]
+
+		Convey("预览不修改数据库", func() {
+			m.DryRun = true
+			n, err := m.Up(0)
+			So(err, ShouldBeNil)
+			So(n, ShouldEqual, 3)
+			So(m.Out.(*bytes.Buffer).String(), ShouldContainSubstring, "CREATE INDEX idx_user_name")
+			So(db.HasTable("user"), ShouldBeFalse)
+			So(db.HasTable(MigrationTable), ShouldBeFalse)
+		})
+
+		Convey("查询状态不创建迁移表", func() {
+			status, err := m.Status()
+			So(err, ShouldBeNil)
+			So(len(status), ShouldEqual, 3)
+			for _, v := range status {
+				So(v.AppliedAt, ShouldBeNil)
+			}
+			So(db.HasTable(MigrationTable), ShouldBeFalse)
+		})
+
+		Convey("升级和回滚", func() {
+			n, err := m.Up(2)
+			So(err, ShouldBeNil)
+			So(n, ShouldEqual, 2)
+			status, _ := m.Status()
+			So(len(status), ShouldEqual, 3)
+			So(status[1].AppliedAt, ShouldNotBeNil)
+			So(status[2].AppliedAt, ShouldBeNil)
+
+			n, err = m.Up(0)
+			So(err, ShouldBeNil)
+			So(n, ShouldEqual, 1)
+			So(db.Exec("UPDATE user SET age = 1").Error, ShouldBeNil)
+
+			n, err = m.Down(1)
+			So(err, ShouldBeNil)
+			So(n, ShouldEqual, 1)
+			So(db.Exec("UPDATE user SET age = 1").Error, ShouldNotBeNil)
+
+			// 版本 2 没有回滚的方法
+			n, err = m.Down(2)
+			So(err, ShouldNotBeNil)
+			So(n, ShouldEqual, 0)
+		})
+
+		Convey("失败的迁移会回滚", func() {
+			m.migrations[1].Up = func(tx *gorm.DB) error {
+				tx.Exec("INSERT INTO user (name) VALUES ('a')")
+				return errors.New("failed")
+			}
+			n, err := m.Up(0)
+			So(err, ShouldNotBeNil)
+			So(n, ShouldEqual, 1)
+			var count int
+			db.Table("user").Count(&count)
+			So(count, ShouldEqual, 0)
+			status, _ := m.Status()
+			So(status[1].AppliedAt, ShouldBeNil)
+		})
+	})
+
+	Convey("测试迁移文件检查", t, func() {
+		dir := t.TempDir()
+		writeMigration(dir, "1_only_down.down.sql", "DROP TABLE user;")
+		_, err := NewMigrator(newTestDB(t).DB, dir)
+		So(err, ShouldNotBeNil)
+
+		So(splitSQL("a;\n\n-- x\nb\nc;\nd"), ShouldResemble, []string{"a;", "b\nc;", "d"})
+	})
+}
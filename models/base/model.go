@@ -0,0 +1,152 @@
+package base
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// Model 通用的基础模型，嵌入到业务模型中使用
+// DeletedAt 不为空的记录视为已删除，Delete 只设置删除时间，查询时自动过滤，Unscoped 可以查询和彻底删除
+// Version 用于乐观锁，更新时检查并加一，记录已被其他请求修改时返回 *ConflictError
+// CreatedBy 和 UpdatedBy 由 DB.SetUser 或 DB.SetContext 设置的用户自动填充
+type Model struct {
+	ID        int        `gorm:"primary_key" json:"id"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+	DeletedAt *time.Time `sql:"index" json:"-"`
+	Version   int        `gorm:"not null;default:1" json:"version"`
+	CreatedBy int        `json:"created_by"`
+	UpdatedBy int        `json:"updated_by"`
+}
+
+// baseModel 用于识别嵌入了 Model 的模型
+func (m *Model) baseModel() *Model {
+	return m
+}
+
+type baseModeler interface {
+	baseModel() *Model
+}
+
+// ConflictError 乐观锁冲突，记录已被其他请求修改
+type ConflictError struct {
+	Table   string
+	ID      interface{}
+	Version int
+}
+
+// Error ...
+func (e *ConflictError) Error() string {
+	return fmt.Sprintf("[orm] %s %v version %d conflict: record has been modified", e.Table, e.ID, e.Version)
+}
+
+// IsConflict 判断是否为乐观锁冲突
+func IsConflict(err error) bool {
+	var e *ConflictError
+	return errors.As(err, &e)
+}
+
+// auditUserKey 在 gorm.DB 中保存当前用户的键
+const auditUserKey = "base:audit_user"
+
+type auditUserCtxKey struct{}
+
+// WithUser 在 context 中记录当前用户，配合 DB.SetContext 填充审计字段
+func WithUser(ctx context.Context, userID int) context.Context {
+	return context.WithValue(ctx, auditUserCtxKey{}, userID)
+}
+
+// UserFromContext 读取 context 中的当前用户
+func UserFromContext(ctx context.Context) (int, bool) {
+	userID, ok := ctx.Value(auditUserCtxKey{}).(int)
+	return userID, ok
+}
+
+// SetUser 设置当前用户，之后的创建和更新会填充 CreatedBy 和 UpdatedBy
+func (t *DB) SetUser(userID int) *DB {
+	t.DB = t.DB.Set(auditUserKey, userID)
+	if t.ox != nil {
+		t.ox = t.ox.Set(auditUserKey, userID)
+	}
+	return t
+}
+
+// SetContext 使用 context 中 WithUser 记录的用户
+func (t *DB) SetContext(ctx context.Context) *DB {
+	if userID, ok := UserFromContext(ctx); ok {
+		t.SetUser(userID)
+	}
+	return t
+}
+
+// auditUser 返回当前操作的用户
+func auditUser(scope *gorm.Scope) (int, bool) {
+	if v, ok := scope.Get(auditUserKey); ok {
+		userID, ok := v.(int)
+		return userID, ok
+	}
+	return 0, false
+}
+
+// beforeCreateModel 创建记录时设置版本号和审计字段
+func beforeCreateModel(scope *gorm.Scope) {
+	m, ok := scope.Value.(baseModeler)
+	if !ok || scope.HasError() {
+		return
+	}
+	if m.baseModel().Version == 0 {
+		scope.SetColumn("Version", 1)
+	}
+	if userID, ok := auditUser(scope); ok {
+		if m.baseModel().CreatedBy == 0 {
+			scope.SetColumn("CreatedBy", userID)
+		}
+		scope.SetColumn("UpdatedBy", userID)
+	}
+}
+
+// beforeUpdateModel 更新记录时检查版本号并加一，设置审计字段
+func beforeUpdateModel(scope *gorm.Scope) {
+	m, ok := scope.Value.(baseModeler)
+	if !ok || scope.HasError() {
+		return
+	}
+	if userID, ok := auditUser(scope); ok {
+		scope.SetColumn("UpdatedBy", userID)
+	}
+	// 没有加载版本号的记录，如 Model(&User{}).Where(...).Update(...) 批量更新，不检查版本
+	version := m.baseModel().Version
+	if version <= 0 {
+		return
+	}
+	scope.Search.Where(fmt.Sprintf("%s.%s = ?", scope.QuotedTableName(), scope.Quote("version")), version)
+	scope.SetColumn("Version", version+1)
+	scope.InstanceSet("base:version", version)
+}
+
+// afterUpdateModel 版本号不匹配没有更新到记录时返回冲突错误
+func afterUpdateModel(scope *gorm.Scope) {
+	v, ok := scope.InstanceGet("base:version")
+	if !ok {
+		return
+	}
+	version := v.(int)
+	if !scope.HasError() && scope.DB().RowsAffected > 0 {
+		return
+	}
+	// 更新失败时恢复版本号
+	scope.Value.(baseModeler).baseModel().Version = version
+	if !scope.HasError() {
+		scope.Err(&ConflictError{Table: scope.TableName(), ID: scope.PrimaryKeyValue(), Version: version})
+	}
+}
+
+func init() {
+	gorm.DefaultCallback.Create().Before("gorm:create").Register("base:before_create_model", beforeCreateModel)
+	gorm.DefaultCallback.Update().Before("gorm:update").Register("base:before_update_model", beforeUpdateModel)
+	gorm.DefaultCallback.Update().After("gorm:update").Register("base:after_update_model", afterUpdateModel)
+}
@@ -0,0 +1,86 @@
+package base
+
+import (
+	"context"
+	"testing"
+
+	"github.com/jinzhu/gorm"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+type modelItem struct {
+	Model
+	Name string
+}
+
+func newModelDB(t *testing.T) *DB {
+	db := newTestDB(t)
+	db.AutoMigrate(new(modelItem))
+	return db
+}
+
+func TestModel(t *testing.T) {
+	Convey("测试软删除", t, func() {
+		db := newModelDB(t)
+		item := &modelItem{Name: "a"}
+		db.Create(item)
+		So(db.Delete(item).Error, ShouldBeNil)
+
+		So(db.First(new(modelItem), item.ID).Error, ShouldEqual, gorm.ErrRecordNotFound)
+		deleted := new(modelItem)
+		So(db.Unscoped().First(deleted, item.ID).Error, ShouldBeNil)
+		So(deleted.DeletedAt, ShouldNotBeNil)
+	})
+
+	Convey("测试乐观锁", t, func() {
+		db := newModelDB(t)
+		item := &modelItem{Name: "a"}
+		db.Create(item)
+		So(item.Version, ShouldEqual, 1)
+
+		a, b := new(modelItem), new(modelItem)
+		db.First(a, item.ID)
+		db.First(b, item.ID)
+
+		a.Name = "b"
+		So(db.Save(a).Error, ShouldBeNil)
+		So(a.Version, ShouldEqual, 2)
+
+		b.Name = "c"
+		err := db.Save(b).Error
+		So(IsConflict(err), ShouldBeTrue)
+		So(b.Version, ShouldEqual, 1)
+
+		So(db.Model(a).Update("name", "d").Error, ShouldBeNil)
+		So(a.Version, ShouldEqual, 3)
+		So(IsConflict(db.Model(b).Update("name", "e").Error), ShouldBeTrue)
+
+		out := new(modelItem)
+		db.First(out, item.ID)
+		So(out.Name, ShouldEqual, "d")
+		So(out.Version, ShouldEqual, 3)
+
+		// 批量更新不检查版本
+		So(db.Model(&modelItem{}).Where("id = ?", item.ID).Update("name", "f").Error, ShouldBeNil)
+	})
+
+	Convey("测试审计字段", t, func() {
+		db := newModelDB(t)
+		db.SetContext(WithUser(context.Background(), 7))
+		item := &modelItem{Name: "a"}
+		db.Create(item)
+		So(item.CreatedBy, ShouldEqual, 7)
+		So(item.UpdatedBy, ShouldEqual, 7)
+
+		So(db.Transaction(func(tx *DB) error {
+			tx.SetUser(8)
+			item.Name = "b"
+			return tx.Save(item).Error
+		}), ShouldBeNil)
+
+		out := new(modelItem)
+		db.First(out, item.ID)
+		So(out.CreatedBy, ShouldEqual, 7)
+		So(out.UpdatedBy, ShouldEqual, 8)
+	})
+}
@@ -0,0 +1,214 @@
+package base
+
+import (
+	"database/sql"
+
+	"github.com/jinzhu/gorm"
+)
+
+// Query 自动读写分离的查询，记录链式调用的条件，执行时再选择连接
+// Find, First, Last, Take, Count, Pluck, Scan, Row, Rows 使用从库
+// Create, Save, Update, Updates, Delete, Exec, Begin, Transaction 使用主库
+// 从库存在复制延迟，需要读取刚写入的数据时使用 Master
+//
+//	var users []*User
+//	err := cluster.Query().Where("status = ?", 1).Order("id DESC").Limit(10).Find(&users).Error
+type Query struct {
+	cluster *Cluster
+	chain   []func(*gorm.DB) *gorm.DB
+}
+
+// Query 返回自动读写分离的查询
+func (c *Cluster) Query() *Query {
+	return &Query{cluster: c}
+}
+
+// with 复制查询并追加一个链式调用，原查询不受影响，可以复用
+func (q *Query) with(fn func(*gorm.DB) *gorm.DB) *Query {
+	chain := make([]func(*gorm.DB) *gorm.DB, len(q.chain), len(q.chain)+1)
+	copy(chain, q.chain)
+	return &Query{cluster: q.cluster, chain: append(chain, fn)}
+}
+
+// apply 在连接上执行记录的链式调用
+func (q *Query) apply(db *gorm.DB) *gorm.DB {
+	for _, fn := range q.chain {
+		db = fn(db)
+	}
+	return db
+}
+
+// reader 返回应用了查询条件的从库连接
+func (q *Query) reader() *gorm.DB {
+	return q.apply(q.cluster.Slave().DB)
+}
+
+// writer 返回应用了查询条件的主库连接
+func (q *Query) writer() *gorm.DB {
+	return q.apply(q.cluster.Master().DB)
+}
+
+// Where 同 gorm.DB.Where
+func (q *Query) Where(query interface{}, args ...interface{}) *Query {
+	return q.with(func(db *gorm.DB) *gorm.DB { return db.Where(query, args...) })
+}
+
+// Or 同 gorm.DB.Or
+func (q *Query) Or(query interface{}, args ...interface{}) *Query {
+	return q.with(func(db *gorm.DB) *gorm.DB { return db.Or(query, args...) })
+}
+
+// Not 同 gorm.DB.Not
+func (q *Query) Not(query interface{}, args ...interface{}) *Query {
+	return q.with(func(db *gorm.DB) *gorm.DB { return db.Not(query, args...) })
+}
+
+// Model 同 gorm.DB.Model
+func (q *Query) Model(value interface{}) *Query {
+	return q.with(func(db *gorm.DB) *gorm.DB { return db.Model(value) })
+}
+
+// Table 同 gorm.DB.Table
+func (q *Query) Table(name string) *Query {
+	return q.with(func(db *gorm.DB) *gorm.DB { return db.Table(name) })
+}
+
+// Select 同 gorm.DB.Select
+func (q *Query) Select(query interface{}, args ...interface{}) *Query {
+	return q.with(func(db *gorm.DB) *gorm.DB { return db.Select(query, args...) })
+}
+
+// Joins 同 gorm.DB.Joins
+func (q *Query) Joins(query string, args ...interface{}) *Query {
+	return q.with(func(db *gorm.DB) *gorm.DB { return db.Joins(query, args...) })
+}
+
+// Order 同 gorm.DB.Order
+func (q *Query) Order(value interface{}, reorder ...bool) *Query {
+	return q.with(func(db *gorm.DB) *gorm.DB { return db.Order(value, reorder...) })
+}
+
+// Group 同 gorm.DB.Group
+func (q *Query) Group(query string) *Query {
+	return q.with(func(db *gorm.DB) *gorm.DB { return db.Group(query) })
+}
+
+// Having 同 gorm.DB.Having
+func (q *Query) Having(query interface{}, values ...interface{}) *Query {
+	return q.with(func(db *gorm.DB) *gorm.DB { return db.Having(query, values...) })
+}
+
+// Limit 同 gorm.DB.Limit
+func (q *Query) Limit(limit interface{}) *Query {
+	return q.with(func(db *gorm.DB) *gorm.DB { return db.Limit(limit) })
+}
+
+// Offset 同 gorm.DB.Offset
+func (q *Query) Offset(offset interface{}) *Query {
+	return q.with(func(db *gorm.DB) *gorm.DB { return db.Offset(offset) })
+}
+
+// Preload 同 gorm.DB.Preload
+func (q *Query) Preload(column string, conditions ...interface{}) *Query {
+	return q.with(func(db *gorm.DB) *gorm.DB { return db.Preload(column, conditions...) })
+}
+
+// Unscoped 同 gorm.DB.Unscoped
+func (q *Query) Unscoped() *Query {
+	return q.with(func(db *gorm.DB) *gorm.DB { return db.Unscoped() })
+}
+
+// Scopes 同 gorm.DB.Scopes，可以使用 Keyset 等函数
+func (q *Query) Scopes(funcs ...func(*gorm.DB) *gorm.DB) *Query {
+	return q.with(func(db *gorm.DB) *gorm.DB { return db.Scopes(funcs...) })
+}
+
+// Raw 同 gorm.DB.Raw，只能用于查询，配合 Scan, Row, Rows 使用
+func (q *Query) Raw(sql string, values ...interface{}) *Query {
+	return q.with(func(db *gorm.DB) *gorm.DB { return db.Raw(sql, values...) })
+}
+
+// Find 在从库查询所有匹配的记录
+func (q *Query) Find(out interface{}, where ...interface{}) *gorm.DB {
+	return q.reader().Find(out, where...)
+}
+
+// First 在从库按主键顺序查询第一条记录
+func (q *Query) First(out interface{}, where ...interface{}) *gorm.DB {
+	return q.reader().First(out, where...)
+}
+
+// Last 在从库按主键顺序查询最后一条记录
+func (q *Query) Last(out interface{}, where ...interface{}) *gorm.DB {
+	return q.reader().Last(out, where...)
+}
+
+// Take 在从库查询一条记录，不指定顺序
+func (q *Query) Take(out interface{}, where ...interface{}) *gorm.DB {
+	return q.reader().Take(out, where...)
+}
+
+// Count 在从库统计记录数
+func (q *Query) Count(value interface{}) *gorm.DB {
+	return q.reader().Count(value)
+}
+
+// Pluck 在从库查询一列的值
+func (q *Query) Pluck(column string, value interface{}) *gorm.DB {
+	return q.reader().Pluck(column, value)
+}
+
+// Scan 在从库查询并将结果填充到 dest
+func (q *Query) Scan(dest interface{}) *gorm.DB {
+	return q.reader().Scan(dest)
+}
+
+// Row 在从库查询一行
+func (q *Query) Row() *sql.Row {
+	return q.reader().Row()
+}
+
+// Rows 在从库查询多行
+func (q *Query) Rows() (*sql.Rows, error) {
+	return q.reader().Rows()
+}
+
+// Create 在主库创建记录
+func (q *Query) Create(value interface{}) *gorm.DB {
+	return q.writer().Create(value)
+}
+
+// Save 在主库保存记录，没有主键时创建
+func (q *Query) Save(value interface{}) *gorm.DB {
+	return q.writer().Save(value)
+}
+
+// Update 在主库更新字段
+func (q *Query) Update(attrs ...interface{}) *gorm.DB {
+	return q.writer().Update(attrs...)
+}
+
+// Updates 在主库更新多个字段
+func (q *Query) Updates(values interface{}, ignoreProtectedAttrs ...bool) *gorm.DB {
+	return q.writer().Updates(values, ignoreProtectedAttrs...)
+}
+
+// Delete 在主库删除记录
+func (q *Query) Delete(value interface{}, where ...interface{}) *gorm.DB {
+	return q.writer().Delete(value, where...)
+}
+
+// Exec 在主库执行 SQL
+func (q *Query) Exec(sql string, values ...interface{}) *gorm.DB {
+	return q.writer().Exec(sql, values...)
+}
+
+// Begin 在主库开启事务，记录的查询条件不会带入事务
+func (q *Query) Begin() *DB {
+	return q.cluster.Master().Begin()
+}
+
+// Transaction 在主库的事务中执行 fn，同 DB.Transaction
+func (q *Query) Transaction(fn func(tx *DB) error) error {
+	return q.cluster.Master().Transaction(fn)
+}
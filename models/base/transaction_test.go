@@ -0,0 +1,123 @@
+package base
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+
+	"github.com/jinzhu/gorm"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+type txItem struct {
+	ID   int
+	Name string
+}
+
+func newTestDB(t *testing.T) *DB {
+	db, err := gorm.Open("sqlite3", t.TempDir()+"/test.db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.SingularTable(true)
+	db.AutoMigrate(new(txItem))
+	return NewDB(db, true)
+}
+
+func txNames(db *DB) []string {
+	var items []*txItem
+	db.Order("id").Find(&items)
+	names := make([]string, 0, len(items))
+	for _, v := range items {
+		names = append(names, v.Name)
+	}
+	return names
+}
+
+func TestTransaction(t *testing.T) {
+	Convey("测试内层事务单独回滚", t, func() {
+		db := newTestDB(t)
+		db.Begin()
+		db.Create(&txItem{Name: "a"})
+		db.Begin()
+		db.Create(&txItem{Name: "b"})
+		So(db.Rollback().Error, ShouldBeNil)
+		db.Begin()
+		db.Create(&txItem{Name: "c"})
+		So(db.Commit().Error, ShouldBeNil)
+		So(db.Commit().Error, ShouldBeNil)
+		So(txNames(db), ShouldResemble, []string{"a", "c"})
+	})
+
+	Convey("测试外层事务回滚时丢弃内层的提交", t, func() {
+		db := newTestDB(t)
+		db.Begin()
+		db.Create(&txItem{Name: "a"})
+		db.Begin()
+		db.Create(&txItem{Name: "b"})
+		db.Commit()
+		So(db.Rollback().Error, ShouldBeNil)
+		So(txNames(db), ShouldResemble, []string{})
+	})
+
+	Convey("测试闭包事务", t, func() {
+		db := newTestDB(t)
+		errInner := errors.New("inner")
+		err := db.Transaction(func(tx *DB) error {
+			tx.Create(&txItem{Name: "a"})
+			err := tx.Transaction(func(tx *DB) error {
+				tx.Create(&txItem{Name: "b"})
+				return errInner
+			})
+			So(err, ShouldEqual, errInner)
+			err = tx.Transaction(func(tx *DB) error {
+				tx.Create(&txItem{Name: "c"})
+				panic("boom")
+			})
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "boom")
+			return tx.Transaction(func(tx *DB) error {
+				return tx.Create(&txItem{Name: "d"}).Error
+			})
+		})
+		So(err, ShouldBeNil)
+		So(db.transactionLevel, ShouldEqual, 0)
+		So(txNames(db), ShouldResemble, []string{"a", "d"})
+
+		err = db.Transaction(func(tx *DB) error {
+			tx.Create(&txItem{Name: "e"})
+			tx.Begin()
+			tx.Create(&txItem{Name: "f"})
+			return errInner
+		})
+		So(err, ShouldEqual, errInner)
+		So(db.transactionLevel, ShouldEqual, 0)
+		So(txNames(db), ShouldResemble, []string{"a", "d"})
+	})
+
+	Convey("测试开启事务失败", t, func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		db := newTestDB(t)
+		So(db.BeginContext(ctx).Error, ShouldNotBeNil)
+		So(db.transactionLevel, ShouldEqual, 0)
+		So(db.Create(&txItem{Name: "a"}).Error, ShouldNotBeNil)
+
+		// 保存点创建失败时层级不变
+		db = newTestDB(t)
+		db.Begin()
+		db.Create(&txItem{Name: "a"})
+		db.DB.CommonDB().(*sql.Tx).Rollback()
+		So(db.Begin().Error, ShouldNotBeNil)
+		So(db.transactionLevel, ShouldEqual, 1)
+		db.Rollback()
+		So(db.transactionLevel, ShouldEqual, 0)
+
+		db = newTestDB(t)
+		So(db.TransactionContext(ctx, func(tx *DB) error { return nil }), ShouldNotBeNil)
+		So(db.transactionLevel, ShouldEqual, 0)
+		So(db.Create(&txItem{Name: "b"}).Error, ShouldBeNil)
+		So(txNames(db), ShouldResemble, []string{"b"})
+	})
+}
@@ -2,11 +2,15 @@ package accesslog
 
 import (
 	"bytes"
+	"encoding/json"
 	"fmt"
 	"net/http"
 	"os"
+	"strconv"
 	"strings"
 	"time"
+	"unicode"
+	"unicode/utf8"
 
 	"github.com/go-baa/baa"
 )
@@ -18,18 +22,65 @@ const (
 	FormatterSymbolEnd = '%'
 	// DefaultFormatter 默认日志格式
 	DefaultFormatter = `%remote_addr% "%http_x_forwarded_for%" %request% %status% %body_bytes_sent% %exec_time% %http_referer% %http_user_agent%`
+
+	// FormatText 按 %var% 模板输出
+	FormatText = "text"
+	// FormatJSON 每行输出一个 JSON 对象
+	FormatJSON = "json"
+	// FormatLogfmt 每行输出 key=value
+	FormatLogfmt = "logfmt"
+
+	// ContextRequestID 上下文中请求 ID 的 key，没有时读取 X-Request-Id 请求头
+	ContextRequestID = "request_id"
+	// ContextUserID 上下文中用户 ID 的 key
+	ContextUserID = "user_id"
+	// ContextUpstreamTime 上下文中上游服务耗时的 key，使用 AddUpstreamTime 累加
+	ContextUpstreamTime = "upstream_time"
 )
 
+// DefaultFields json 和 logfmt 格式默认输出的字段
+var DefaultFields = []string{
+	"time_iso8601", "request_id", "remote_addr", "http_x_forwarded_for", "method", "request_uri",
+	"route_name", "status", "request_body_bytes", "body_bytes_sent", "request_time", "upstream_time",
+	"user_id", "http_referer", "http_user_agent",
+}
+
+// AddUpstreamTime 累加请求中调用上游服务的耗时，记录为 upstream_time
+func AddUpstreamTime(c *baa.Context, d time.Duration) {
+	prev, _ := c.Get(ContextUpstreamTime).(time.Duration)
+	c.Set(ContextUpstreamTime, prev+d)
+}
+
 // formatter 日志格式处理器
 type formatter struct {
-	Text string
-	Vars []string
+	Mode   string // text, json, logfmt
+	Text   string
+	Vars   []string
+	Fields []string // json, logfmt 格式的字段名，与 Vars 一一对应
 }
 
 // newFormatter 创建一个日志格式示例
-func newFormatter(format string) *formatter {
+// format 为 json 或 logfmt 时按 fields 输出字段，fields 为空时使用 DefaultFields
+func newFormatter(format string, fields []string) *formatter {
 	f := new(formatter)
-	f.perpare(format)
+	switch format {
+	case FormatJSON, FormatLogfmt:
+		f.Mode = format
+		if len(fields) == 0 {
+			fields = DefaultFields
+		}
+		for _, field := range fields {
+			name, v := field, field
+			if i := strings.IndexByte(field, '='); i > 0 {
+				name, v = field[:i], field[i+1:]
+			}
+			f.Fields = append(f.Fields, name)
+			f.Vars = append(f.Vars, v)
+		}
+	default:
+		f.Mode = FormatText
+		f.perpare(format)
+	}
 	return f
 }
 
@@ -64,45 +115,137 @@ func (f *formatter) perpare(format string) {
 
 // build 构建日志行
 func (f *formatter) build(c *baa.Context, start time.Time) string {
-	var buf []interface{}
-	for _, v := range f.Vars {
-		switch v {
-		case "hostname":
-			hostname, _ := os.Hostname()
-			buf = append(buf, hostname)
-		case "time_iso8601":
-			buf = append(buf, start.Format("2006-01-02T15:04:05+0800"))
-		case "query_string":
-			var qBuf bytes.Buffer
-			for key, value := range c.Querys() {
-				qBuf.WriteString(fmt.Sprintf("%s=%v&", key, value))
-			}
-			buf = append(buf, strings.TrimRight(qBuf.String(), "&"))
-		case "http_host":
-			buf = append(buf, c.Req.Host)
-		case "exec_time":
-			buf = append(buf, time.Since(start).String())
-		case "method":
-			buf = append(buf, c.Req.Method)
-		case "remote_addr":
-			buf = append(buf, c.RemoteAddr())
-		case "request":
-			buf = append(buf, c.Req.Method+" "+c.Req.RequestURI+" "+c.Req.Proto)
-		case "request_uri":
-			buf = append(buf, c.Req.RequestURI)
-		case "status":
-			buf = append(buf, c.Resp.Status())
-		case "status_text":
-			buf = append(buf, http.StatusText(c.Resp.Status()))
-		case "body_bytes_sent":
-			buf = append(buf, c.Resp.Size())
-		default:
-			if strings.HasPrefix(v, "http_") {
-				buf = append(buf, c.Req.Header.Get(strings.Replace(string(v[5:]), "_", "-", -1)))
-			} else {
-				buf = append(buf, "")
-			}
-		}
+	buf := make([]interface{}, len(f.Vars))
+	for i, v := range f.Vars {
+		buf[i] = value(c, v, start)
+	}
+	switch f.Mode {
+	case FormatJSON:
+		return f.buildJSON(buf)
+	case FormatLogfmt:
+		return f.buildLogfmt(buf)
 	}
 	return fmt.Sprintf(f.Text, buf...)
 }
+
+// buildJSON 按字段顺序输出一行 JSON
+func (f *formatter) buildJSON(values []interface{}) string {
+	buf := new(bytes.Buffer)
+	buf.WriteByte('{')
+	for i, v := range values {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		key, _ := json.Marshal(f.Fields[i])
+		buf.Write(key)
+		buf.WriteByte(':')
+		data, err := json.Marshal(v)
+		if err != nil {
+			data, _ = json.Marshal(fmt.Sprint(v))
+		}
+		buf.Write(data)
+	}
+	buf.WriteString("}\n")
+	return buf.String()
+}
+
+// buildLogfmt 输出一行 key=value，值包含空格、引号、等号或为空时加引号转义
+func (f *formatter) buildLogfmt(values []interface{}) string {
+	buf := new(bytes.Buffer)
+	for i, v := range values {
+		if i > 0 {
+			buf.WriteByte(' ')
+		}
+		buf.WriteString(f.Fields[i])
+		buf.WriteByte('=')
+		s := fmt.Sprint(v)
+		if needQuote(s) {
+			s = strconv.Quote(s)
+		}
+		buf.WriteString(s)
+	}
+	buf.WriteByte('\n')
+	return buf.String()
+}
+
+func needQuote(s string) bool {
+	if s == "" {
+		return true
+	}
+	for _, r := range s {
+		if r <= ' ' || r == '=' || r == '"' || r == '\\' || r == utf8.RuneError || !unicode.IsPrint(r) {
+			return true
+		}
+	}
+	return false
+}
+
+// value 返回变量的值
+func value(c *baa.Context, v string, start time.Time) interface{} {
+	switch v {
+	case "hostname":
+		hostname, _ := os.Hostname()
+		return hostname
+	case "time_iso8601":
+		return start.Format("2006-01-02T15:04:05+0800")
+	case "query_string":
+		var qBuf bytes.Buffer
+		for key, value := range c.Querys() {
+			qBuf.WriteString(fmt.Sprintf("%s=%v&", key, value))
+		}
+		return strings.TrimRight(qBuf.String(), "&")
+	case "http_host":
+		return c.Req.Host
+	case "exec_time":
+		return time.Since(start).String()
+	case "request_time":
+		return seconds(time.Since(start))
+	case "upstream_time":
+		d, _ := c.Get(ContextUpstreamTime).(time.Duration)
+		return seconds(d)
+	case "method":
+		return c.Req.Method
+	case "remote_addr":
+		return c.RemoteAddr()
+	case "request":
+		return c.Req.Method + " " + c.Req.RequestURI + " " + c.Req.Proto
+	case "request_uri":
+		return c.Req.RequestURI
+	case "request_id":
+		if id, ok := c.Get(ContextRequestID).(string); ok && id != "" {
+			return id
+		}
+		return c.Req.Header.Get("X-Request-Id")
+	case "route_name":
+		return c.RouteName()
+	case "request_body_bytes":
+		if c.Req.ContentLength < 0 {
+			return int64(0)
+		}
+		return c.Req.ContentLength
+	case "user_id":
+		if id := c.Get(ContextUserID); id != nil {
+			return id
+		}
+		return ""
+	case "status":
+		return c.Resp.Status()
+	case "status_text":
+		return http.StatusText(c.Resp.Status())
+	case "body_bytes_sent":
+		return c.Resp.Size()
+	default:
+		if strings.HasPrefix(v, "sent_http_") {
+			return c.Resp.Header().Get(strings.Replace(v[10:], "_", "-", -1))
+		}
+		if strings.HasPrefix(v, "http_") {
+			return c.Req.Header.Get(strings.Replace(v[5:], "_", "-", -1))
+		}
+		return ""
+	}
+}
+
+// seconds 返回以秒为单位的时间，精确到毫秒
+func seconds(d time.Duration) float64 {
+	return float64(d/time.Millisecond) / 1000
+}
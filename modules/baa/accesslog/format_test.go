@@ -0,0 +1,80 @@
+package accesslog
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-baa/baa"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// buildLine 处理一个请求并返回 f 构建的日志行
+func buildLine(f *formatter, body string) string {
+	var line string
+	app := baa.New()
+	app.Use(func(c *baa.Context) {
+		start := time.Now()
+		c.Next()
+		line = f.build(c, start)
+	})
+	app.Post("/users/:id", func(c *baa.Context) {
+		c.Set(ContextUserID, 42)
+		AddUpstreamTime(c, 120*time.Millisecond)
+		AddUpstreamTime(c, 30*time.Millisecond)
+		c.Resp.Header().Set("X-Cache", "HIT")
+		c.String(201, "ok")
+	}).Name("user")
+
+	req := httptest.NewRequest("POST", "/users/1?q=a", strings.NewReader(body))
+	req.Header.Set("X-Request-Id", "req-1")
+	req.Header.Set("User-Agent", `Mozilla/5.0 (X11; "Linux")`)
+	app.ServeHTTP(httptest.NewRecorder(), req)
+	return line
+}
+
+func TestFormatter(t *testing.T) {
+	Convey("测试文本格式", t, func() {
+		f := newFormatter(`%request% %status% %route_name% %request_id% %sent_http_x_cache% %unknown%`, nil)
+		So(f.Mode, ShouldEqual, FormatText)
+		So(buildLine(f, "hello"), ShouldEqual, "POST /users/1?q=a HTTP/1.1 201 user req-1 HIT \n")
+	})
+
+	Convey("测试 JSON 格式", t, func() {
+		f := newFormatter(FormatJSON, []string{"request_id", "route_name", "status", "request_body_bytes", "upstream_time", "user_id", "ua=http_user_agent", "cache=sent_http_x_cache"})
+		line := buildLine(f, "hello")
+		So(strings.HasSuffix(line, "}\n"), ShouldBeTrue)
+		So(line, ShouldStartWith, `{"request_id":"req-1","route_name":"user","status":201,`)
+
+		var v map[string]interface{}
+		So(json.Unmarshal([]byte(line), &v), ShouldBeNil)
+		So(v["request_body_bytes"], ShouldEqual, 5)
+		So(v["upstream_time"], ShouldEqual, 0.15)
+		So(v["user_id"], ShouldEqual, 42)
+		So(v["ua"], ShouldEqual, `Mozilla/5.0 (X11; "Linux")`)
+		So(v["cache"], ShouldEqual, "HIT")
+	})
+
+	Convey("测试默认字段", t, func() {
+		f := newFormatter(FormatJSON, nil)
+		var v map[string]interface{}
+		So(json.Unmarshal([]byte(buildLine(f, "")), &v), ShouldBeNil)
+		So(len(v), ShouldEqual, len(DefaultFields))
+		So(v["method"], ShouldEqual, "POST")
+	})
+
+	Convey("测试 logfmt 格式", t, func() {
+		f := newFormatter(FormatLogfmt, []string{"method", "status", "route_name", "ua=http_user_agent", "referer=http_referer", "upstream_time"})
+		So(buildLine(f, ""), ShouldEqual, `method=POST status=201 route_name=user ua="Mozilla/5.0 (X11; \"Linux\")" referer="" upstream_time=0.15`+"\n")
+	})
+
+	Convey("测试 logfmt 转义", t, func() {
+		So(needQuote("abc"), ShouldBeFalse)
+		So(needQuote("中文"), ShouldBeFalse)
+		So(needQuote("a=b"), ShouldBeTrue)
+		So(needQuote("a\nb"), ShouldBeTrue)
+		So(needQuote(`a\b`), ShouldBeTrue)
+	})
+}
@@ -21,7 +21,8 @@ type Logger interface {
 // Options 访问日志配置
 type Options struct {
 	Open     bool                   // 日志是否开启
-	Format   string                 // 日志格式
+	Format   string                 // 日志格式，%var% 模板，或 json、logfmt
+	Fields   []string               // json、logfmt 格式输出的变量，可以用 name=var 指定字段名，默认 DefaultFields
 	FlushTTL time.Duration          // 日志缓存刷新时间，单位：秒
 	Adapter  string                 // 适配器, file, flume
 	Config   map[string]interface{} // 适配器配置
@@ -104,18 +105,15 @@ func New(o Options) baa.Middleware {
 	}()
 
 	// new formater
-	formater := newFormatter(o.Format)
+	formater := newFormatter(o.Format, o.Fields)
 
 	return func(c *baa.Context) {
 		start := time.Now()
 
 		c.Next()
 
-		// 异步日志
-		go func() {
-			line := formater.build(c, start)
-			adapter.Log(line)
-		}()
+		// 请求结束后 Context 会被复用，需要在返回前构建日志行，由适配器异步写入
+		adapter.Log(formater.build(c, start))
 	}
 }
 
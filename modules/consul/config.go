@@ -0,0 +1,472 @@
+package consul
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-baa/log"
+	"github.com/go-baa/setting"
+	"github.com/hashicorp/consul/api"
+	"gopkg.in/yaml.v2"
+)
+
+// ConfigOptions KV 配置的选项
+type ConfigOptions struct {
+	SeedSetting bool          // 是否在首次加载时把配置写入 setting.Config，之后的热更新不会写入 setting.Config
+	WaitTime    time.Duration // 阻塞查询的等待时间，默认 5 分钟
+}
+
+// Change 配置项的变化
+type Change struct {
+	Key     string
+	Old     string
+	New     string
+	Deleted bool
+}
+
+type changeHandler struct {
+	key string
+	fn  func(Change)
+}
+
+// Config 从 KV 前缀加载的配置，通过阻塞查询热更新
+//
+// 前缀下的 key 去掉前缀后把 "/" 换成 "." 作为配置名，例如 config/app/sms/provider 为 sms.provider
+// 以 .json .yaml .yml .ini 结尾的 key 按格式解析，其中的字段以 "." 拼接在去掉扩展名的配置名后，
+// 例如 config/app/sms.yaml 中的 provider 为 sms.provider，ini 的 section 作为一级字段
+// 解析失败的 key 会记录日志并保留上次解析成功的值
+// 热更新只对通过 Config 读取的代码生效，直接读取 setting.Config 的代码看不到热更新的值
+type Config struct {
+	kv      *api.KV
+	prefix  string
+	options ConfigOptions
+	parsed  map[string]map[string]interface{} // KV 的 key => 上次解析成功的配置，只在更新的 goroutine 中使用
+
+	mu       sync.RWMutex
+	values   map[string]interface{} // 配置名 => 解析后的值
+	original map[string]string      // 首次加载时被覆盖的配置在 setting.Config 中的原值
+	index    uint64
+	handlers []changeHandler
+
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// NewConfig 加载 KV 前缀下的配置，首次加载失败时返回错误，之后在后台持续更新
+// 开启 SeedSetting 时在返回前把配置写入 setting.Config，之后不再修改 setting.Config，因为它不是并发安全的
+func (t *Consul) NewConfig(prefix string, options ConfigOptions) (*Config, error) {
+	if options.WaitTime <= 0 {
+		options.WaitTime = DefaultWaitTime
+	}
+	prefix = strings.TrimPrefix(prefix, "/")
+	if prefix != "" && !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	c := &Config{
+		kv:       t.client.KV(),
+		prefix:   prefix,
+		options:  options,
+		parsed:   make(map[string]map[string]interface{}),
+		values:   make(map[string]interface{}),
+		original: make(map[string]string),
+		cancel:   cancel,
+		done:     make(chan struct{}),
+	}
+	if err := c.update(ctx); err != nil {
+		cancel()
+		return nil, err
+	}
+	if options.SeedSetting {
+		c.seedSetting()
+	}
+	go c.watch(ctx)
+	return c, nil
+}
+
+// Get 返回配置项的值，JSON 和 YAML 中的值保持原来的类型，其他为字符串
+func (t *Config) Get(key string) (interface{}, bool) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	v, ok := t.values[strings.ToLower(key)]
+	return v, ok
+}
+
+// GetString 返回配置项的字符串值
+func (t *Config) GetString(key string) (string, bool) {
+	v, ok := t.Get(key)
+	if !ok {
+		return "", false
+	}
+	return valueString(v), true
+}
+
+// MustString 返回配置项的值，KV 中没有时从 setting.Config 读取
+// 首次加载时被覆盖的配置，从 KV 删除后返回覆盖前的原值
+func (t *Config) MustString(key, value string) string {
+	if v, ok := t.GetString(key); ok && v != "" {
+		return v
+	}
+	if v, ok := t.originalString(key); ok {
+		if v != "" {
+			return v
+		}
+		return value
+	}
+	return setting.Config.MustString(key, value)
+}
+
+// MustInt 返回配置项的值，KV 中没有或不是整数时从 setting.Config 读取
+func (t *Config) MustInt(key string, value int) int {
+	if v, ok := t.GetString(key); ok {
+		if n, err := strconv.Atoi(v); err == nil {
+			return n
+		}
+	}
+	if v, ok := t.originalString(key); ok {
+		if n, err := strconv.Atoi(v); err == nil {
+			return n
+		}
+		return value
+	}
+	return setting.Config.MustInt(key, value)
+}
+
+// MustInt64 返回配置项的值，KV 中没有或不是整数时从 setting.Config 读取
+func (t *Config) MustInt64(key string, value int64) int64 {
+	if v, ok := t.GetString(key); ok {
+		if n, err := strconv.ParseInt(v, 10, 64); err == nil {
+			return n
+		}
+	}
+	if v, ok := t.originalString(key); ok {
+		if n, err := strconv.ParseInt(v, 10, 64); err == nil {
+			return n
+		}
+		return value
+	}
+	return setting.Config.MustInt64(key, value)
+}
+
+// MustFloat 返回配置项的值，KV 中没有或不是数字时从 setting.Config 读取
+func (t *Config) MustFloat(key string, value float64) float64 {
+	if v, ok := t.GetString(key); ok {
+		if n, err := strconv.ParseFloat(v, 64); err == nil {
+			return n
+		}
+	}
+	if v, ok := t.originalString(key); ok {
+		if n, err := strconv.ParseFloat(v, 64); err == nil {
+			return n
+		}
+		return value
+	}
+	return setting.Config.MustFloat(key, value)
+}
+
+// MustBool 返回配置项的值，KV 中没有或不是布尔值时从 setting.Config 读取
+func (t *Config) MustBool(key string, value bool) bool {
+	if v, ok := t.GetString(key); ok {
+		if b, err := strconv.ParseBool(strings.ToLower(v)); err == nil {
+			return b
+		}
+	}
+	if v, ok := t.originalString(key); ok {
+		if b, err := strconv.ParseBool(strings.ToLower(v)); err == nil {
+			return b
+		}
+		return value
+	}
+	return setting.Config.MustBool(key, value)
+}
+
+// originalString 返回首次加载时被覆盖的配置在 setting.Config 中的原值，原来不存在时为空字符串
+// 这些配置在 setting.Config 中已经是 KV 首次加载的值，不能再从 setting.Config 读取
+func (t *Config) originalString(key string) (string, bool) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	v, ok := t.original[strings.ToLower(key)]
+	return v, ok
+}
+
+// Decode 把 key 下的所有配置项解码到 v，例如 Decode("sms", &smsConfig)
+func (t *Config) Decode(key string, v interface{}) error {
+	key = strings.ToLower(key)
+	tree := make(map[string]interface{})
+	t.mu.RLock()
+	for k, val := range t.values {
+		if key != "" {
+			if !strings.HasPrefix(k, key+".") {
+				continue
+			}
+			k = k[len(key)+1:]
+		}
+		setTree(tree, strings.Split(k, "."), val)
+	}
+	t.mu.RUnlock()
+
+	data, err := json.Marshal(tree)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// OnChange 注册配置变化的回调，key 为空时监听所有配置，以 "." 结尾时监听该前缀下的配置
+// 回调在更新配置的 goroutine 中按配置名顺序调用
+func (t *Config) OnChange(key string, fn func(Change)) {
+	t.mu.Lock()
+	t.handlers = append(t.handlers, changeHandler{strings.ToLower(key), fn})
+	t.mu.Unlock()
+}
+
+// Close 停止更新配置，首次加载时写入 setting.Config 的配置保持不变
+func (t *Config) Close() {
+	t.cancel()
+	<-t.done
+}
+
+func (t *Config) watch(ctx context.Context) {
+	defer close(t.done)
+	watchLoop(ctx, "kv "+t.prefix, t.update)
+}
+
+// update 以上次的 index 执行一次阻塞查询，应用变化的配置并调用回调
+func (t *Config) update(ctx context.Context) error {
+	t.mu.RLock()
+	index := t.index
+	t.mu.RUnlock()
+
+	q := &api.QueryOptions{WaitIndex: index, WaitTime: t.options.WaitTime}
+	pairs, meta, err := t.kv.List(t.prefix, q.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	if meta.LastIndex < index {
+		t.mu.Lock()
+		t.index = 0
+		t.mu.Unlock()
+		return nil
+	}
+	if meta.LastIndex == index && index > 0 {
+		return nil
+	}
+
+	// 按 key 的顺序合并，解析失败的 key 保留上次解析成功的值
+	parsed := make(map[string]map[string]interface{}, len(pairs))
+	values := make(map[string]interface{})
+	for _, pair := range pairs {
+		v := make(map[string]interface{})
+		if err := parsePair(strings.TrimPrefix(pair.Key, t.prefix), pair.Value, v); err != nil {
+			log.Errorf("consul.Config: parse %s error: %v, keep the last value\n", pair.Key, err)
+			if v = t.parsed[pair.Key]; v == nil {
+				continue
+			}
+		}
+		parsed[pair.Key] = v
+		for k, val := range v {
+			values[k] = val
+		}
+	}
+	t.parsed = parsed
+
+	t.mu.Lock()
+	t.index = meta.LastIndex
+	changes := diffValues(t.values, values)
+	t.values = values
+	handlers := t.handlers
+	t.mu.Unlock()
+
+	for _, c := range changes {
+		for _, h := range handlers {
+			if h.key == "" || h.key == c.Key || (strings.HasSuffix(h.key, ".") && strings.HasPrefix(c.Key, h.key)) {
+				h.fn(c)
+			}
+		}
+	}
+	return nil
+}
+
+// seedSetting 把首次加载的配置写入 setting.Config，记录被覆盖的原值，只在 NewConfig 中调用
+func (t *Config) seedSetting() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for k, v := range t.values {
+		t.original[k], _ = setting.Config.GetString(k)
+		setting.Config.Set(k, valueString(v))
+	}
+}
+
+// diffValues 返回按配置名排序的变化
+func diffValues(old, new map[string]interface{}) []Change {
+	var changes []Change
+	for k, v := range new {
+		s := valueString(v)
+		if ov, ok := old[k]; !ok {
+			changes = append(changes, Change{Key: k, New: s})
+		} else if olds := valueString(ov); olds != s {
+			changes = append(changes, Change{Key: k, Old: olds, New: s})
+		}
+	}
+	for k, v := range old {
+		if _, ok := new[k]; !ok {
+			changes = append(changes, Change{Key: k, Old: valueString(v), Deleted: true})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Key < changes[j].Key
+	})
+	return changes
+}
+
+// parsePair 按 key 的扩展名解析值，写入 values
+func parsePair(key string, value []byte, values map[string]interface{}) error {
+	if key == "" || strings.HasSuffix(key, "/") {
+		// 目录
+		return nil
+	}
+	ext := path.Ext(key)
+	name := strings.ToLower(strings.Replace(strings.TrimSuffix(key, ext), "/", ".", -1))
+	switch strings.ToLower(ext) {
+	case ".json":
+		var v interface{}
+		if err := json.Unmarshal(value, &v); err != nil {
+			return err
+		}
+		flatten(name, v, values)
+	case ".yaml", ".yml":
+		var v interface{}
+		if err := yaml.Unmarshal(value, &v); err != nil {
+			return err
+		}
+		flatten(name, v, values)
+	case ".ini":
+		v, err := parseINI(value)
+		if err != nil {
+			return err
+		}
+		flatten(name, v, values)
+	default:
+		name = strings.ToLower(strings.Replace(key, "/", ".", -1))
+		values[name] = strings.TrimSpace(string(value))
+	}
+	return nil
+}
+
+// flatten 把嵌套的值展开为以 "." 连接的配置名，数组作为一个值
+func flatten(name string, v interface{}, values map[string]interface{}) {
+	join := func(k string) string {
+		k = strings.ToLower(k)
+		if name == "" {
+			return k
+		}
+		return name + "." + k
+	}
+	switch m := v.(type) {
+	case map[string]interface{}:
+		for k, sub := range m {
+			flatten(join(k), sub, values)
+		}
+	case map[interface{}]interface{}:
+		for k, sub := range m {
+			flatten(join(fmt.Sprint(k)), sub, values)
+		}
+	case []interface{}:
+		for i, sub := range m {
+			m[i] = normalize(sub)
+		}
+		values[name] = m
+	default:
+		if name != "" {
+			values[name] = v
+		}
+	}
+}
+
+// normalize 把 YAML 解析出的 map[interface{}]interface{} 转为可以 JSON 编码的类型
+func normalize(v interface{}) interface{} {
+	switch m := v.(type) {
+	case map[interface{}]interface{}:
+		out := make(map[string]interface{}, len(m))
+		for k, sub := range m {
+			out[fmt.Sprint(k)] = normalize(sub)
+		}
+		return out
+	case map[string]interface{}:
+		for k, sub := range m {
+			m[k] = normalize(sub)
+		}
+	case []interface{}:
+		for i, sub := range m {
+			m[i] = normalize(sub)
+		}
+	}
+	return v
+}
+
+// parseINI 解析 ini 格式，section 外的配置项在第一级
+func parseINI(data []byte) (map[string]interface{}, error) {
+	root := make(map[string]interface{})
+	current := root
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' || line[0] == ';' {
+			continue
+		}
+		if line[0] == '[' {
+			if line[len(line)-1] != ']' {
+				return nil, fmt.Errorf("line %d: invalid section", n)
+			}
+			section := strings.TrimSpace(line[1 : len(line)-1])
+			current = make(map[string]interface{})
+			root[section] = current
+			continue
+		}
+		i := strings.IndexAny(line, "=:")
+		if i <= 0 {
+			return nil, fmt.Errorf("line %d: invalid option", n)
+		}
+		current[strings.TrimSpace(line[:i])] = strings.TrimSpace(line[i+1:])
+	}
+	return root, scanner.Err()
+}
+
+// setTree 按路径把值写入嵌套的 map
+func setTree(tree map[string]interface{}, keys []string, v interface{}) {
+	for _, k := range keys[:len(keys)-1] {
+		sub, ok := tree[k].(map[string]interface{})
+		if !ok {
+			sub = make(map[string]interface{})
+			tree[k] = sub
+		}
+		tree = sub
+	}
+	tree[keys[len(keys)-1]] = v
+}
+
+// valueString 返回值的字符串形式，数组编码为 JSON
+func valueString(v interface{}) string {
+	switch val := v.(type) {
+	case string:
+		return val
+	case float64:
+		return strconv.FormatFloat(val, 'f', -1, 64)
+	case nil:
+		return ""
+	case []interface{}:
+		data, _ := json.Marshal(val)
+		return string(data)
+	default:
+		return fmt.Sprint(val)
+	}
+}
@@ -0,0 +1,169 @@
+package consul
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+
+	smsbase "github.com/go-baa/common/modules/sms/base"
+	"github.com/go-baa/setting"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestConfig(t *testing.T) {
+	Convey("测试加载和解析配置", t, func() {
+		f := newFakeConsul()
+		defer f.Close()
+		f.PutKV("config/app/feature/new_ui", "true\n")
+		f.PutKV("config/app/sms.json", `{"provider":"aliyun","retry":3,"templates":{"login":"SMS_1"},"signs":["a","b"]}`)
+		f.PutKV("config/app/cache.yaml", "ttl: 60\nredis:\n  addr: 127.0.0.1:6379\n")
+		f.PutKV("config/app/pay.ini", "; comment\nmode = test\n[wechat]\nappid = wx123\n")
+		f.PutKV("config/other/key", "x")
+
+		c, err := f.Client().NewConfig("config/app", ConfigOptions{})
+		So(err, ShouldBeNil)
+		defer c.Close()
+
+		So(c.MustBool("feature.new_ui", false), ShouldBeTrue)
+		So(c.MustString("sms.provider", ""), ShouldEqual, "aliyun")
+		So(c.MustInt("sms.retry", 0), ShouldEqual, 3)
+		So(c.MustString("sms.templates.login", ""), ShouldEqual, "SMS_1")
+		So(c.MustString("sms.signs", ""), ShouldEqual, `["a","b"]`)
+		So(c.MustInt64("cache.ttl", 0), ShouldEqual, 60)
+		So(c.MustString("cache.redis.addr", ""), ShouldEqual, "127.0.0.1:6379")
+		So(c.MustString("pay.mode", ""), ShouldEqual, "test")
+		So(c.MustString("pay.wechat.appid", ""), ShouldEqual, "wx123")
+		_, ok := c.Get("key")
+		So(ok, ShouldBeFalse)
+
+		v, _ := c.Get("sms.retry")
+		So(v, ShouldEqual, float64(3))
+
+		var sms struct {
+			Provider  string
+			Retry     int
+			Signs     []string
+			Templates map[string]string
+		}
+		So(c.Decode("sms", &sms), ShouldBeNil)
+		So(sms.Provider, ShouldEqual, "aliyun")
+		So(sms.Retry, ShouldEqual, 3)
+		So(sms.Signs, ShouldResemble, []string{"a", "b"})
+		So(sms.Templates["login"], ShouldEqual, "SMS_1")
+
+		setting.Config.Set("test.consul.fallback", "file")
+		So(c.MustString("test.consul.fallback", ""), ShouldEqual, "file")
+	})
+
+	Convey("测试热更新和写入 setting.Config", t, func() {
+		f := newFakeConsul()
+		defer f.Close()
+		setting.Config.Set("sms.provider", "file")
+		defer setting.Config.Remove("sms.provider")
+		f.PutKV("config/app/sms/provider", "aliyun")
+
+		c, err := f.Client().NewConfig("config/app/", ConfigOptions{SeedSetting: true})
+		So(err, ShouldBeNil)
+		defer c.Close()
+		So(setting.Config.MustString("sms.provider", ""), ShouldEqual, "aliyun")
+
+		var mu sync.Mutex
+		var changes []Change
+		c.OnChange("sms.", func(ch Change) {
+			mu.Lock()
+			changes = append(changes, ch)
+			mu.Unlock()
+		})
+		changed := func(n int) func() bool {
+			return func() bool {
+				mu.Lock()
+				defer mu.Unlock()
+				return len(changes) == n
+			}
+		}
+
+		f.PutKV("config/app/sms/provider", "tencent")
+		f.PutKV("config/app/feature", "on")
+		So(waitFor(changed(1)), ShouldBeTrue)
+		So(changes[0], ShouldResemble, Change{Key: "sms.provider", Old: "aliyun", New: "tencent"})
+		So(c.MustString("sms.provider", ""), ShouldEqual, "tencent")
+		So(waitFor(func() bool { return c.MustString("feature", "") == "on" }), ShouldBeTrue)
+
+		// 通过 Config 读取的代码能看到热更新的值
+		var settings smsbase.Settings = c
+		So(settings.MustString("sms.provider", ""), ShouldEqual, "tencent")
+
+		// 热更新不修改 setting.Config
+		So(setting.Config.MustString("sms.provider", ""), ShouldEqual, "aliyun")
+		So(setting.Config.MustString("feature", ""), ShouldEqual, "")
+
+		f.DeleteKV("config/app/sms/provider")
+		So(waitFor(changed(2)), ShouldBeTrue)
+		So(changes[1], ShouldResemble, Change{Key: "sms.provider", Old: "tencent", Deleted: true})
+		So(c.MustString("sms.provider", ""), ShouldEqual, "file")
+		So(setting.Config.MustString("sms.provider", ""), ShouldEqual, "aliyun")
+	})
+
+	Convey("测试热更新时并发读取 setting.Config", t, func() {
+		f := newFakeConsul()
+		defer f.Close()
+		f.PutKV("config/race/app/name", "v0")
+		defer setting.Config.Remove("app.name")
+
+		c, err := f.Client().NewConfig("config/race", ConfigOptions{SeedSetting: true})
+		So(err, ShouldBeNil)
+		defer c.Close()
+
+		stop := make(chan struct{})
+		var wg sync.WaitGroup
+		for i := 0; i < 4; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for {
+					select {
+					case <-stop:
+						return
+					default:
+						setting.Config.MustString("app.name", "")
+						c.MustString("app.name", "")
+					}
+				}
+			}()
+		}
+		for i := 1; i <= 20; i++ {
+			f.PutKV("config/race/app/name", "v"+strconv.Itoa(i))
+		}
+		So(waitFor(func() bool { return c.MustString("app.name", "") == "v20" }), ShouldBeTrue)
+		close(stop)
+		wg.Wait()
+		So(setting.Config.MustString("app.name", ""), ShouldEqual, "v0")
+	})
+
+	Convey("测试解析失败", t, func() {
+		f := newFakeConsul()
+		defer f.Close()
+		f.PutKV("config/bad/sms.json", "{")
+		f.PutKV("config/bad/app/name", "baa")
+
+		// 解析失败的 key 被跳过，不影响其他配置
+		c, err := f.Client().NewConfig("config/bad", ConfigOptions{})
+		So(err, ShouldBeNil)
+		defer c.Close()
+		So(c.MustString("app.name", ""), ShouldEqual, "baa")
+		_, ok := c.Get("sms.provider")
+		So(ok, ShouldBeFalse)
+
+		f.PutKV("config/bad/sms.json", `{"provider":"aliyun"}`)
+		So(waitFor(func() bool { return c.MustString("sms.provider", "") == "aliyun" }), ShouldBeTrue)
+
+		// 再次解析失败时保留上次的值，其他变化正常应用
+		f.PutKV("config/bad/sms.json", `{"provider":`)
+		f.PutKV("config/bad/app/name", "common")
+		So(waitFor(func() bool { return c.MustString("app.name", "") == "common" }), ShouldBeTrue)
+		So(c.MustString("sms.provider", ""), ShouldEqual, "aliyun")
+
+		f.PutKV("config/bad/sms.json", `{"provider":"tencent"}`)
+		So(waitFor(func() bool { return c.MustString("sms.provider", "") == "tencent" }), ShouldBeTrue)
+	})
+}
@@ -1,7 +1,12 @@
 // Package consul provider consul service discovery and health check
+//
+// Config 从 KV 前缀加载配置并热更新。setting.Config 不是并发安全的，运行中修改会和读取产生竞争，
+// 所以热更新的值只能通过 Config.Get* 和 Config.Must* 读取，SeedSetting 只在首次加载时写入 setting.Config。
+// 需要随热更新变化的配置要从 Config 读取，例如把 Config 设置为 sms/base.Config 后，短信的提供商和参数在每次发送时重新读取
 package consul
 
 import (
+	"context"
 	"fmt"
 	"math/rand"
 	"net"
@@ -17,6 +22,7 @@ import (
 type Consul struct {
 	client    *api.Client
 	nodeAddr  string // 当前的consul节点服务器
+	nodePort  string // consul节点的HTTP端口
 	localAddr string // 应用的本地IP地址
 }
 
@@ -40,68 +46,29 @@ func New(addrs ...string) (*Consul, error) {
 
 	// 得到去除端口号的地址
 	var nodeAddr string
+	nodePort := "8500"
 	splitPos := strings.IndexByte(addr, ':')
 	if splitPos > 0 {
 		nodeAddr = addr[:splitPos]
+		nodePort = addr[splitPos+1:]
 	} else {
 		nodeAddr = addr
 	}
 
-	return &Consul{client, nodeAddr, ""}, nil
+	return &Consul{client, nodeAddr, nodePort, ""}, nil
 }
 
 // ServiceRegisger register service and health check
+// 使用 30 秒的 TTL 检查，进程退出前一直保持注册，需要注销时使用 Register
 func (t *Consul) ServiceRegisger(id, name, addr, port string, tags []string) error {
-	if id == "" {
-		if id = os.Getenv("CSPHERE_CONTAINER_NAME"); id == "" {
-			id, _ = os.Hostname()
-			id = id + "." + name
-		}
-	}
-
-	if addr == "" {
-		addr = getIPAddress()
-	}
-
-	// 尝试查找上次注册的节点
-	client := t.client
-	nodeAddr := t.ServiceQueryNode(name, "", addr)
-	if nodeAddr != "" {
-		config := api.DefaultConfig()
-		config.Address = nodeAddr + ":8500"
-		newClient, err := api.NewClient(config)
-		if err == nil {
-			client = newClient
-		}
-	}
-
-	check := &api.AgentServiceCheck{
-		Status:                         "passing",
-		TTL:                            "30s",
-		DeregisterCriticalServiceAfter: "2h",
-	}
-	service := &api.AgentServiceRegistration{
+	_, err := t.Register(context.Background(), RegisterOptions{
 		ID:      id,
 		Name:    name,
-		Tags:    tags,
-		Port:    util.StringToInt(port),
 		Address: addr,
-		Check:   check,
-	}
-	err := client.Agent().ServiceRegister(service)
-	if err != nil {
-		return err
-	}
-
-	// begin health check notice
-	go func(client *api.Client, id string) {
-		for {
-			time.Sleep(time.Second * 10)
-			client.Agent().UpdateTTL(id, time.Now().Format(time.RFC1123Z), "pass")
-		}
-	}(client, "service:"+id)
-
-	return nil
+		Port:    util.StringToInt(port),
+		Tags:    tags,
+	})
+	return err
 }
 
 // ServiceQuery query a service and return a normal service addr
@@ -113,8 +80,7 @@ func (t *Consul) ServiceQuery(name, tag string) (string, error) {
 	if len(entris) == 0 {
 		return "", fmt.Errorf("consul.ServiceQuery: %v:%v none health node is available", name, tag)
 	}
-	rand.Seed(time.Now().Unix())
-	n := rand.Intn(len(entris))
+	n := randIntn(len(entris))
 	return entris[n].Service.Address + ":" + util.IntToString(entris[n].Service.Port), nil
 }
 
@@ -163,6 +129,28 @@ func (t *KV) Put(key string, val []byte) error {
 	return err
 }
 
+// PutIfIndex 仅在 key 的 ModifyIndex 等于 index 时写入，index 为 0 时仅在 key 不存在时写入
+// 返回是否写入成功，index 可以从 List 返回的 KVPair 中获取
+func (t *KV) PutIfIndex(key string, val []byte, index uint64) (bool, error) {
+	if len(key) == 0 {
+		return false, fmt.Errorf("consul.KV error: key [%s] is empty", key)
+	}
+	if key[0] == '/' {
+		key = key[1:]
+	}
+	ok, _, err := t.client.CAS(&api.KVPair{Key: key, Value: val, ModifyIndex: index}, nil)
+	return ok, err
+}
+
+// List 返回前缀下所有的 key，按 key 排序
+func (t *KV) List(prefix string) (api.KVPairs, error) {
+	if len(prefix) > 0 && prefix[0] == '/' {
+		prefix = prefix[1:]
+	}
+	pairs, _, err := t.client.List(prefix, nil)
+	return pairs, err
+}
+
 // Delete delete a key from kv
 func (t *KV) Delete(key string) error {
 	if len(key) == 0 {
@@ -0,0 +1,184 @@
+package consul
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-baa/log"
+	"github.com/hashicorp/consul/api"
+)
+
+const (
+	// DefaultLockTTL 锁的 session 默认 TTL，持有期间每隔 TTL/2 续期
+	DefaultLockTTL = 15 * time.Second
+	// DefaultLockDelay session 失效后其他实例获取锁前的默认等待时间
+	DefaultLockDelay = 15 * time.Second
+	// DefaultLockWaitTime 等待锁时每次阻塞查询的默认时间，也是取消等待的最大延迟
+	DefaultLockWaitTime = 15 * time.Second
+)
+
+// LockOptions 分布式锁配置
+type LockOptions struct {
+	TTL       time.Duration // session 的 TTL，默认 15 秒
+	LockDelay time.Duration // session 失效后锁的保护时间，默认 15 秒
+	WaitTime  time.Duration // 等待锁时每次阻塞查询的时间，默认 15 秒
+	Value     []byte        // 持有锁时写入 key 的值，例如实例 ID
+}
+
+// Lock 基于 session 的分布式锁
+//
+// session 失效、被运维删除或与 consul 通信失败时锁会丢失，持有锁的任务需要监听 Lost
+type Lock struct {
+	lock *api.Lock
+	key  string
+
+	mu   sync.Mutex
+	lost <-chan struct{}
+}
+
+// NewLock 创建 key 上的分布式锁，调用 Lock 获取
+func (t *Consul) NewLock(key string, options LockOptions) (*Lock, error) {
+	if options.TTL <= 0 {
+		options.TTL = DefaultLockTTL
+	}
+	if options.LockDelay <= 0 {
+		options.LockDelay = DefaultLockDelay
+	}
+	if options.WaitTime <= 0 {
+		options.WaitTime = DefaultLockWaitTime
+	}
+	l, err := t.client.LockOpts(&api.LockOptions{
+		Key:          key,
+		Value:        options.Value,
+		SessionName:  "lock:" + key,
+		SessionTTL:   options.TTL.String(),
+		LockDelay:    options.LockDelay,
+		LockWaitTime: options.WaitTime,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &Lock{lock: l, key: key}, nil
+}
+
+// Lock 使用默认配置获取 key 上的锁，阻塞到获取成功或 ctx 结束
+func (t *Consul) Lock(ctx context.Context, key string) (*Lock, error) {
+	l, err := t.NewLock(key, LockOptions{})
+	if err != nil {
+		return nil, err
+	}
+	if err = l.Lock(ctx); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// Lock 获取锁，阻塞到获取成功或 ctx 结束
+func (t *Lock) Lock(ctx context.Context) error {
+	lost, err := t.lock.Lock(ctx.Done())
+	if err != nil {
+		return fmt.Errorf("consul.Lock: %s %v", t.key, err)
+	}
+	if lost == nil {
+		return ctx.Err()
+	}
+	t.mu.Lock()
+	t.lost = lost
+	t.mu.Unlock()
+	return nil
+}
+
+// Lost 返回锁丢失时关闭的 channel，没有持有锁时返回 nil
+func (t *Lock) Lost() <-chan struct{} {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.lost
+}
+
+// Unlock 释放锁并删除 session
+func (t *Lock) Unlock() error {
+	t.mu.Lock()
+	t.lost = nil
+	t.mu.Unlock()
+	return t.lock.Unlock()
+}
+
+// LeaderElection 选主，只有持有锁的实例运行任务
+type LeaderElection struct {
+	consul  *Consul
+	key     string
+	options LockOptions
+	leader  int32
+}
+
+// NewLeaderElection 创建基于 key 的选主
+func (t *Consul) NewLeaderElection(key string, options LockOptions) *LeaderElection {
+	return &LeaderElection{consul: t, key: key, options: options}
+}
+
+// IsLeader 当前实例是否是主
+func (t *LeaderElection) IsLeader() bool {
+	return atomic.LoadInt32(&t.leader) == 1
+}
+
+// Run 持续竞选，成为主后调用 fn，失去主的身份时取消 fn 的 ctx 并等待 fn 返回
+// fn 应该一直运行到 ctx 取消，fn 返回后释放锁并重新竞选，ctx 结束时返回
+func (t *LeaderElection) Run(ctx context.Context, fn func(ctx context.Context)) error {
+	l, err := t.consul.NewLock(t.key, t.options)
+	if err != nil {
+		return err
+	}
+	retry := time.Second
+	for {
+		if err = l.Lock(ctx); err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			log.Errorf("consul.LeaderElection: %v, retry after %s\n", err, retry)
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-time.After(retry):
+			}
+			if retry *= 2; retry > maxRetryInterval {
+				retry = maxRetryInterval
+			}
+			continue
+		}
+		retry = time.Second
+		t.lead(ctx, l.Lost(), fn)
+		// 锁已经丢失时释放不会返回错误
+		if err = l.Unlock(); err != nil {
+			log.Errorf("consul.LeaderElection: unlock %s error: %v\n", t.key, err)
+		}
+		if ctx.Err() != nil {
+			return nil
+		}
+	}
+}
+
+// lead 以主的身份运行 fn，直到 fn 返回
+func (t *LeaderElection) lead(ctx context.Context, lost <-chan struct{}, fn func(ctx context.Context)) {
+	atomic.StoreInt32(&t.leader, 1)
+	defer atomic.StoreInt32(&t.leader, 0)
+
+	leaderCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		fn(leaderCtx)
+	}()
+	select {
+	case <-done:
+		return
+	case <-lost:
+		log.Warnf("consul.LeaderElection: lost leadership of %s\n", t.key)
+		cancel()
+	case <-ctx.Done():
+	}
+	<-done
+}
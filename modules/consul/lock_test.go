@@ -0,0 +1,121 @@
+package consul
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestLock(t *testing.T) {
+	Convey("测试分布式锁", t, func() {
+		f := newFakeConsul()
+		defer f.Close()
+		c := f.Client()
+
+		l1, err := c.Lock(context.Background(), "locks/job")
+		So(err, ShouldBeNil)
+		So(f.Holder("locks/job"), ShouldNotBeEmpty)
+
+		l2, err := c.NewLock("locks/job", LockOptions{WaitTime: 50 * time.Millisecond})
+		So(err, ShouldBeNil)
+		ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+		defer cancel()
+		So(errors.Is(l2.Lock(ctx), context.DeadlineExceeded), ShouldBeTrue)
+		So(l2.Lost(), ShouldBeNil)
+
+		So(l1.Unlock(), ShouldBeNil)
+		So(f.Holder("locks/job"), ShouldBeEmpty)
+		So(waitFor(func() bool { return f.Sessions() == 0 }), ShouldBeTrue)
+
+		So(l2.Lock(context.Background()), ShouldBeNil)
+		holder := f.Holder("locks/job")
+		So(holder, ShouldNotBeEmpty)
+
+		Convey("session 失效时锁丢失", func() {
+			f.InvalidateSession(holder)
+			select {
+			case <-l2.Lost():
+			case <-time.After(2 * time.Second):
+				So("lock is not lost", ShouldBeEmpty)
+			}
+		})
+	})
+
+	Convey("测试选主", t, func() {
+		f := newFakeConsul()
+		defer f.Close()
+		c := f.Client()
+
+		ctx, cancel := context.WithCancel(context.Background())
+		var running, terms int32
+		job := func(ctx context.Context) {
+			atomic.AddInt32(&running, 1)
+			atomic.AddInt32(&terms, 1)
+			<-ctx.Done()
+			atomic.AddInt32(&running, -1)
+		}
+		options := LockOptions{WaitTime: 50 * time.Millisecond}
+		e1 := c.NewLeaderElection("leader/cron", options)
+		e2 := c.NewLeaderElection("leader/cron", options)
+		errc := make(chan error, 2)
+		go func() { errc <- e1.Run(ctx, job) }()
+		go func() { errc <- e2.Run(ctx, job) }()
+
+		So(waitFor(func() bool { return atomic.LoadInt32(&terms) == 1 }), ShouldBeTrue)
+		time.Sleep(100 * time.Millisecond)
+		So(atomic.LoadInt32(&running), ShouldEqual, 1)
+		So(e1.IsLeader() != e2.IsLeader(), ShouldBeTrue)
+
+		// 失去主的身份后任务被取消，重新选出主
+		f.InvalidateSession(f.Holder("leader/cron"))
+		So(waitFor(func() bool {
+			return atomic.LoadInt32(&terms) == 2 && (e1.IsLeader() || e2.IsLeader())
+		}), ShouldBeTrue)
+		So(atomic.LoadInt32(&running), ShouldEqual, 1)
+
+		cancel()
+		So(<-errc, ShouldBeNil)
+		So(<-errc, ShouldBeNil)
+		So(atomic.LoadInt32(&running), ShouldEqual, 0)
+		So(e1.IsLeader() || e2.IsLeader(), ShouldBeFalse)
+	})
+
+	Convey("测试 KV 的 CAS 和 List", t, func() {
+		f := newFakeConsul()
+		defer f.Close()
+		kv := f.Client().KV()
+
+		ok, err := kv.PutIfIndex("/app/counter", []byte("1"), 0)
+		So(err, ShouldBeNil)
+		So(ok, ShouldBeTrue)
+		ok, err = kv.PutIfIndex("app/counter", []byte("1"), 0)
+		So(err, ShouldBeNil)
+		So(ok, ShouldBeFalse)
+
+		So(kv.Put("app/name", []byte("baa")), ShouldBeNil)
+		pairs, err := kv.List("/app/")
+		So(err, ShouldBeNil)
+		So(len(pairs), ShouldEqual, 2)
+		So(pairs[0].Key, ShouldEqual, "app/counter")
+		So(string(pairs[1].Value), ShouldEqual, "baa")
+
+		index := pairs[0].ModifyIndex
+		ok, err = kv.PutIfIndex("app/counter", []byte("2"), index)
+		So(err, ShouldBeNil)
+		So(ok, ShouldBeTrue)
+		ok, err = kv.PutIfIndex("app/counter", []byte("3"), index)
+		So(err, ShouldBeNil)
+		So(ok, ShouldBeFalse)
+		v, err := kv.Get("app/counter")
+		So(err, ShouldBeNil)
+		So(string(v), ShouldEqual, "2")
+
+		pairs, err = kv.List("none/")
+		So(err, ShouldBeNil)
+		So(pairs, ShouldBeEmpty)
+	})
+}
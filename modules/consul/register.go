@@ -0,0 +1,236 @@
+package consul
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/go-baa/log"
+	"github.com/hashicorp/consul/api"
+)
+
+// CheckType 健康检查的方式
+type CheckType int
+
+const (
+	// CheckTTL 由应用定时上报
+	CheckTTL CheckType = iota
+	// CheckHTTP consul 定时请求 HTTP 地址
+	CheckHTTP
+	// CheckTCP consul 定时连接 TCP 地址
+	CheckTCP
+	// CheckGRPC consul 定时调用 gRPC 健康检查
+	CheckGRPC
+)
+
+const (
+	// DefaultCheckTTL TTL 检查的默认超时时间
+	DefaultCheckTTL = 30 * time.Second
+	// DefaultCheckInterval HTTP/TCP/gRPC 检查的默认间隔
+	DefaultCheckInterval = 10 * time.Second
+	// DefaultCheckTimeout HTTP/TCP/gRPC 检查的默认超时时间
+	DefaultCheckTimeout = 5 * time.Second
+	// DefaultDeregisterAfter 检查失败后自动注销的默认时间
+	DefaultDeregisterAfter = 2 * time.Hour
+	// DefaultSyncInterval 检查注册是否丢失的默认间隔
+	DefaultSyncInterval = 30 * time.Second
+)
+
+// RegisterOptions 服务注册配置
+type RegisterOptions struct {
+	ID      string // 服务 ID，默认为容器名或 主机名.服务名
+	Name    string
+	Address string // 服务地址，默认为本机 IP
+	Port    int
+	Tags    []string
+	Meta    map[string]string
+
+	Check           CheckType
+	CheckTarget     string        // HTTP 检查的 URL，TCP/gRPC 检查的地址，默认为 Address:Port，HTTP 默认为 http://Address:Port/health
+	TTL             time.Duration // TTL 检查的超时时间，每隔 TTL/3 上报一次，默认 30 秒
+	Interval        time.Duration // HTTP/TCP/gRPC 检查的间隔，默认 10 秒
+	Timeout         time.Duration // HTTP/TCP/gRPC 检查的超时时间，默认 5 秒
+	DeregisterAfter time.Duration // 检查失败后自动注销的时间，默认 2 小时
+	SyncInterval    time.Duration // 检查 agent 是否丢失注册的间隔，默认 30 秒
+
+	OnTTLError func(err error) // TTL 上报失败时调用
+}
+
+// Registration 已注册的服务，Deregister 或 ctx 结束时注销
+type Registration struct {
+	client  *api.Client
+	service *api.AgentServiceRegistration
+	checkID string
+	options RegisterOptions
+
+	cancel context.CancelFunc
+	done   chan struct{}
+	err    error
+}
+
+// Register 注册服务并在后台维持注册：上报 TTL，agent 重启丢失注册后重新注册
+func (t *Consul) Register(ctx context.Context, options RegisterOptions) (*Registration, error) {
+	if options.Name == "" {
+		return nil, fmt.Errorf("consul.Register: name is empty")
+	}
+	if options.ID == "" {
+		if options.ID = os.Getenv("CSPHERE_CONTAINER_NAME"); options.ID == "" {
+			hostname, _ := os.Hostname()
+			options.ID = hostname + "." + options.Name
+		}
+	}
+	if options.Address == "" {
+		options.Address = getIPAddress()
+	}
+	if options.TTL <= 0 {
+		options.TTL = DefaultCheckTTL
+	}
+	if options.Interval <= 0 {
+		options.Interval = DefaultCheckInterval
+	}
+	if options.Timeout <= 0 {
+		options.Timeout = DefaultCheckTimeout
+	}
+	if options.DeregisterAfter <= 0 {
+		options.DeregisterAfter = DefaultDeregisterAfter
+	}
+	if options.SyncInterval <= 0 {
+		options.SyncInterval = DefaultSyncInterval
+	}
+
+	check, err := newCheck(options)
+	if err != nil {
+		return nil, err
+	}
+	r := &Registration{
+		client:  t.client,
+		checkID: "service:" + options.ID,
+		options: options,
+		done:    make(chan struct{}),
+		service: &api.AgentServiceRegistration{
+			ID:      options.ID,
+			Name:    options.Name,
+			Tags:    options.Tags,
+			Port:    options.Port,
+			Address: options.Address,
+			Meta:    options.Meta,
+			Check:   check,
+		},
+	}
+
+	// 尝试查找上次注册的节点
+	if nodeAddr := t.ServiceQueryNode(options.Name, "", options.Address); nodeAddr != "" {
+		config := api.DefaultConfig()
+		config.Address = net.JoinHostPort(nodeAddr, t.nodePort)
+		if client, err := api.NewClient(config); err == nil {
+			r.client = client
+		}
+	}
+
+	if err := r.client.Agent().ServiceRegister(r.service); err != nil {
+		return nil, err
+	}
+	ctx, r.cancel = context.WithCancel(ctx)
+	go r.keepalive(ctx)
+	return r, nil
+}
+
+// newCheck 按检查方式生成健康检查配置
+func newCheck(options RegisterOptions) (*api.AgentServiceCheck, error) {
+	check := &api.AgentServiceCheck{
+		DeregisterCriticalServiceAfter: options.DeregisterAfter.String(),
+	}
+	target := options.CheckTarget
+	if target == "" {
+		target = net.JoinHostPort(options.Address, strconv.Itoa(options.Port))
+	}
+	switch options.Check {
+	case CheckTTL:
+		check.Status = api.HealthPassing
+		check.TTL = options.TTL.String()
+		return check, nil
+	case CheckHTTP:
+		if options.CheckTarget == "" {
+			target = "http://" + target + "/health"
+		}
+		check.HTTP = target
+	case CheckTCP:
+		check.TCP = target
+	case CheckGRPC:
+		check.GRPC = target
+	default:
+		return nil, fmt.Errorf("consul.Register: unknown check type %d", options.Check)
+	}
+	check.Interval = options.Interval.String()
+	check.Timeout = options.Timeout.String()
+	return check, nil
+}
+
+// ID 返回服务 ID
+func (t *Registration) ID() string {
+	return t.service.ID
+}
+
+// Deregister 停止维持注册并从 agent 注销服务
+func (t *Registration) Deregister() error {
+	t.cancel()
+	<-t.done
+	return t.err
+}
+
+// Done 返回注销后关闭的 channel
+func (t *Registration) Done() <-chan struct{} {
+	return t.done
+}
+
+// keepalive 定时上报 TTL 并检查注册是否丢失，ctx 结束时注销
+func (t *Registration) keepalive(ctx context.Context) {
+	defer close(t.done)
+
+	ttl := t.options.Check == CheckTTL
+	interval := t.options.SyncInterval
+	if ttl && t.options.TTL/3 < interval {
+		interval = t.options.TTL / 3
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	lastSync := time.Now()
+	for {
+		select {
+		case <-ctx.Done():
+			t.err = t.client.Agent().ServiceDeregister(t.service.ID)
+			return
+		case <-ticker.C:
+		}
+
+		var err error
+		if ttl {
+			err = t.client.Agent().UpdateTTL(t.checkID, time.Now().Format(time.RFC1123Z), api.HealthPassing)
+			if err != nil && t.options.OnTTLError != nil {
+				t.options.OnTTLError(err)
+			}
+		}
+		// TTL 上报失败或到了同步时间时，检查 agent 是否还有注册
+		if err != nil || time.Since(lastSync) >= t.options.SyncInterval {
+			lastSync = time.Now()
+			t.sync()
+		}
+	}
+}
+
+// sync agent 丢失注册时重新注册
+func (t *Registration) sync() {
+	_, _, err := t.client.Agent().Service(t.service.ID, nil)
+	var statusErr api.StatusError
+	if err == nil || !errors.As(err, &statusErr) || statusErr.Code != 404 {
+		return
+	}
+	log.Warnf("consul.Registration: service %s is lost, register again\n", t.service.ID)
+	if err = t.client.Agent().ServiceRegister(t.service); err != nil {
+		log.Errorf("consul.Registration: register %s error: %v\n", t.service.ID, err)
+	}
+}
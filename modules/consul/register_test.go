@@ -0,0 +1,95 @@
+package consul
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestRegister(t *testing.T) {
+	Convey("测试 TTL 检查的注册和注销", t, func() {
+		f := newFakeConsul()
+		defer f.Close()
+
+		var ttlErrors int32
+		r, err := f.Client().Register(context.Background(), RegisterOptions{
+			ID:         "api-1",
+			Name:       "api",
+			Address:    "10.0.0.2",
+			Port:       8080,
+			TTL:        150 * time.Millisecond,
+			OnTTLError: func(error) { atomic.AddInt32(&ttlErrors, 1) },
+		})
+		So(err, ShouldBeNil)
+		So(r.ID(), ShouldEqual, "api-1")
+		reg := f.Registered("api-1")
+		So(reg, ShouldNotBeNil)
+		So(reg.Check.TTL, ShouldEqual, "150ms")
+		So(reg.Check.DeregisterCriticalServiceAfter, ShouldEqual, "2h0m0s")
+
+		So(waitFor(func() bool { return f.count(f.ttlUpdates, "service:api-1") >= 2 }), ShouldBeTrue)
+
+		Convey("agent 丢失注册后重新注册", func() {
+			f.Restart()
+			So(waitFor(func() bool { return f.Registered("api-1") != nil }), ShouldBeTrue)
+			So(atomic.LoadInt32(&ttlErrors), ShouldBeGreaterThan, 0)
+		})
+
+		Convey("注销", func() {
+			So(r.Deregister(), ShouldBeNil)
+			So(f.Registered("api-1"), ShouldBeNil)
+			select {
+			case <-r.Done():
+			default:
+				So("not done", ShouldBeEmpty)
+			}
+		})
+	})
+
+	Convey("测试 ctx 结束时注销", t, func() {
+		f := newFakeConsul()
+		defer f.Close()
+
+		ctx, cancel := context.WithCancel(context.Background())
+		r, err := f.Client().Register(ctx, RegisterOptions{
+			ID:      "api-1",
+			Name:    "api",
+			Address: "10.0.0.2",
+			Port:    8080,
+			Check:   CheckHTTP,
+		})
+		So(err, ShouldBeNil)
+		reg := f.Registered("api-1")
+		So(reg.Check.HTTP, ShouldEqual, "http://10.0.0.2:8080/health")
+		So(reg.Check.Interval, ShouldEqual, "10s")
+		So(reg.Check.TTL, ShouldBeEmpty)
+
+		cancel()
+		<-r.Done()
+		So(f.Registered("api-1"), ShouldBeNil)
+	})
+
+	Convey("测试检查方式", t, func() {
+		check, err := newCheck(RegisterOptions{Address: "10.0.0.2", Port: 9090, Check: CheckGRPC, Interval: time.Second, Timeout: time.Second})
+		So(err, ShouldBeNil)
+		So(check.GRPC, ShouldEqual, "10.0.0.2:9090")
+		check, err = newCheck(RegisterOptions{Check: CheckTCP, CheckTarget: "10.0.0.3:3306"})
+		So(err, ShouldBeNil)
+		So(check.TCP, ShouldEqual, "10.0.0.3:3306")
+		_, err = newCheck(RegisterOptions{Check: CheckType(10)})
+		So(err, ShouldNotBeNil)
+	})
+
+	Convey("测试兼容的 ServiceRegisger", t, func() {
+		f := newFakeConsul()
+		defer f.Close()
+		So(f.Client().ServiceRegisger("api-1", "api", "10.0.0.2", "8080", []string{"v1"}), ShouldBeNil)
+		reg := f.Registered("api-1")
+		So(reg.Port, ShouldEqual, 8080)
+		So(reg.Tags, ShouldResemble, []string{"v1"})
+		So(reg.Check.TTL, ShouldEqual, "30s")
+	})
+}
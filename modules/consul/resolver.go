@@ -0,0 +1,267 @@
+package consul
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"net"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-baa/log"
+	"github.com/hashicorp/consul/api"
+)
+
+// Strategy 负载均衡策略
+type Strategy int
+
+const (
+	// RoundRobin 轮询
+	RoundRobin Strategy = iota
+	// Random 随机
+	Random
+	// Weighted 按实例的 Weights.Passing 加权随机
+	Weighted
+)
+
+const (
+	// DefaultWaitTime 阻塞查询的默认等待时间
+	DefaultWaitTime = 5 * time.Minute
+	// DefaultFailTimeout 实例报告失败后默认跳过的时间
+	DefaultFailTimeout = 30 * time.Second
+	// maxRetryInterval 查询失败时重试的最大间隔
+	maxRetryInterval = 30 * time.Second
+)
+
+// rnd 包内共享的随机数生成器，避免每次调用重新设置种子
+var rnd = struct {
+	sync.Mutex
+	*rand.Rand
+}{Rand: rand.New(rand.NewSource(time.Now().UnixNano()))}
+
+func randIntn(n int) int {
+	rnd.Lock()
+	defer rnd.Unlock()
+	return rnd.Intn(n)
+}
+
+// Instance 服务实例
+type Instance struct {
+	ID      string
+	Address string
+	Port    int
+	Tags    []string
+	Weight  int
+}
+
+// Addr 返回 host:port
+func (t *Instance) Addr() string {
+	return net.JoinHostPort(t.Address, strconv.Itoa(t.Port))
+}
+
+// ResolverOptions 服务解析配置
+type ResolverOptions struct {
+	Strategy    Strategy      // 负载均衡策略，默认轮询
+	WaitTime    time.Duration // 阻塞查询的等待时间，默认 5 分钟
+	FailTimeout time.Duration // 实例报告失败后跳过的时间，默认 30 秒
+}
+
+// Resolver 在本地缓存服务的健康实例，通过阻塞查询更新，按策略选择实例
+type Resolver struct {
+	client  *api.Client
+	name    string
+	tag     string
+	options ResolverOptions
+
+	mu        sync.RWMutex
+	instances []*Instance
+	failed    map[string]time.Time // 实例地址 => 报告失败的时间
+	index     uint64
+	next      uint32
+
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// NewResolver 创建服务解析，首次查询失败时返回错误，之后在后台持续更新实例
+func (t *Consul) NewResolver(name, tag string, options ResolverOptions) (*Resolver, error) {
+	if options.WaitTime <= 0 {
+		options.WaitTime = DefaultWaitTime
+	}
+	if options.FailTimeout <= 0 {
+		options.FailTimeout = DefaultFailTimeout
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	r := &Resolver{
+		client:  t.client,
+		name:    name,
+		tag:     tag,
+		options: options,
+		failed:  make(map[string]time.Time),
+		cancel:  cancel,
+		done:    make(chan struct{}),
+	}
+	if err := r.update(ctx); err != nil {
+		cancel()
+		return nil, err
+	}
+	go r.watch(ctx)
+	return r, nil
+}
+
+// Resolve 选择一个健康实例并返回 host:port
+func (t *Resolver) Resolve() (string, error) {
+	inst, err := t.Pick()
+	if err != nil {
+		return "", err
+	}
+	return inst.Addr(), nil
+}
+
+// Pick 按策略选择一个健康实例，跳过最近报告失败的实例，全部失败时从所有实例中选择
+func (t *Resolver) Pick() (*Instance, error) {
+	t.mu.RLock()
+	all := t.instances
+	var instances []*Instance
+	now := time.Now()
+	for _, inst := range all {
+		if at, ok := t.failed[inst.Addr()]; ok && now.Sub(at) < t.options.FailTimeout {
+			continue
+		}
+		instances = append(instances, inst)
+	}
+	t.mu.RUnlock()
+
+	if len(instances) == 0 {
+		instances = all
+	}
+	if len(instances) == 0 {
+		return nil, fmt.Errorf("consul.Resolver: %v:%v none health node is available", t.name, t.tag)
+	}
+
+	switch t.options.Strategy {
+	case Random:
+		return instances[randIntn(len(instances))], nil
+	case Weighted:
+		total := 0
+		for _, inst := range instances {
+			total += inst.Weight
+		}
+		n := randIntn(total)
+		for _, inst := range instances {
+			if n -= inst.Weight; n < 0 {
+				return inst, nil
+			}
+		}
+		return instances[len(instances)-1], nil
+	default:
+		n := atomic.AddUint32(&t.next, 1) - 1
+		return instances[int(n%uint32(len(instances)))], nil
+	}
+}
+
+// Fail 报告实例调用失败，在 FailTimeout 内不再选择该实例
+func (t *Resolver) Fail(addr string) {
+	t.mu.Lock()
+	t.failed[addr] = time.Now()
+	t.mu.Unlock()
+}
+
+// Instances 返回当前缓存的健康实例
+func (t *Resolver) Instances() []*Instance {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	instances := make([]*Instance, len(t.instances))
+	copy(instances, t.instances)
+	return instances
+}
+
+// Close 停止更新实例
+func (t *Resolver) Close() {
+	t.cancel()
+	<-t.done
+}
+
+// watch 持续阻塞查询服务的健康实例，直到 Close
+func (t *Resolver) watch(ctx context.Context) {
+	defer close(t.done)
+	watchLoop(ctx, "service "+t.name, t.update)
+}
+
+// watchLoop 循环执行阻塞查询，失败时按指数退避重试，直到 ctx 结束
+func watchLoop(ctx context.Context, name string, update func(ctx context.Context) error) {
+	retry := time.Second
+	for {
+		err := update(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		if err == nil {
+			retry = time.Second
+			continue
+		}
+		log.Errorf("consul: watch %s error: %v, retry after %s\n", name, err, retry)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(retry):
+		}
+		if retry *= 2; retry > maxRetryInterval {
+			retry = maxRetryInterval
+		}
+	}
+}
+
+// update 以上次的 index 执行一次阻塞查询，结果变化时更新实例
+func (t *Resolver) update(ctx context.Context) error {
+	t.mu.RLock()
+	index := t.index
+	t.mu.RUnlock()
+
+	q := &api.QueryOptions{WaitIndex: index, WaitTime: t.options.WaitTime}
+	entries, meta, err := t.client.Health().Service(t.name, t.tag, true, q.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	// index 变小说明 consul 的状态被重置，下次重新开始查询
+	if meta.LastIndex < index {
+		t.index = 0
+		return nil
+	}
+	if meta.LastIndex == index && index > 0 {
+		return nil
+	}
+	t.index = meta.LastIndex
+
+	instances := make([]*Instance, 0, len(entries))
+	alive := make(map[string]bool, len(entries))
+	for _, entry := range entries {
+		inst := &Instance{
+			ID:      entry.Service.ID,
+			Address: entry.Service.Address,
+			Port:    entry.Service.Port,
+			Tags:    entry.Service.Tags,
+			Weight:  entry.Service.Weights.Passing,
+		}
+		if inst.Address == "" && entry.Node != nil {
+			inst.Address = entry.Node.Address
+		}
+		if inst.Weight <= 0 {
+			inst.Weight = 1
+		}
+		instances = append(instances, inst)
+		alive[inst.Addr()] = true
+	}
+	t.instances = instances
+	for addr := range t.failed {
+		if !alive[addr] {
+			delete(t.failed, addr)
+		}
+	}
+	return nil
+}
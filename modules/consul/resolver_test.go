@@ -0,0 +1,108 @@
+package consul
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func waitFor(cond func() bool) bool {
+	for i := 0; i < 200; i++ {
+		if cond() {
+			return true
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return false
+}
+
+func TestResolver(t *testing.T) {
+	Convey("测试轮询和失败跳过", t, func() {
+		f := newFakeConsul()
+		defer f.Close()
+		f.SetService("api", "a@10.0.0.2:80", "b@10.0.0.3:80", "c@10.0.0.4:80")
+
+		r, err := f.Client().NewResolver("api", "", ResolverOptions{FailTimeout: 100 * time.Millisecond})
+		So(err, ShouldBeNil)
+		defer r.Close()
+		So(len(r.Instances()), ShouldEqual, 3)
+
+		var addrs []string
+		for i := 0; i < 4; i++ {
+			addr, err := r.Resolve()
+			So(err, ShouldBeNil)
+			addrs = append(addrs, addr)
+		}
+		So(addrs, ShouldResemble, []string{"10.0.0.2:80", "10.0.0.3:80", "10.0.0.4:80", "10.0.0.2:80"})
+
+		r.Fail("10.0.0.3:80")
+		for i := 0; i < 6; i++ {
+			addr, _ := r.Resolve()
+			So(addr, ShouldNotEqual, "10.0.0.3:80")
+		}
+		So(waitFor(func() bool {
+			addr, _ := r.Resolve()
+			return addr == "10.0.0.3:80"
+		}), ShouldBeTrue)
+
+		Convey("所有实例失败时仍然返回实例", func() {
+			r.Fail("10.0.0.2:80")
+			r.Fail("10.0.0.3:80")
+			r.Fail("10.0.0.4:80")
+			_, err := r.Resolve()
+			So(err, ShouldBeNil)
+		})
+	})
+
+	Convey("测试阻塞查询更新实例", t, func() {
+		f := newFakeConsul()
+		defer f.Close()
+		f.SetService("api", "a@10.0.0.2:80")
+
+		r, err := f.Client().NewResolver("api", "", ResolverOptions{Strategy: Random})
+		So(err, ShouldBeNil)
+		defer r.Close()
+
+		// 等待后台的阻塞查询开始，没有变化时不会重复请求
+		So(waitFor(func() bool { return f.Requests() == 2 }), ShouldBeTrue)
+		time.Sleep(50 * time.Millisecond)
+		So(f.Requests(), ShouldEqual, 2)
+
+		f.SetService("api", "a@10.0.0.2:80", "b@10.0.0.3:80")
+		So(waitFor(func() bool { return len(r.Instances()) == 2 }), ShouldBeTrue)
+
+		f.SetService("api")
+		So(waitFor(func() bool { return len(r.Instances()) == 0 }), ShouldBeTrue)
+		_, err = r.Resolve()
+		So(err, ShouldNotBeNil)
+	})
+
+	Convey("测试加权随机", t, func() {
+		f := newFakeConsul()
+		defer f.Close()
+		f.SetService("api", "a@10.0.0.2:80#1", "b@10.0.0.3:80#9", "c@:80")
+
+		r, err := f.Client().NewResolver("api", "", ResolverOptions{Strategy: Weighted})
+		So(err, ShouldBeNil)
+		defer r.Close()
+		So(r.Instances()[2].Address, ShouldEqual, "10.0.0.1")
+		So(r.Instances()[2].Weight, ShouldEqual, 1)
+
+		counts := make(map[string]int)
+		for i := 0; i < 1100; i++ {
+			addr, _ := r.Resolve()
+			counts[addr]++
+		}
+		So(counts["10.0.0.3:80"], ShouldBeGreaterThan, counts["10.0.0.2:80"]*4)
+		So(counts["10.0.0.3:80"], ShouldBeGreaterThan, counts["10.0.0.1:80"]*4)
+	})
+
+	Convey("测试首次查询失败", t, func() {
+		f := newFakeConsul()
+		c := f.Client()
+		f.Close()
+		_, err := c.NewResolver("api", "", ResolverOptions{})
+		So(err, ShouldNotBeNil)
+	})
+}
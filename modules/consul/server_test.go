@@ -0,0 +1,373 @@
+package consul
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/consul/api"
+)
+
+// fakeConsul 测试用的 consul HTTP API，支持阻塞查询
+type fakeConsul struct {
+	server *httptest.Server
+
+	mu       sync.Mutex
+	index    uint64
+	changed  chan struct{}                  // index 变化时关闭
+	services map[string][]*api.ServiceEntry // 服务名 => 健康实例
+	requests int
+
+	registered map[string]*api.AgentServiceRegistration // agent 上注册的服务
+	registers  int                                      // 注册次数
+	ttlUpdates map[string]int                           // check ID => TTL 上报次数
+	failTTL    bool                                     // TTL 上报时返回错误
+
+	kv       map[string]*api.KVPair
+	sessions map[string]*api.SessionEntry
+	nextID   int
+}
+
+func newFakeConsul() *fakeConsul {
+	f := &fakeConsul{
+		index:    1,
+		changed:  make(chan struct{}),
+		services: make(map[string][]*api.ServiceEntry),
+
+		registered: make(map[string]*api.AgentServiceRegistration),
+		ttlUpdates: make(map[string]int),
+		kv:         make(map[string]*api.KVPair),
+		sessions:   make(map[string]*api.SessionEntry),
+	}
+	f.server = httptest.NewServer(http.HandlerFunc(f.handle))
+	return f
+}
+
+// Addr 返回 host:port
+func (f *fakeConsul) Addr() string {
+	return strings.TrimPrefix(f.server.URL, "http://")
+}
+
+// Close 关闭服务
+func (f *fakeConsul) Close() {
+	f.server.CloseClientConnections()
+	f.server.Close()
+}
+
+// Client 返回连接到该服务的 Consul
+func (f *fakeConsul) Client() *Consul {
+	c, err := New(f.Addr())
+	if err != nil {
+		panic(err)
+	}
+	return c
+}
+
+// bump 增加 index，唤醒阻塞的查询，调用时需要持有锁
+func (f *fakeConsul) bump() {
+	f.index++
+	close(f.changed)
+	f.changed = make(chan struct{})
+}
+
+// SetService 设置服务的健康实例，实例为 "id@host:port" 或 "id@host:port#weight"
+func (f *fakeConsul) SetService(name string, instances ...string) {
+	entries := make([]*api.ServiceEntry, 0, len(instances))
+	for _, s := range instances {
+		weight := 0
+		if i := strings.IndexByte(s, '#'); i > 0 {
+			weight, _ = strconv.Atoi(s[i+1:])
+			s = s[:i]
+		}
+		id, addr := s, s
+		if i := strings.IndexByte(s, '@'); i > 0 {
+			id, addr = s[:i], s[i+1:]
+		}
+		host, port := addr, 0
+		if i := strings.LastIndexByte(addr, ':'); i >= 0 {
+			host = addr[:i]
+			port, _ = strconv.Atoi(addr[i+1:])
+		}
+		entries = append(entries, &api.ServiceEntry{
+			Node: &api.Node{Node: "node", Address: "10.0.0.1"},
+			Service: &api.AgentService{
+				ID:      id,
+				Service: name,
+				Address: host,
+				Port:    port,
+				Weights: api.AgentWeights{Passing: weight, Warning: 1},
+			},
+		})
+	}
+	f.mu.Lock()
+	f.services[name] = entries
+	f.bump()
+	f.mu.Unlock()
+}
+
+// Requests 返回收到的请求数
+func (f *fakeConsul) Requests() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.requests
+}
+
+// wait 按阻塞查询的参数等待 index 变化
+func (f *fakeConsul) wait(r *http.Request) {
+	index, _ := strconv.ParseUint(r.URL.Query().Get("index"), 10, 64)
+	wait, err := time.ParseDuration(r.URL.Query().Get("wait"))
+	if err != nil || wait <= 0 {
+		wait = 5 * time.Minute
+	}
+	f.mu.Lock()
+	current, changed := f.index, f.changed
+	f.mu.Unlock()
+	if index == 0 || index < current {
+		return
+	}
+	select {
+	case <-changed:
+	case <-time.After(wait):
+	case <-r.Context().Done():
+	}
+}
+
+func (f *fakeConsul) handle(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	f.requests++
+	f.mu.Unlock()
+
+	path := r.URL.Path
+	switch {
+	case strings.HasPrefix(path, "/v1/health/service/"):
+		f.wait(r)
+		f.mu.Lock()
+		entries := f.services[strings.TrimPrefix(path, "/v1/health/service/")]
+		f.reply(w, entries)
+		f.mu.Unlock()
+	case strings.HasPrefix(path, "/v1/kv/"):
+		f.handleKV(w, r, strings.TrimPrefix(path, "/v1/kv/"))
+	case strings.HasPrefix(path, "/v1/session/"):
+		f.handleSession(w, r, strings.TrimPrefix(path, "/v1/session/"))
+	case strings.HasPrefix(path, "/v1/catalog/service/"):
+		f.mu.Lock()
+		f.reply(w, []*api.CatalogService{})
+		f.mu.Unlock()
+	case path == "/v1/agent/service/register":
+		reg := new(api.AgentServiceRegistration)
+		if err := json.NewDecoder(r.Body).Decode(reg); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		f.mu.Lock()
+		f.registered[reg.ID] = reg
+		f.registers++
+		f.mu.Unlock()
+	case strings.HasPrefix(path, "/v1/agent/service/deregister/"):
+		f.mu.Lock()
+		delete(f.registered, strings.TrimPrefix(path, "/v1/agent/service/deregister/"))
+		f.mu.Unlock()
+	case strings.HasPrefix(path, "/v1/agent/service/"):
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		reg, ok := f.registered[strings.TrimPrefix(path, "/v1/agent/service/")]
+		if !ok {
+			http.Error(w, "unknown service", http.StatusNotFound)
+			return
+		}
+		f.reply(w, &api.AgentService{ID: reg.ID, Service: reg.Name, Address: reg.Address, Port: reg.Port})
+	case strings.HasPrefix(path, "/v1/agent/check/update/"):
+		id := strings.TrimPrefix(path, "/v1/agent/check/update/")
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		if _, ok := f.registered[strings.TrimPrefix(id, "service:")]; !ok || f.failTTL {
+			http.Error(w, "unknown check", http.StatusInternalServerError)
+			return
+		}
+		f.ttlUpdates[id]++
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// Registered 返回 agent 上注册的服务
+func (f *fakeConsul) Registered(id string) *api.AgentServiceRegistration {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.registered[id]
+}
+
+// Restart 模拟 agent 重启，丢失所有注册的服务
+func (f *fakeConsul) Restart() {
+	f.mu.Lock()
+	f.registered = make(map[string]*api.AgentServiceRegistration)
+	f.mu.Unlock()
+}
+
+// reply 返回 JSON 和当前的 index，调用时需要持有锁
+func (f *fakeConsul) reply(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("X-Consul-Index", strconv.FormatUint(f.index, 10))
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+func (f *fakeConsul) count(m map[string]int, key string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return m[key]
+}
+
+// PutKV 设置 KV 的值
+func (f *fakeConsul) PutKV(key, value string) {
+	f.mu.Lock()
+	f.bump()
+	f.kv[key] = &api.KVPair{Key: key, Value: []byte(value), CreateIndex: f.index, ModifyIndex: f.index}
+	f.mu.Unlock()
+}
+
+// DeleteKV 删除 KV 的值
+func (f *fakeConsul) DeleteKV(key string) {
+	f.mu.Lock()
+	delete(f.kv, key)
+	f.bump()
+	f.mu.Unlock()
+}
+
+func (f *fakeConsul) handleKV(w http.ResponseWriter, r *http.Request, key string) {
+	switch r.Method {
+	case "GET":
+		f.wait(r)
+		_, recurse := r.URL.Query()["recurse"]
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		var pairs []*api.KVPair
+		for k, pair := range f.kv {
+			if k == key || (recurse && strings.HasPrefix(k, key)) {
+				pairs = append(pairs, pair)
+			}
+		}
+		if len(pairs) == 0 {
+			w.Header().Set("X-Consul-Index", strconv.FormatUint(f.index, 10))
+			http.NotFound(w, r)
+			return
+		}
+		sort.Slice(pairs, func(i, j int) bool { return pairs[i].Key < pairs[j].Key })
+		f.reply(w, pairs)
+	case "PUT":
+		value, _ := io.ReadAll(r.Body)
+		q := r.URL.Query()
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		old := f.kv[key]
+		pair := &api.KVPair{Key: key, Value: value}
+		if old != nil {
+			pair.CreateIndex, pair.LockIndex, pair.Session = old.CreateIndex, old.LockIndex, old.Session
+		}
+		pair.Flags, _ = strconv.ParseUint(q.Get("flags"), 10, 64)
+		if cas := q.Get("cas"); cas != "" {
+			index, _ := strconv.ParseUint(cas, 10, 64)
+			if (index == 0 && old != nil) || (index > 0 && (old == nil || old.ModifyIndex != index)) {
+				f.reply(w, false)
+				return
+			}
+		}
+		if session := q.Get("acquire"); session != "" {
+			if _, ok := f.sessions[session]; !ok || (old != nil && old.Session != "" && old.Session != session) {
+				f.reply(w, false)
+				return
+			}
+			if pair.Session != session {
+				pair.LockIndex++
+			}
+			pair.Session = session
+		}
+		if session := q.Get("release"); session != "" {
+			if old == nil || old.Session != session {
+				f.reply(w, false)
+				return
+			}
+			pair.Session = ""
+		}
+		f.bump()
+		pair.ModifyIndex = f.index
+		if pair.CreateIndex == 0 {
+			pair.CreateIndex = f.index
+		}
+		f.kv[key] = pair
+		f.reply(w, true)
+	case "DELETE":
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		delete(f.kv, key)
+		f.bump()
+		f.reply(w, true)
+	}
+}
+
+func (f *fakeConsul) handleSession(w http.ResponseWriter, r *http.Request, path string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	switch {
+	case path == "create":
+		entry := new(api.SessionEntry)
+		json.NewDecoder(r.Body).Decode(entry)
+		f.nextID++
+		entry.ID = "session-" + strconv.Itoa(f.nextID)
+		f.sessions[entry.ID] = entry
+		f.reply(w, map[string]string{"ID": entry.ID})
+	case strings.HasPrefix(path, "renew/"):
+		entry, ok := f.sessions[strings.TrimPrefix(path, "renew/")]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		f.reply(w, []*api.SessionEntry{entry})
+	case strings.HasPrefix(path, "destroy/"):
+		f.destroySession(strings.TrimPrefix(path, "destroy/"))
+		f.reply(w, true)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// destroySession 删除 session 并释放其持有的锁，调用时需要持有锁
+func (f *fakeConsul) destroySession(id string) {
+	delete(f.sessions, id)
+	f.bump()
+	for _, pair := range f.kv {
+		if pair.Session == id {
+			pair.Session = ""
+			pair.ModifyIndex = f.index
+		}
+	}
+}
+
+// Sessions 返回当前的 session 数
+func (f *fakeConsul) Sessions() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.sessions)
+}
+
+// Holder 返回持有 key 上的锁的 session
+func (f *fakeConsul) Holder(key string) string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if pair, ok := f.kv[key]; ok {
+		return pair.Session
+	}
+	return ""
+}
+
+// InvalidateSession 模拟 session 失效，例如 TTL 过期
+func (f *fakeConsul) InvalidateSession(id string) {
+	f.mu.Lock()
+	f.destroySession(id)
+	f.mu.Unlock()
+}
@@ -0,0 +1,153 @@
+// Package cursor 游标分页的游标编码，游标记录上一页最后一条记录的排序字段值，并使用 HMAC 签名防止篡改
+package cursor
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-baa/setting"
+)
+
+// ErrInvalid 游标格式错误或签名不正确
+var ErrInvalid = errors.New("cursor: invalid cursor")
+
+// value 游标中的一个值，T 记录值的类型以便还原
+type value struct {
+	T string          `json:"t"`
+	V json.RawMessage `json:"v"`
+}
+
+var secret struct {
+	sync.Once
+	key []byte
+}
+
+// SetSecret 设置签名密钥，默认使用 cursor.secret 配置
+// 没有配置时使用进程启动时随机生成的密钥，重启后之前的游标会失效
+func SetSecret(key string) {
+	secret.Do(func() {})
+	secret.key = []byte(key)
+}
+
+func secretKey() []byte {
+	secret.Do(func() {
+		if key := setting.Config.MustString("cursor.secret", ""); key != "" {
+			secret.key = []byte(key)
+			return
+		}
+		secret.key = make([]byte, 32)
+		rand.Read(secret.key)
+	})
+	return secret.key
+}
+
+// Encode 编码排序字段的值，支持整数、浮点数、字符串、布尔值和 time.Time
+func Encode(values ...interface{}) (string, error) {
+	vs := make([]value, len(values))
+	for i, v := range values {
+		var t string
+		switch x := v.(type) {
+		case int, int8, int16, int32, int64:
+			t = "i"
+		case uint, uint8, uint16, uint32, uint64:
+			t = "u"
+		case float32, float64:
+			t = "f"
+		case string:
+			t = "s"
+		case bool:
+			t = "b"
+		case time.Time:
+			t, v = "t", x.Format(time.RFC3339Nano)
+		case *time.Time:
+			if x == nil {
+				return "", fmt.Errorf("cursor: nil value")
+			}
+			t, v = "t", x.Format(time.RFC3339Nano)
+		default:
+			return "", fmt.Errorf("cursor: unsupported value type %T", v)
+		}
+		b, err := json.Marshal(v)
+		if err != nil {
+			return "", err
+		}
+		vs[i] = value{T: t, V: b}
+	}
+	body, err := json.Marshal(vs)
+	if err != nil {
+		return "", err
+	}
+	payload := base64.RawURLEncoding.EncodeToString(body)
+	return payload + "." + sign(payload), nil
+}
+
+// Decode 校验签名并还原排序字段的值，空字符串返回 nil 表示第一页
+func Decode(token string) ([]interface{}, error) {
+	if token == "" {
+		return nil, nil
+	}
+	i := strings.LastIndexByte(token, '.')
+	if i < 0 || !hmac.Equal([]byte(token[i+1:]), []byte(sign(token[:i]))) {
+		return nil, ErrInvalid
+	}
+	body, err := base64.RawURLEncoding.DecodeString(token[:i])
+	if err != nil {
+		return nil, ErrInvalid
+	}
+	var vs []value
+	if err = json.Unmarshal(body, &vs); err != nil || len(vs) == 0 {
+		return nil, ErrInvalid
+	}
+
+	values := make([]interface{}, len(vs))
+	for i, v := range vs {
+		switch v.T {
+		case "i":
+			var x int64
+			err = json.Unmarshal(v.V, &x)
+			values[i] = x
+		case "u":
+			var x uint64
+			err = json.Unmarshal(v.V, &x)
+			values[i] = x
+		case "f":
+			var x float64
+			err = json.Unmarshal(v.V, &x)
+			values[i] = x
+		case "s":
+			var x string
+			err = json.Unmarshal(v.V, &x)
+			values[i] = x
+		case "b":
+			var x bool
+			err = json.Unmarshal(v.V, &x)
+			values[i] = x
+		case "t":
+			var x string
+			if err = json.Unmarshal(v.V, &x); err == nil {
+				values[i], err = time.Parse(time.RFC3339Nano, x)
+			}
+		default:
+			err = ErrInvalid
+		}
+		if err != nil {
+			return nil, ErrInvalid
+		}
+	}
+	return values, nil
+}
+
+// sign 计算签名
+func sign(payload string) string {
+	h := hmac.New(sha256.New, secretKey())
+	h.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(h.Sum(nil)[:16])
+}
@@ -0,0 +1,42 @@
+package cursor
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestCursor(t *testing.T) {
+	SetSecret("test")
+
+	Convey("测试编码和解码", t, func() {
+		now := time.Date(2020, 1, 2, 3, 4, 5, 6, time.UTC)
+		token, err := Encode(int64(1)<<60, "a", now, 1.5, true, uint(3))
+		So(err, ShouldBeNil)
+
+		values, err := Decode(token)
+		So(err, ShouldBeNil)
+		So(values[0], ShouldEqual, int64(1)<<60)
+		So(values[1], ShouldEqual, "a")
+		So(values[2].(time.Time).Equal(now), ShouldBeTrue)
+		So(values[3], ShouldEqual, 1.5)
+		So(values[4], ShouldEqual, true)
+		So(values[5], ShouldEqual, uint64(3))
+
+		values, err = Decode("")
+		So(err, ShouldBeNil)
+		So(values, ShouldBeNil)
+	})
+
+	Convey("测试篡改的游标", t, func() {
+		token, _ := Encode(1)
+		_, err := Decode(token[1:])
+		So(err, ShouldEqual, ErrInvalid)
+		_, err = Decode("abc")
+		So(err, ShouldEqual, ErrInvalid)
+
+		_, err = Encode([]int{1})
+		So(err, ShouldNotBeNil)
+	})
+}
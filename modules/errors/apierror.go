@@ -1,24 +1,109 @@
 package errors
 
 import (
+	"bytes"
 	"fmt"
+	"runtime"
+
+	"github.com/go-baa/setting"
 )
 
+// maxStackDepth 调试模式下记录的调用栈深度
+const maxStackDepth = 32
+
 // APIError API错误结构
 type APIError struct {
-	Code    int    `json:"code"`
-	Message string `json:"message"`
+	Code    int                    `json:"code"`
+	Message string                 `json:"message"`
+	Details map[string]interface{} `json:"details,omitempty"`
+	cause   error
+	stack   []uintptr
 }
 
-// Error ...
+// Error 返回默认语言的错误信息，消息中的 {key} 会用 e.Details 替换
 func (e *APIError) Error() string {
-	return fmt.Sprintf("code: %d, message: %s", e.Code, e.Message)
+	if e.cause != nil {
+		return fmt.Sprintf("code: %d, message: %s, cause: %v", e.Code, e.render(e.Message), e.cause)
+	}
+	return fmt.Sprintf("code: %d, message: %s", e.Code, e.render(e.Message))
+}
+
+// Unwrap 返回被包装的原始错误
+func (e *APIError) Unwrap() error {
+	return e.cause
+}
+
+// Is 错误代码相同即认为是同一个错误，使包装后的错误可以用 errors.Is 与预定义的错误比较
+func (e *APIError) Is(target error) bool {
+	t, ok := target.(*APIError)
+	return ok && t.Code == e.Code
+}
+
+// Wrap 复制当前错误并包装原始错误 cause
+func (e *APIError) Wrap(cause error) *APIError {
+	n := e.clone()
+	n.cause = cause
+	return n
+}
+
+// WithDetails 复制当前错误并附加键值对形式的详细信息，如 WithDetails("field", "mobile")
+func (e *APIError) WithDetails(kv ...interface{}) *APIError {
+	n := e.clone()
+	n.Details = make(map[string]interface{}, len(e.Details)+len(kv)/2)
+	for k, v := range e.Details {
+		n.Details[k] = v
+	}
+	for i := 0; i+1 < len(kv); i += 2 {
+		n.Details[fmt.Sprint(kv[i])] = kv[i+1]
+	}
+	return n
+}
+
+// Stack 返回错误创建时的调用栈，仅在调试模式下记录
+func (e *APIError) Stack() string {
+	if len(e.stack) == 0 {
+		return ""
+	}
+	var buf bytes.Buffer
+	frames := runtime.CallersFrames(e.stack)
+	for {
+		frame, more := frames.Next()
+		fmt.Fprintf(&buf, "%s\n\t%s:%d\n", frame.Function, frame.File, frame.Line)
+		if !more {
+			break
+		}
+	}
+	return buf.String()
+}
+
+// clone 复制错误，预定义的错误是共享的，不能直接修改
+// 调试模式下记录调用栈，所有创建错误的函数都直接调用 clone，使 callers 跳过的层数相同
+func (e *APIError) clone() *APIError {
+	n := &APIError{
+		Code:    e.Code,
+		Message: e.Message,
+		Details: e.Details,
+		cause:   e.cause,
+	}
+	if setting.Debug {
+		n.stack = callers()
+	}
+	return n
 }
 
 // New 创建一个新的错误结构
 func New(code int, message string) *APIError {
-	return &APIError{
-		Code:    code,
-		Message: message,
-	}
+	return (&APIError{Code: code, Message: message}).clone()
+}
+
+// Wrap 使用错误代码和消息包装原始错误 cause
+func Wrap(cause error, code int, message string) *APIError {
+	return (&APIError{Code: code, Message: message, cause: cause}).clone()
+}
+
+// callers 记录调用栈，跳过 callers, clone 和创建错误的函数
+func callers() []uintptr {
+	pcs := make([]uintptr, maxStackDepth)
+	n := runtime.Callers(4, pcs)
+	return pcs[:n]
 }
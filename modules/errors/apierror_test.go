@@ -0,0 +1,102 @@
+package errors
+
+import (
+	stderrors "errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/go-baa/setting"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+var errTestNotFound = Define(9901, http.StatusNotFound, map[string]string{
+	"zh-CN": "订单 {id} 不存在",
+	"en":    "order {id} not found",
+	"ja-JP": "注文 {id} が見つかりません",
+})
+
+func TestWrap(t *testing.T) {
+	Convey("测试错误包装", t, func() {
+		cause := fmt.Errorf("record not found")
+		err := ErrUserNotExist.Wrap(cause)
+		So(err.Code, ShouldEqual, ErrUserNotExist.Code)
+		So(err.Unwrap(), ShouldEqual, cause)
+		So(ErrUserNotExist.Unwrap(), ShouldBeNil)
+		So(stderrors.Is(err, ErrUserNotExist), ShouldBeTrue)
+		So(stderrors.Is(err, cause), ShouldBeTrue)
+		So(stderrors.Is(err, ErrUserDisable), ShouldBeFalse)
+
+		wrapped := fmt.Errorf("load user: %w", err)
+		e, ok := As(wrapped)
+		So(ok, ShouldBeTrue)
+		So(e.Code, ShouldEqual, ErrUserNotExist.Code)
+		_, ok = As(cause)
+		So(ok, ShouldBeFalse)
+
+		err = Wrap(cause, 9000, "查询失败")
+		So(err.Error(), ShouldEqual, "code: 9000, message: 查询失败, cause: record not found")
+	})
+
+	Convey("测试详细信息", t, func() {
+		err := ErrUserNotExist.WithDetails("id", 1, "name")
+		So(err.Details, ShouldResemble, map[string]interface{}{"id": 1})
+		So(ErrUserNotExist.Details, ShouldBeNil)
+		err2 := err.WithDetails("mobile", "138")
+		So(len(err2.Details), ShouldEqual, 2)
+		So(len(err.Details), ShouldEqual, 1)
+	})
+
+	Convey("测试调试模式下的调用栈", t, func() {
+		debug := setting.Debug
+		defer func() { setting.Debug = debug }()
+		setting.Debug = true
+		So(ErrUserNotExist.Wrap(nil).Stack(), ShouldContainSubstring, "apierror_test.go")
+		So(ErrUserNotExist.WithDetails("id", 1).Stack(), ShouldContainSubstring, "apierror_test.go")
+		So(New(9000, "查询失败").Stack(), ShouldContainSubstring, "apierror_test.go")
+		So(Wrap(nil, 9000, "查询失败").Stack(), ShouldContainSubstring, "apierror_test.go")
+		for _, stack := range []string{
+			ErrUserNotExist.Wrap(nil).Stack(),
+			New(9000, "查询失败").Stack(),
+			Wrap(nil, 9000, "查询失败").Stack(),
+		} {
+			// 第一帧是调用者，不是 errors 包内部的函数
+			So(strings.SplitN(stack, "\n", 2)[0], ShouldStartWith, "github.com/go-baa/common/modules/errors.TestWrap")
+		}
+		setting.Debug = false
+		So(ErrUserNotExist.Wrap(nil).Stack(), ShouldEqual, "")
+		So(New(9000, "查询失败").Stack(), ShouldEqual, "")
+	})
+}
+
+func TestCatalog(t *testing.T) {
+	Convey("测试错误代码注册", t, func() {
+		So(Registered(9901), ShouldBeTrue)
+		So(Status(9901), ShouldEqual, http.StatusNotFound)
+		So(Status(ErrUserNeedLogin.Code), ShouldEqual, http.StatusUnauthorized)
+		So(Status(ErrUserDisable.Code), ShouldEqual, http.StatusOK)
+		So(errTestNotFound.Message, ShouldEqual, "订单 {id} 不存在")
+	})
+
+	Convey("测试多语言消息", t, func() {
+		err := errTestNotFound.WithDetails("id", 12)
+		So(err.Localize(""), ShouldEqual, "订单 12 不存在")
+		So(err.Localize("zh-CN,zh;q=0.9"), ShouldEqual, "订单 12 不存在")
+		So(err.Localize("en-US,en;q=0.9"), ShouldEqual, "order 12 not found")
+		So(err.Localize("fr;q=0.9, ja;q=0.8"), ShouldEqual, "注文 12 が見つかりません")
+		So(err.Localize("fr"), ShouldEqual, "订单 12 不存在")
+		So(err.Error(), ShouldEqual, "code: 9901, message: 订单 12 不存在")
+		So(errTestNotFound.Localize(""), ShouldEqual, "订单 {id} 不存在")
+		So(ErrUserDisable.Localize("en"), ShouldEqual, ErrUserDisable.Message)
+
+		// 自定义的消息不会被模板替换
+		custom := New(errTestNotFound.Code, "订单已被删除").WithDetails("id", 12)
+		So(custom.Localize("en"), ShouldEqual, "订单已被删除")
+		So(custom.Localize("ja"), ShouldEqual, "订单已被删除")
+	})
+
+	Convey("测试解析 Accept-Language", t, func() {
+		So(ParseAcceptLanguage("en;q=0.5, zh_CN, *;q=0.1, ja;q=0"), ShouldResemble, []string{"zh-cn", "en"})
+	})
+}
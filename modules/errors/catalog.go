@@ -0,0 +1,187 @@
+package errors
+
+import (
+	stderrors "errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefaultLocale 默认语言，APIError.Message 使用该语言
+const DefaultLocale = "zh-CN"
+
+// entry 错误代码的注册信息
+type entry struct {
+	status   int
+	messages map[string]string // 语言 => 消息模板
+}
+
+// catalog 已注册的错误代码
+var catalog = struct {
+	sync.RWMutex
+	entries map[int]*entry
+}{entries: make(map[int]*entry)}
+
+// Define 声明一个错误代码，指定默认的 HTTP 状态码和各语言的消息模板
+// 消息模板中的 {key} 会被错误详细信息中对应的值替换，返回使用默认语言消息的错误
+//
+//	ErrOrderNotExist = errors.Define(2000, http.StatusNotFound, map[string]string{
+//		"zh-CN": "订单 {id} 不存在",
+//		"en":    "order {id} not found",
+//	})
+func Define(code int, status int, messages map[string]string) *APIError {
+	m := make(map[string]string, len(messages))
+	for k, v := range messages {
+		m[strings.ToLower(k)] = v
+	}
+	catalog.Lock()
+	catalog.entries[code] = &entry{status: status, messages: m}
+	catalog.Unlock()
+	return (&APIError{Code: code, Message: m[strings.ToLower(DefaultLocale)]}).clone()
+}
+
+// Register 注册一个错误代码对应的 HTTP 状态码，重复注册会覆盖之前的设置
+func Register(code int, status int) {
+	catalog.Lock()
+	if e, ok := catalog.entries[code]; ok {
+		e.status = status
+	} else {
+		catalog.entries[code] = &entry{status: status}
+	}
+	catalog.Unlock()
+}
+
+// Registered 判断错误代码是否已经注册
+func Registered(code int) bool {
+	catalog.RLock()
+	_, ok := catalog.entries[code]
+	catalog.RUnlock()
+	return ok
+}
+
+// Status 返回错误代码对应的 HTTP 状态码，未注册的错误代码返回 200
+func Status(code int) int {
+	catalog.RLock()
+	e, ok := catalog.entries[code]
+	catalog.RUnlock()
+	if !ok || e.status == 0 {
+		return http.StatusOK
+	}
+	return e.status
+}
+
+// Localize 返回错误在指定语言下的消息，lang 可以直接使用 Accept-Language 请求头
+// 默认语言或没有对应语言的模板时返回 e.Message，消息中的 {key} 都会用 e.Details 替换
+// e.Message 与默认语言的模板不同时是自定义的消息，如 errors.New(ErrParamsInvalid.Code, "...")，不会被翻译
+func (e *APIError) Localize(lang string) string {
+	catalog.RLock()
+	entry, ok := catalog.entries[e.Code]
+	catalog.RUnlock()
+	if !ok || len(entry.messages) == 0 {
+		return e.render(e.Message)
+	}
+	if e.Message != entry.messages[strings.ToLower(DefaultLocale)] {
+		return e.render(e.Message)
+	}
+
+	for _, tag := range ParseAcceptLanguage(lang) {
+		locale := matchLocale(entry.messages, tag)
+		if locale == "" {
+			continue
+		}
+		if locale == strings.ToLower(DefaultLocale) {
+			return e.render(e.Message)
+		}
+		return e.render(entry.messages[locale])
+	}
+	return e.render(e.Message)
+}
+
+// render 用错误的详细信息替换消息模板中的 {key}
+func (e *APIError) render(tpl string) string {
+	if len(e.Details) == 0 {
+		return tpl
+	}
+	for k, v := range e.Details {
+		tpl = strings.Replace(tpl, "{"+k+"}", fmt.Sprint(v), -1)
+	}
+	return tpl
+}
+
+// matchLocale 查找与语言标签匹配的模板，zh 可以匹配 zh-CN，en-US 可以匹配 en
+func matchLocale(messages map[string]string, tag string) string {
+	if _, ok := messages[tag]; ok {
+		return tag
+	}
+	base := tag
+	if i := strings.IndexByte(tag, '-'); i > 0 {
+		base = tag[:i]
+		if _, ok := messages[base]; ok {
+			return base
+		}
+	}
+	var locales []string
+	for k := range messages {
+		if strings.HasPrefix(k, base+"-") {
+			locales = append(locales, k)
+		}
+	}
+	if len(locales) == 0 {
+		return ""
+	}
+	sort.Strings(locales)
+	return locales[0]
+}
+
+// ParseAcceptLanguage 按权重从高到低返回 Accept-Language 中的语言标签，统一为小写
+func ParseAcceptLanguage(header string) []string {
+	type tag struct {
+		name string
+		q    float64
+	}
+	var tags []tag
+	for _, part := range strings.Split(header, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		t := tag{name: part, q: 1}
+		if i := strings.IndexByte(part, ';'); i > 0 {
+			t.name = strings.TrimSpace(part[:i])
+			if q := strings.TrimSpace(part[i+1:]); strings.HasPrefix(q, "q=") {
+				if v, err := strconv.ParseFloat(q[2:], 64); err == nil {
+					t.q = v
+				}
+			}
+		}
+		if t.name == "*" || t.q <= 0 {
+			continue
+		}
+		t.name = strings.ToLower(strings.Replace(t.name, "_", "-", -1))
+		tags = append(tags, t)
+	}
+	sort.SliceStable(tags, func(i, j int) bool { return tags[i].q > tags[j].q })
+	names := make([]string, len(tags))
+	for i := range tags {
+		names[i] = tags[i].name
+	}
+	return names
+}
+
+// As 在错误链中查找第一个 *APIError
+func As(err error) (*APIError, bool) {
+	var e *APIError
+	if stderrors.As(err, &e) {
+		return e, true
+	}
+	return nil, false
+}
+
+func init() {
+	Register(ErrUserNeedLogin.Code, http.StatusUnauthorized)
+	Register(ErrUserInfoChanged.Code, http.StatusUnauthorized)
+	Register(ErrUserInvalidActionAuth.Code, http.StatusForbidden)
+}
@@ -0,0 +1,11 @@
+package errors
+
+import "net/http"
+
+var (
+	// ErrParamsInvalid 请求参数不正确
+	ErrParamsInvalid = Define(1400, http.StatusBadRequest, map[string]string{
+		"zh-CN": "请求参数不正确",
+		"en":    "Invalid request parameters",
+	})
+)
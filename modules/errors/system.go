@@ -0,0 +1,11 @@
+package errors
+
+import "net/http"
+
+var (
+	// ErrInternal 服务器内部错误，不是 APIError 的错误返回给客户端时使用
+	ErrInternal = Define(1, http.StatusInternalServerError, map[string]string{
+		"zh-CN": "服务器内部错误",
+		"en":    "Internal server error",
+	})
+)
@@ -0,0 +1,31 @@
+package errors
+
+import "net/http"
+
+var (
+	// ErrUploadMimeNotAllowed 文件类型不允许上传
+	ErrUploadMimeNotAllowed = Define(1600, http.StatusBadRequest, map[string]string{
+		"zh-CN": "文件类型不允许上传",
+		"en":    "File type is not allowed",
+	})
+	// ErrUploadMimeMismatch 文件内容与扩展名不符
+	ErrUploadMimeMismatch = Define(1601, http.StatusBadRequest, map[string]string{
+		"zh-CN": "文件内容与扩展名不符",
+		"en":    "File content does not match its extension",
+	})
+	// ErrUploadImageInvalid 图片文件已损坏
+	ErrUploadImageInvalid = Define(1602, http.StatusBadRequest, map[string]string{
+		"zh-CN": "图片文件已损坏",
+		"en":    "Image file is corrupted",
+	})
+	// ErrUploadImageTooSmall 图片尺寸过小
+	ErrUploadImageTooSmall = Define(1603, http.StatusBadRequest, map[string]string{
+		"zh-CN": "图片尺寸过小",
+		"en":    "Image dimensions are too small",
+	})
+	// ErrUploadImageTooLarge 图片尺寸过大
+	ErrUploadImageTooLarge = Define(1604, http.StatusBadRequest, map[string]string{
+		"zh-CN": "图片尺寸过大",
+		"en":    "Image dimensions are too large",
+	})
+)
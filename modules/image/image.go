@@ -5,6 +5,7 @@ import (
 	_ "image/gif"
 	_ "image/jpeg"
 	_ "image/png"
+	"io"
 	"os"
 	"strings"
 
@@ -36,8 +37,14 @@ func Detect(file string) (*Info, error) {
 	if err != nil {
 		return nil, err
 	}
+	defer f.Close()
 
-	img, format, err := image.DecodeConfig(f)
+	return DetectReader(f)
+}
+
+// DetectReader 从数据流中返回一个图片的类型，宽和高
+func DetectReader(r io.Reader) (*Info, error) {
+	img, format, err := image.DecodeConfig(r)
 	if err != nil {
 		return nil, err
 	}
@@ -45,6 +52,12 @@ func Detect(file string) (*Info, error) {
 	return &Info{Type: strings.ToUpper(format), Width: img.Width, Height: img.Height}, nil
 }
 
+// Verify 完整解码图片数据，检查图片是否损坏
+func Verify(r io.Reader) error {
+	_, _, err := image.Decode(r)
+	return err
+}
+
 var imageTypes map[fastimage.ImageType]string
 
 func init() {
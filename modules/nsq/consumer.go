@@ -1,7 +1,12 @@
 package nsq
 
 import (
+	"context"
+	"fmt"
 	"os"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/go-baa/log"
 	"github.com/go-baa/setting"
@@ -11,20 +16,52 @@ import (
 const (
 	// DefaultMaxInFlight 默认MaxInFlight配置，根据nsqd服务数可以动态调整
 	DefaultMaxInFlight = 3
+	// DefaultStopTimeout 停止时等待处理中的消息完成的默认时间
+	DefaultStopTimeout = 30 * time.Second
 )
 
 // Handler consumer handler
 type Handler struct {
-	Topic      string
-	Channel    string
-	Config     *nsq.Config
-	MsgHandler nsq.Handler
+	Topic       string
+	Channel     string
+	Config      *nsq.Config
+	MsgHandler  nsq.Handler
+	Middlewares []Middleware // 按顺序包装 MsgHandler，第一个在最外层
 }
 
 // Consumer ...
 type Consumer struct {
 	nsqLookupdAddrs []string
 	handlers        []*Handler
+	stopTimeout     time.Duration
+	stop            chan struct{}
+	stopOnce        sync.Once
+	mu              sync.RWMutex
+	subs            []subscription // 运行中的订阅
+}
+
+type subscription struct {
+	handler  *Handler
+	consumer *nsq.Consumer
+}
+
+// SubscriptionStatus 订阅的状态
+type SubscriptionStatus struct {
+	Topic       string `json:"topic"`
+	Channel     string `json:"channel"`
+	Connections int    `json:"connections"`
+}
+
+// Errors 多个订阅的错误
+type Errors []error
+
+// Error ...
+func (e Errors) Error() string {
+	s := make([]string, len(e))
+	for i, err := range e {
+		s[i] = err.Error()
+	}
+	return strings.Join(s, "; ")
 }
 
 // NewConsumer creates a new instance of Consumer
@@ -32,6 +69,8 @@ func NewConsumer(nsqLookupdAddrs ...string) *Consumer {
 	return &Consumer{
 		nsqLookupdAddrs: nsqLookupdAddrs,
 		handlers:        make([]*Handler, 0),
+		stopTimeout:     DefaultStopTimeout,
+		stop:            make(chan struct{}),
 	}
 }
 
@@ -47,35 +86,146 @@ func (t *Consumer) AddHandler(handler *Handler) {
 	t.handlers = append(t.handlers, handler)
 }
 
-// Run run consumer
-func (t *Consumer) Run() {
+// SetStopTimeout 设置停止时等待处理中的消息完成的时间
+func (t *Consumer) SetStopTimeout(d time.Duration) {
+	t.stopTimeout = d
+}
+
+// Run 启动所有订阅，直到 ctx 结束或调用 Stop，等待处理中的消息完成后返回
+// 订阅失败或等待超时时返回 Errors，通常在收到 SIGTERM 时取消 ctx：
+//
+//	ctx, cancel := context.WithCancel(context.Background())
+//	sig := make(chan os.Signal, 1)
+//	signal.Notify(sig, syscall.SIGINT, syscall.SIGTERM)
+//	go func() { <-sig; cancel() }()
+//	err := consumer.Run(ctx)
+func (t *Consumer) Run(ctx context.Context) error {
 	log.Println("[consumer] starting ...")
+	var errs Errors
+	var subs []subscription
 	for _, handler := range t.handlers {
-		go t.subscribe(handler)
+		consumer, err := t.subscribe(handler)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		subs = append(subs, subscription{handler, consumer})
+	}
+	t.mu.Lock()
+	t.subs = subs
+	t.mu.Unlock()
+
+	if len(errs) == 0 {
+		select {
+		case <-ctx.Done():
+		case <-t.stop:
+		}
+	}
+
+	log.Println("[consumer] stopping ...")
+	t.mu.Lock()
+	t.subs = nil
+	t.mu.Unlock()
+	for _, s := range subs {
+		s.consumer.Stop()
+	}
+	timeout := time.NewTimer(t.stopTimeout)
+	defer timeout.Stop()
+	expired := false
+	for _, s := range subs {
+		topic := topicName(s.handler.Topic)
+		if !expired {
+			select {
+			case <-s.consumer.StopChan:
+			case <-timeout.C:
+				expired = true
+			}
+		}
+		// 已经超时，其余的订阅只检查是否已经停止
+		if expired {
+			select {
+			case <-s.consumer.StopChan:
+			default:
+				errs = append(errs, fmt.Errorf("[%s:%s] stop timeout after %s", topic, s.handler.Channel, t.stopTimeout))
+				continue
+			}
+		}
+		log.Printf("[%s:%s] stopped subscribe", topic, s.handler.Channel)
 	}
-	select {}
+
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// Stop 停止所有订阅，Run 会在处理中的消息完成后返回
+func (t *Consumer) Stop() {
+	t.stopOnce.Do(func() {
+		close(t.stop)
+	})
+}
+
+// Status 返回运行中的订阅及其 nsqd 连接数
+func (t *Consumer) Status() []SubscriptionStatus {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	status := make([]SubscriptionStatus, len(t.subs))
+	for i, s := range t.subs {
+		status[i] = SubscriptionStatus{
+			Topic:       topicName(s.handler.Topic),
+			Channel:     s.handler.Channel,
+			Connections: s.consumer.Stats().Connections,
+		}
+	}
+	return status
+}
+
+// Ready 所有订阅都已启动并连接到 nsqd 时返回 nil
+func (t *Consumer) Ready() error {
+	status := t.Status()
+	if len(status) < len(t.handlers) {
+		return fmt.Errorf("[consumer] not running")
+	}
+	var errs Errors
+	for _, s := range status {
+		if s.Connections == 0 {
+			errs = append(errs, fmt.Errorf("[%s:%s] no nsqd connection", s.Topic, s.Channel))
+		}
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
 }
 
 // subscribe 启动topic订阅
-func (t *Consumer) subscribe(h *Handler) {
-	nsqPrefix := setting.Config.MustString("nsq.prefix", "")
-	if nsqPrefix != "" {
-		h.Topic = nsqPrefix + "_" + h.Topic
+func (t *Consumer) subscribe(h *Handler) (*nsq.Consumer, error) {
+	topic := topicName(h.Topic)
+	config := h.Config
+	if config == nil {
+		config = DefaultConfig()
 	}
-	consumer, err := nsq.NewConsumer(h.Topic, h.Channel, h.Config)
+	consumer, err := nsq.NewConsumer(topic, h.Channel, config)
 	if err != nil {
-		log.Fatalf("[%s:%s] init error: %v", h.Topic, h.Channel, err)
-	} else {
-		log.Printf("[%s:%s] init ok", h.Topic, h.Channel)
+		return nil, fmt.Errorf("[%s:%s] init error: %v", topic, h.Channel, err)
 	}
+	log.Printf("[%s:%s] init ok", topic, h.Channel)
 	consumer.SetLogger(log.New(os.Stderr, "NSQ", log.Flags()), nsq.LogLevelError)
 
-	consumer.AddHandler(h.MsgHandler)
+	consumer.AddHandler(instrument(topic, h.Channel, Chain(h.MsgHandler, h.Middlewares...)))
 	err = consumer.ConnectToNSQLookupds(t.nsqLookupdAddrs)
 	if err != nil {
-		log.Fatalf("[%s:%s] connect lookup error: %v", h.Topic, h.Channel, err)
+		consumer.Stop()
+		return nil, fmt.Errorf("[%s:%s] connect lookup error: %v", topic, h.Channel, err)
 	}
+	return consumer, nil
+}
 
-	<-consumer.StopChan
-	log.Printf("[%s:%s] stopped subscribe", h.Topic, h.Channel)
+// topicName 返回加上 nsq.prefix 前缀的 topic
+func topicName(topic string) string {
+	if nsqPrefix := setting.Config.MustString("nsq.prefix", ""); nsqPrefix != "" {
+		return nsqPrefix + "_" + topic
+	}
+	return topic
 }
@@ -0,0 +1,92 @@
+package nsq
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	nsq "github.com/nsqio/go-nsq"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func waitFor(cond func() bool) bool {
+	for i := 0; i < 200; i++ {
+		if cond() {
+			return true
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return false
+}
+
+func TestConsumer(t *testing.T) {
+	Convey("测试停止时等待处理中的消息", t, func() {
+		f := newFakeNSQD()
+		defer f.Close()
+
+		var started, done int32
+		c := NewConsumer(f.LookupdAddr())
+		c.AddHandler(&Handler{
+			Topic:   "test",
+			Channel: "ch",
+			MsgHandler: nsq.HandlerFunc(func(m *nsq.Message) error {
+				atomic.AddInt32(&started, 1)
+				time.Sleep(200 * time.Millisecond)
+				atomic.AddInt32(&done, 1)
+				return nil
+			}),
+		})
+
+		ctx, cancel := context.WithCancel(context.Background())
+		errc := make(chan error, 1)
+		go func() { errc <- c.Run(ctx) }()
+
+		f.Send([]byte("hello"))
+		So(waitFor(func() bool { return atomic.LoadInt32(&started) == 1 }), ShouldBeTrue)
+		cancel()
+
+		So(<-errc, ShouldBeNil)
+		So(atomic.LoadInt32(&done), ShouldEqual, 1)
+		So(f.count(f.finished, "0000000000000001"), ShouldEqual, 1)
+	})
+
+	Convey("测试停止超时", t, func() {
+		f := newFakeNSQD()
+		defer f.Close()
+
+		var started int32
+		block := make(chan struct{})
+		defer close(block)
+		c := NewConsumer(f.LookupdAddr())
+		c.SetStopTimeout(100 * time.Millisecond)
+		c.AddHandler(&Handler{
+			Topic:   "test",
+			Channel: "ch",
+			MsgHandler: nsq.HandlerFunc(func(m *nsq.Message) error {
+				atomic.AddInt32(&started, 1)
+				<-block
+				return nil
+			}),
+		})
+
+		errc := make(chan error, 1)
+		go func() { errc <- c.Run(context.Background()) }()
+		f.Send([]byte("hello"))
+		So(waitFor(func() bool { return atomic.LoadInt32(&started) == 1 }), ShouldBeTrue)
+		c.Stop()
+
+		err := <-errc
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldContainSubstring, "stop timeout")
+	})
+
+	Convey("测试订阅失败返回错误", t, func() {
+		c := NewConsumer("127.0.0.1:4161")
+		c.AddHandler(&Handler{Topic: "bad topic", Channel: "ch", MsgHandler: nsq.HandlerFunc(func(*nsq.Message) error { return nil })})
+		c.AddHandler(&Handler{Topic: "test", Channel: "bad channel", MsgHandler: nsq.HandlerFunc(func(*nsq.Message) error { return nil })})
+		err := c.Run(context.Background())
+		So(err, ShouldNotBeNil)
+		So(len(err.(Errors)), ShouldEqual, 2)
+	})
+}
@@ -0,0 +1,221 @@
+package nsq
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/go-baa/common/util/uuid"
+	nsq "github.com/nsqio/go-nsq"
+)
+
+// ContentTypeJSON JSON 编码的消息
+const ContentTypeJSON = "application/json"
+
+var (
+	// ErrInvalidEnvelope 消息不是有效的信封格式
+	ErrInvalidEnvelope = errors.New("nsq: invalid envelope")
+	// ErrUnsupportedVersion 消息的版本高于处理程序支持的版本
+	ErrUnsupportedVersion = errors.New("nsq: unsupported schema version")
+)
+
+// Envelope 消息信封，记录消息的元数据，Body 为编码后的消息内容
+// JSON 消息的 Body 直接嵌入，其他编码的 Body 为 base64 字符串
+type Envelope struct {
+	ID          string          `json:"id"`
+	Timestamp   int64           `json:"timestamp"` // 发布时间，Unix 毫秒
+	TraceID     string          `json:"trace_id,omitempty"`
+	Version     int             `json:"version"`
+	ContentType string          `json:"content_type"`
+	Body        json.RawMessage `json:"body"`
+}
+
+// Versioned 消息类型实现该接口时，发布时记录其版本，消费时拒绝更高版本的消息
+// 没有实现时版本为 1
+type Versioned interface {
+	SchemaVersion() int
+}
+
+// Codec 消息内容的编码方式，可以注册 protobuf 等编码
+type Codec interface {
+	ContentType() string
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(data []byte, v interface{}) error
+}
+
+var codecs = struct {
+	sync.RWMutex
+	m map[string]Codec
+}{m: make(map[string]Codec)}
+
+// RegisterCodec 注册消息编码，重复注册时 panic
+func RegisterCodec(c Codec) {
+	codecs.Lock()
+	defer codecs.Unlock()
+	if c == nil {
+		panic("nsq.RegisterCodec: codec is nil")
+	}
+	if _, dup := codecs.m[c.ContentType()]; dup {
+		panic("nsq.RegisterCodec: called twice for " + c.ContentType())
+	}
+	codecs.m[c.ContentType()] = c
+}
+
+func getCodec(contentType string) (Codec, error) {
+	codecs.RLock()
+	c, ok := codecs.m[contentType]
+	codecs.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("nsq: unknown content type %s", contentType)
+	}
+	return c, nil
+}
+
+// jsonCodec JSON 编码
+type jsonCodec struct{}
+
+func (jsonCodec) ContentType() string                        { return ContentTypeJSON }
+func (jsonCodec) Marshal(v interface{}) ([]byte, error)      { return json.Marshal(v) }
+func (jsonCodec) Unmarshal(data []byte, v interface{}) error { return json.Unmarshal(data, v) }
+
+// PublishOption 发布选项
+type PublishOption func(e *Envelope)
+
+// WithTraceID 设置消息的追踪 ID
+func WithTraceID(traceID string) PublishOption {
+	return func(e *Envelope) {
+		e.TraceID = traceID
+	}
+}
+
+// WithVersion 设置消息的版本，覆盖 Versioned 接口的版本
+func WithVersion(version int) PublishOption {
+	return func(e *Envelope) {
+		e.Version = version
+	}
+}
+
+// WithContentType 设置消息的编码，默认 JSON
+func WithContentType(contentType string) PublishOption {
+	return func(e *Envelope) {
+		e.ContentType = contentType
+	}
+}
+
+// Encode 编码 v 并封装为信封
+func Encode(v interface{}, opts ...PublishOption) ([]byte, error) {
+	e := &Envelope{
+		ID:          uuid.NewV4().String(),
+		Timestamp:   time.Now().UnixNano() / int64(time.Millisecond),
+		Version:     1,
+		ContentType: ContentTypeJSON,
+	}
+	if vv, ok := v.(Versioned); ok {
+		e.Version = vv.SchemaVersion()
+	}
+	for _, opt := range opts {
+		opt(e)
+	}
+
+	c, err := getCodec(e.ContentType)
+	if err != nil {
+		return nil, err
+	}
+	body, err := c.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	if e.ContentType == ContentTypeJSON {
+		e.Body = body
+	} else if e.Body, err = json.Marshal(body); err != nil {
+		return nil, err
+	}
+	return json.Marshal(e)
+}
+
+// Decode 解析信封，返回信封和消息内容的原始数据
+func Decode(data []byte) (*Envelope, []byte, error) {
+	e := new(Envelope)
+	if err := json.Unmarshal(data, e); err != nil || e.ID == "" || e.ContentType == "" {
+		return nil, nil, ErrInvalidEnvelope
+	}
+	if e.ContentType == ContentTypeJSON {
+		return e, e.Body, nil
+	}
+	var body []byte
+	if err := json.Unmarshal(e.Body, &body); err != nil {
+		return nil, nil, ErrInvalidEnvelope
+	}
+	return e, body, nil
+}
+
+// PublishJSON 使用 JSON 编码 v，封装为信封后发布
+func (t *Producer) PublishJSON(topic string, v interface{}, opts ...PublishOption) error {
+	body, err := Encode(v, append([]PublishOption{WithContentType(ContentTypeJSON)}, opts...)...)
+	if err != nil {
+		return err
+	}
+	return t.Publish(topic, body)
+}
+
+// PublishValue 按 opts 指定的编码发布 v，默认 JSON
+func (t *Producer) PublishValue(topic string, v interface{}, opts ...PublishOption) error {
+	body, err := Encode(v, opts...)
+	if err != nil {
+		return err
+	}
+	return t.Publish(topic, body)
+}
+
+// Message 解码后的消息
+type Message[T any] struct {
+	Envelope
+	Body T
+	Raw  *nsq.Message
+}
+
+// TypedHandler 返回解码信封后再调用 fn 的处理程序
+// 信封无效、编码未知或版本高于 T 的 SchemaVersion 时不调用 fn，返回错误，可以配合 Retry 发布到死信 topic
+func TypedHandler[T any](fn func(m *Message[T]) error) nsq.Handler {
+	maxVersion := 1
+	var zero T
+	if v, ok := interface{}(&zero).(Versioned); ok {
+		maxVersion = v.SchemaVersion()
+	}
+	return nsq.HandlerFunc(func(raw *nsq.Message) error {
+		e, body, err := Decode(raw.Body)
+		if err != nil {
+			return err
+		}
+		if e.Version > maxVersion {
+			return fmt.Errorf("%w: %d > %d", ErrUnsupportedVersion, e.Version, maxVersion)
+		}
+		c, err := getCodec(e.ContentType)
+		if err != nil {
+			return err
+		}
+		m := &Message[T]{Envelope: *e, Raw: raw}
+		m.Envelope.Body = nil
+		if err = c.Unmarshal(body, &m.Body); err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidEnvelope, err)
+		}
+		return fn(m)
+	})
+}
+
+// AddTypedHandler 添加处理指定类型消息的订阅
+func AddTypedHandler[T any](c *Consumer, topic, channel string, fn func(m *Message[T]) error, middlewares ...Middleware) {
+	c.AddHandler(&Handler{
+		Topic:       topic,
+		Channel:     channel,
+		Config:      DefaultConfig(),
+		MsgHandler:  TypedHandler(fn),
+		Middlewares: middlewares,
+	})
+}
+
+func init() {
+	RegisterCodec(jsonCodec{})
+}
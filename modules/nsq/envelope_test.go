@@ -0,0 +1,148 @@
+package nsq
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+type orderV1 struct {
+	OrderID int    `json:"order_id"`
+	Status  string `json:"status"`
+}
+
+type orderV2 struct {
+	OrderID int    `json:"order_id"`
+	Status  string `json:"status"`
+	Amount  int    `json:"amount"`
+}
+
+func (orderV2) SchemaVersion() int { return 2 }
+
+// textCodec 测试用的非 JSON 编码
+type textCodec struct{}
+
+func (textCodec) ContentType() string { return "text/plain" }
+func (textCodec) Marshal(v interface{}) ([]byte, error) {
+	return []byte(*v.(*string)), nil
+}
+func (textCodec) Unmarshal(data []byte, v interface{}) error {
+	*v.(*string) = string(data)
+	return nil
+}
+
+func TestEnvelope(t *testing.T) {
+	RegisterCodec(textCodec{})
+
+	Convey("测试编码和解码信封", t, func() {
+		data, err := Encode(orderV1{OrderID: 1, Status: "paid"}, WithTraceID("trace-1"))
+		So(err, ShouldBeNil)
+		e, body, err := Decode(data)
+		So(err, ShouldBeNil)
+		So(e.ID, ShouldNotBeEmpty)
+		So(e.Timestamp, ShouldBeGreaterThan, 0)
+		So(e.TraceID, ShouldEqual, "trace-1")
+		So(e.Version, ShouldEqual, 1)
+		So(e.ContentType, ShouldEqual, ContentTypeJSON)
+		So(string(body), ShouldEqual, `{"order_id":1,"status":"paid"}`)
+
+		data, err = Encode(orderV2{OrderID: 1})
+		So(err, ShouldBeNil)
+		e, _, err = Decode(data)
+		So(err, ShouldBeNil)
+		So(e.Version, ShouldEqual, 2)
+
+		s := "hello"
+		data, err = Encode(&s, WithContentType("text/plain"), WithVersion(3))
+		So(err, ShouldBeNil)
+		e, body, err = Decode(data)
+		So(err, ShouldBeNil)
+		So(e.Version, ShouldEqual, 3)
+		So(string(body), ShouldEqual, "hello")
+
+		_, err = Encode(&s, WithContentType("unknown"))
+		So(err, ShouldNotBeNil)
+		_, _, err = Decode([]byte("hello"))
+		So(err, ShouldEqual, ErrInvalidEnvelope)
+	})
+
+	Convey("测试重复注册编码", t, func() {
+		So(func() { RegisterCodec(jsonCodec{}) }, ShouldPanic)
+	})
+
+	Convey("测试类型化的处理程序", t, func() {
+		var got *Message[orderV1]
+		h := TypedHandler(func(m *Message[orderV1]) error {
+			got = m
+			return nil
+		})
+
+		data, _ := Encode(orderV1{OrderID: 1, Status: "paid"}, WithTraceID("trace-1"))
+		m, _ := newTestMessage(string(data), 1)
+		So(h.HandleMessage(m), ShouldBeNil)
+		So(got, ShouldNotBeNil)
+		So(got.Body, ShouldResemble, orderV1{OrderID: 1, Status: "paid"})
+		So(got.TraceID, ShouldEqual, "trace-1")
+		So(got.Raw, ShouldEqual, m)
+
+		Convey("版本高于处理程序支持的版本时不调用处理程序", func() {
+			got = nil
+			data, _ := Encode(orderV2{OrderID: 2})
+			m, _ := newTestMessage(string(data), 1)
+			err := h.HandleMessage(m)
+			So(errors.Is(err, ErrUnsupportedVersion), ShouldBeTrue)
+			So(got, ShouldBeNil)
+
+			var v2 *Message[orderV2]
+			h2 := TypedHandler(func(m *Message[orderV2]) error {
+				v2 = m
+				return nil
+			})
+			So(h2.HandleMessage(m), ShouldBeNil)
+			So(v2.Body.OrderID, ShouldEqual, 2)
+		})
+
+		Convey("无效的消息返回错误", func() {
+			got = nil
+			m, _ := newTestMessage("hello", 1)
+			So(h.HandleMessage(m), ShouldEqual, ErrInvalidEnvelope)
+			m, _ = newTestMessage(`{"id":"1","version":1,"content_type":"application/json","body":[]}`, 1)
+			So(errors.Is(h.HandleMessage(m), ErrInvalidEnvelope), ShouldBeTrue)
+			So(got, ShouldBeNil)
+		})
+	})
+
+	Convey("测试发布和消费类型化的消息", t, func() {
+		f := newFakeNSQD()
+		defer f.Close()
+
+		p := NewProducer(f.LookupdAddr())
+		So(waitFor(func() bool { return p.Count() > 0 }), ShouldBeTrue)
+		So(p.PublishJSON("orders", orderV1{OrderID: 1, Status: "paid"}, WithTraceID("trace-1")), ShouldBeNil)
+		published := f.Published("orders")
+		So(len(published), ShouldEqual, 1)
+		var e Envelope
+		So(json.Unmarshal(published[0], &e), ShouldBeNil)
+		So(e.TraceID, ShouldEqual, "trace-1")
+
+		received := make(chan *Message[orderV1], 1)
+		c := NewConsumer(f.LookupdAddr())
+		AddTypedHandler(c, "orders", "ch", func(m *Message[orderV1]) error {
+			received <- m
+			return nil
+		})
+		ctx, cancel := context.WithCancel(context.Background())
+		errc := make(chan error, 1)
+		go func() { errc <- c.Run(ctx) }()
+
+		f.Send(published[0])
+		m := <-received
+		cancel()
+		So(<-errc, ShouldBeNil)
+		So(m.ID, ShouldEqual, e.ID)
+		So(m.Body.Status, ShouldEqual, "paid")
+	})
+}
@@ -0,0 +1,220 @@
+package nsq
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-baa/baa"
+	nsq "github.com/nsqio/go-nsq"
+)
+
+// DefaultBuckets 耗时直方图的默认区间，单位：秒
+var DefaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// 指标名称
+const (
+	metricPublished       = "nsq_published_total"
+	metricPublishFailed   = "nsq_publish_failed_total"
+	metricPublishDuration = "nsq_publish_duration_seconds"
+	metricConsumed        = "nsq_consumed_total"
+	metricRequeued        = "nsq_requeued_total"
+	metricHandlerErrors   = "nsq_handler_errors_total"
+	metricHandlerDuration = "nsq_handler_duration_seconds"
+)
+
+var metricHelps = map[string]string{
+	metricPublished:       "Number of messages published.",
+	metricPublishFailed:   "Number of messages failed to publish on all nsqd.",
+	metricPublishDuration: "Time spent publishing messages.",
+	metricConsumed:        "Number of messages received by handlers.",
+	metricRequeued:        "Number of messages requeued.",
+	metricHandlerErrors:   "Number of messages the handler returned an error for.",
+	metricHandlerDuration: "Time spent handling messages.",
+}
+
+type metricKey struct {
+	name    string
+	topic   string
+	channel string
+}
+
+type histogram struct {
+	counts []uint64 // 每个区间的计数，不累加
+	sum    float64
+	count  uint64
+}
+
+// metrics 进程内所有 Producer 和 Consumer 的指标
+var metrics = struct {
+	sync.Mutex
+	counters   map[metricKey]uint64
+	histograms map[metricKey]*histogram
+}{
+	counters:   make(map[metricKey]uint64),
+	histograms: make(map[metricKey]*histogram),
+}
+
+func addCounter(name, topic, channel string, n int) {
+	metrics.Lock()
+	metrics.counters[metricKey{name, topic, channel}] += uint64(n)
+	metrics.Unlock()
+}
+
+func observe(name, topic, channel string, d time.Duration) {
+	v := d.Seconds()
+	k := metricKey{name, topic, channel}
+	metrics.Lock()
+	h, ok := metrics.histograms[k]
+	if !ok {
+		h = &histogram{counts: make([]uint64, len(DefaultBuckets))}
+		metrics.histograms[k] = h
+	}
+	for i, le := range DefaultBuckets {
+		if v <= le {
+			h.counts[i]++
+			break
+		}
+	}
+	h.sum += v
+	h.count++
+	metrics.Unlock()
+}
+
+// WriteMetrics 以 Prometheus 文本格式输出所有指标
+func WriteMetrics(w io.Writer) error {
+	metrics.Lock()
+	defer metrics.Unlock()
+
+	type sample struct {
+		key metricKey
+		typ string
+	}
+	var samples []sample
+	for k := range metrics.counters {
+		samples = append(samples, sample{k, "counter"})
+	}
+	for k := range metrics.histograms {
+		samples = append(samples, sample{k, "histogram"})
+	}
+	sort.Slice(samples, func(i, j int) bool {
+		a, b := samples[i].key, samples[j].key
+		if a.name != b.name {
+			return a.name < b.name
+		}
+		if a.topic != b.topic {
+			return a.topic < b.topic
+		}
+		return a.channel < b.channel
+	})
+
+	bw := bufio.NewWriter(w)
+	last := ""
+	for _, s := range samples {
+		k := s.key
+		if k.name != last {
+			fmt.Fprintf(bw, "# HELP %s %s\n# TYPE %s %s\n", k.name, metricHelps[k.name], k.name, s.typ)
+			last = k.name
+		}
+		labels := metricLabels(k)
+		if s.typ == "counter" {
+			fmt.Fprintf(bw, "%s{%s} %d\n", k.name, labels, metrics.counters[k])
+			continue
+		}
+		h := metrics.histograms[k]
+		var cumulative uint64
+		for i, le := range DefaultBuckets {
+			cumulative += h.counts[i]
+			fmt.Fprintf(bw, "%s_bucket{%s,le=\"%s\"} %d\n", k.name, labels, strconv.FormatFloat(le, 'g', -1, 64), cumulative)
+		}
+		fmt.Fprintf(bw, "%s_bucket{%s,le=\"+Inf\"} %d\n", k.name, labels, h.count)
+		fmt.Fprintf(bw, "%s_sum{%s} %s\n", k.name, labels, strconv.FormatFloat(h.sum, 'g', -1, 64))
+		fmt.Fprintf(bw, "%s_count{%s} %d\n", k.name, labels, h.count)
+	}
+	return bw.Flush()
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func metricLabels(k metricKey) string {
+	s := `topic="` + labelEscaper.Replace(k.topic) + `"`
+	if k.channel != "" {
+		s += `,channel="` + labelEscaper.Replace(k.channel) + `"`
+	}
+	return s
+}
+
+// MetricsHandler 返回输出指标的 baa 路由，例如：
+//
+//	app.Get("/metrics/nsq", nsq.MetricsHandler())
+func MetricsHandler() baa.HandlerFunc {
+	return func(c *baa.Context) {
+		c.Resp.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		c.Resp.WriteHeader(200)
+		WriteMetrics(c.Resp)
+	}
+}
+
+// instrument 记录消息处理的指标，重新入队通过包装 Delegate 统计，包括 Retry 中间件的延迟重试
+func instrument(topic, channel string, next nsq.Handler) nsq.Handler {
+	return nsq.HandlerFunc(func(m *nsq.Message) error {
+		addCounter(metricConsumed, topic, channel, 1)
+		if m.Delegate != nil {
+			m.Delegate = &metricsDelegate{MessageDelegate: m.Delegate, topic: topic, channel: channel}
+		}
+		start := time.Now()
+		err := next.HandleMessage(m)
+		observe(metricHandlerDuration, topic, channel, time.Since(start))
+		if err != nil {
+			addCounter(metricHandlerErrors, topic, channel, 1)
+		}
+		return err
+	})
+}
+
+type metricsDelegate struct {
+	nsq.MessageDelegate
+	topic   string
+	channel string
+}
+
+func (d *metricsDelegate) OnRequeue(m *nsq.Message, delay time.Duration, backoff bool) {
+	addCounter(metricRequeued, d.topic, d.channel, 1)
+	d.MessageDelegate.OnRequeue(m, delay, backoff)
+}
+
+// Health 健康检查的结果
+type Health struct {
+	Ready         bool                 `json:"ready"`
+	NSQD          int                  `json:"nsqd"` // Ping 成功的 nsqd 数量
+	Subscriptions []SubscriptionStatus `json:"subscriptions"`
+}
+
+// HealthHandler 返回就绪检查的 baa 路由，p 为空时不检查 nsqd
+// nsqd 用 Producer.Alive 逐个 Ping 检查，订阅用 nsq.Consumer 的连接数检查，
+// 有 Ping 成功的 nsqd 且所有订阅都有 nsqd 连接时返回 200，否则返回 503
+func HealthHandler(p *Producer, consumers ...*Consumer) baa.HandlerFunc {
+	return func(c *baa.Context) {
+		h := Health{Ready: true, Subscriptions: []SubscriptionStatus{}}
+		if p != nil {
+			h.NSQD = p.Alive()
+			h.Ready = h.NSQD > 0
+		}
+		for _, consumer := range consumers {
+			if consumer.Ready() != nil {
+				h.Ready = false
+			}
+			h.Subscriptions = append(h.Subscriptions, consumer.Status()...)
+		}
+		code := 200
+		if !h.Ready {
+			code = 503
+		}
+		c.JSON(code, h)
+	}
+}
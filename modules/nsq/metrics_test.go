@@ -0,0 +1,109 @@
+package nsq
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-baa/baa"
+	nsq "github.com/nsqio/go-nsq"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestMetrics(t *testing.T) {
+	Convey("测试直方图和标签转义", t, func() {
+		observe(metricHandlerDuration, `a"b`, "ch", 20*time.Millisecond)
+		observe(metricHandlerDuration, `a"b`, "ch", time.Minute)
+		buf := new(bytes.Buffer)
+		So(WriteMetrics(buf), ShouldBeNil)
+		out := buf.String()
+		So(out, ShouldContainSubstring, "# TYPE nsq_handler_duration_seconds histogram\n")
+		So(out, ShouldContainSubstring, `nsq_handler_duration_seconds_bucket{topic="a\"b",channel="ch",le="0.01"} 0`)
+		So(out, ShouldContainSubstring, `nsq_handler_duration_seconds_bucket{topic="a\"b",channel="ch",le="0.025"} 1`)
+		So(out, ShouldContainSubstring, `nsq_handler_duration_seconds_bucket{topic="a\"b",channel="ch",le="10"} 1`)
+		So(out, ShouldContainSubstring, `nsq_handler_duration_seconds_bucket{topic="a\"b",channel="ch",le="+Inf"} 2`)
+		So(out, ShouldContainSubstring, `nsq_handler_duration_seconds_count{topic="a\"b",channel="ch"} 2`)
+	})
+
+	Convey("测试发布和消费的指标", t, func() {
+		f := newFakeNSQD()
+		defer f.Close()
+
+		app := baa.New()
+		p := NewProducer(f.LookupdAddr())
+		c := NewConsumer(f.LookupdAddr())
+		var calls int32
+		c.AddHandler(&Handler{
+			Topic:   "metrics",
+			Channel: "ch",
+			MsgHandler: nsq.HandlerFunc(func(m *nsq.Message) error {
+				if atomic.AddInt32(&calls, 1) == 1 {
+					return errors.New("failed")
+				}
+				return nil
+			}),
+		})
+		app.Get("/metrics", MetricsHandler())
+		app.Get("/health", HealthHandler(p, c))
+		get := func(path string) *httptest.ResponseRecorder {
+			w := httptest.NewRecorder()
+			app.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+			return w
+		}
+
+		So(get("/health").Code, ShouldEqual, http.StatusServiceUnavailable)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		errc := make(chan error, 1)
+		go func() { errc <- c.Run(ctx) }()
+		defer func() {
+			cancel()
+			<-errc
+		}()
+
+		So(waitFor(func() bool { return p.Count() > 0 && c.Ready() == nil }), ShouldBeTrue)
+		w := get("/health")
+		So(w.Code, ShouldEqual, http.StatusOK)
+		var h Health
+		So(json.Unmarshal(w.Body.Bytes(), &h), ShouldBeNil)
+		So(h.Ready, ShouldBeTrue)
+		So(h.NSQD, ShouldEqual, 1)
+		So(h.Subscriptions, ShouldResemble, []SubscriptionStatus{{Topic: "metrics", Channel: "ch", Connections: 1}})
+
+		So(p.MultiPublish("metrics_pub", [][]byte{[]byte("a"), []byte("b")}), ShouldBeNil)
+		f.mu.Lock()
+		f.failPub = true
+		f.mu.Unlock()
+		So(p.Publish("metrics_pub", []byte("c")), ShouldNotBeNil)
+
+		f.Send([]byte("hello"))
+		So(waitFor(func() bool { return f.count(f.finished, "0000000000000001") == 1 }), ShouldBeTrue)
+
+		w = get("/metrics")
+		So(w.Code, ShouldEqual, http.StatusOK)
+		So(w.Header().Get("Content-Type"), ShouldStartWith, "text/plain")
+		out := w.Body.String()
+		So(out, ShouldContainSubstring, `nsq_published_total{topic="metrics_pub"} 2`)
+		So(out, ShouldContainSubstring, `nsq_publish_failed_total{topic="metrics_pub"} 1`)
+		So(out, ShouldContainSubstring, `nsq_publish_duration_seconds_count{topic="metrics_pub"} 2`)
+		So(out, ShouldContainSubstring, `nsq_consumed_total{topic="metrics",channel="ch"} 2`)
+		So(out, ShouldContainSubstring, `nsq_requeued_total{topic="metrics",channel="ch"} 1`)
+		So(out, ShouldContainSubstring, `nsq_handler_errors_total{topic="metrics",channel="ch"} 1`)
+		So(out, ShouldContainSubstring, `nsq_handler_duration_seconds_count{topic="metrics",channel="ch"} 2`)
+
+		// nsqd 断开后，即使还保留着连接也返回 503
+		app.Get("/health/nsqd", HealthHandler(p))
+		So(get("/health/nsqd").Code, ShouldEqual, http.StatusOK)
+		f.Close()
+		So(waitFor(func() bool { return get("/health/nsqd").Code == http.StatusServiceUnavailable }), ShouldBeTrue)
+		So(p.Count(), ShouldEqual, 1)
+		So(p.Alive(), ShouldEqual, 0)
+		So(waitFor(func() bool { return get("/health").Code == http.StatusServiceUnavailable }), ShouldBeTrue)
+	})
+}
@@ -0,0 +1,136 @@
+package nsq
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"runtime/debug"
+	"time"
+
+	"github.com/go-baa/log"
+	nsq "github.com/nsqio/go-nsq"
+)
+
+const (
+	// DefaultMaxAttempts 默认最大尝试次数，不能超过 nsq.Config.MaxAttempts，否则超出的消息会被直接丢弃
+	DefaultMaxAttempts = 5
+	// DefaultMinBackoff 第一次重试的默认延迟
+	DefaultMinBackoff = time.Second
+	// DefaultMaxBackoff 重试的默认最大延迟
+	DefaultMaxBackoff = 10 * time.Minute
+	// DefaultBackoffJitter 重试延迟默认的随机浮动比例
+	DefaultBackoffJitter = 0.2
+	// DeadLetterSuffix 死信 topic 的后缀
+	DeadLetterSuffix = "_dlq"
+)
+
+// Middleware 消息处理的中间件
+type Middleware func(next nsq.Handler) nsq.Handler
+
+// Chain 组合中间件，第一个中间件在最外层
+func Chain(h nsq.Handler, middlewares ...Middleware) nsq.Handler {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		h = middlewares[i](h)
+	}
+	return h
+}
+
+// Recover 恢复处理消息时的 panic，作为错误返回
+func Recover() Middleware {
+	return func(next nsq.Handler) nsq.Handler {
+		return nsq.HandlerFunc(func(m *nsq.Message) (err error) {
+			defer func() {
+				if r := recover(); r != nil {
+					err = fmt.Errorf("[nsq] handler panic: %v", r)
+					log.Errorf("%s\n%s", err, debug.Stack())
+				}
+			}()
+			return next.HandleMessage(m)
+		})
+	}
+}
+
+// Timeout 限制处理一条消息的时间，超时后返回错误，消息按错误处理
+// 超时的处理不会被中断，其后的结果会被忽略
+func Timeout(d time.Duration) Middleware {
+	return func(next nsq.Handler) nsq.Handler {
+		return nsq.HandlerFunc(func(m *nsq.Message) error {
+			done := make(chan error, 1)
+			go func() {
+				defer func() {
+					if r := recover(); r != nil {
+						done <- fmt.Errorf("[nsq] handler panic: %v", r)
+					}
+				}()
+				done <- next.HandleMessage(m)
+			}()
+			timer := time.NewTimer(d)
+			defer timer.Stop()
+			select {
+			case err := <-done:
+				return err
+			case <-timer.C:
+				return fmt.Errorf("[nsq] handler timeout after %s", d)
+			}
+		})
+	}
+}
+
+// RetryOptions 重试配置
+type RetryOptions struct {
+	MaxAttempts uint16        // 最大尝试次数，默认 5
+	MinBackoff  time.Duration // 第一次重试的延迟，之后每次翻倍，默认 1 秒
+	MaxBackoff  time.Duration // 最大延迟，默认 10 分钟
+	Jitter      float64       // 延迟随机浮动的比例，0~1，默认 0.2
+	Producer    *Producer     // 最后一次失败后发布到死信 topic，为空时丢弃消息
+	Topic       string        // 消息的 topic，死信 topic 为 Topic + "_dlq"
+}
+
+// Retry 处理失败时按指数退避延迟重新入队，达到最大尝试次数后发布到死信 topic
+func Retry(opts RetryOptions) Middleware {
+	if opts.MaxAttempts == 0 {
+		opts.MaxAttempts = DefaultMaxAttempts
+	}
+	if opts.MinBackoff <= 0 {
+		opts.MinBackoff = DefaultMinBackoff
+	}
+	if opts.MaxBackoff <= 0 {
+		opts.MaxBackoff = DefaultMaxBackoff
+	}
+	if opts.Jitter <= 0 || opts.Jitter > 1 {
+		opts.Jitter = DefaultBackoffJitter
+	}
+	return func(next nsq.Handler) nsq.Handler {
+		return nsq.HandlerFunc(func(m *nsq.Message) error {
+			err := next.HandleMessage(m)
+			if err == nil {
+				return nil
+			}
+			if m.Attempts < opts.MaxAttempts {
+				delay := opts.backoff(m.Attempts)
+				log.Warnf("[nsq] msg %s attempt %d failed, retry after %s: %v\n", m.ID, m.Attempts, delay, err)
+				m.RequeueWithoutBackoff(delay)
+				return nil
+			}
+
+			log.Errorf("[nsq] msg %s failed after %d attempts: %v\n", m.ID, m.Attempts, err)
+			if opts.Producer != nil && opts.Topic != "" {
+				if err = opts.Producer.Publish(opts.Topic+DeadLetterSuffix, m.Body); err != nil {
+					// 发布失败时按原错误处理，消息会重新入队
+					return fmt.Errorf("[nsq] publish to dead letter topic error: %v", err)
+				}
+			}
+			return nil
+		})
+	}
+}
+
+// backoff 返回第 attempts 次失败后的重试延迟
+func (o RetryOptions) backoff(attempts uint16) time.Duration {
+	d := float64(o.MinBackoff) * math.Pow(2, float64(attempts)-1)
+	if d > float64(o.MaxBackoff) {
+		d = float64(o.MaxBackoff)
+	}
+	d += d * o.Jitter * (rand.Float64()*2 - 1)
+	return time.Duration(d)
+}
@@ -0,0 +1,108 @@
+package nsq
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	nsq "github.com/nsqio/go-nsq"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// testDelegate 记录消息的响应
+type testDelegate struct {
+	finished bool
+	requeued bool
+	delay    time.Duration
+	backoff  bool
+}
+
+func (d *testDelegate) OnFinish(m *nsq.Message) { d.finished = true }
+func (d *testDelegate) OnRequeue(m *nsq.Message, delay time.Duration, backoff bool) {
+	d.requeued, d.delay, d.backoff = true, delay, backoff
+}
+func (d *testDelegate) OnTouch(m *nsq.Message) {}
+
+func newTestMessage(body string, attempts uint16) (*nsq.Message, *testDelegate) {
+	var id nsq.MessageID
+	copy(id[:], "0000000000000001")
+	m := nsq.NewMessage(id, []byte(body))
+	m.Attempts = attempts
+	d := new(testDelegate)
+	m.Delegate = d
+	return m, d
+}
+
+func TestMiddleware(t *testing.T) {
+	failed := nsq.HandlerFunc(func(m *nsq.Message) error { return errors.New("failed") })
+
+	Convey("测试中间件顺序", t, func() {
+		var order []string
+		mw := func(name string) Middleware {
+			return func(next nsq.Handler) nsq.Handler {
+				return nsq.HandlerFunc(func(m *nsq.Message) error {
+					order = append(order, name)
+					return next.HandleMessage(m)
+				})
+			}
+		}
+		h := Chain(nsq.HandlerFunc(func(m *nsq.Message) error {
+			order = append(order, "handler")
+			return nil
+		}), mw("a"), mw("b"))
+		m, _ := newTestMessage("x", 1)
+		So(h.HandleMessage(m), ShouldBeNil)
+		So(order, ShouldResemble, []string{"a", "b", "handler"})
+	})
+
+	Convey("测试恢复 panic", t, func() {
+		h := Chain(nsq.HandlerFunc(func(m *nsq.Message) error { panic("boom") }), Recover())
+		m, _ := newTestMessage("x", 1)
+		err := h.HandleMessage(m)
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldContainSubstring, "boom")
+	})
+
+	Convey("测试处理超时", t, func() {
+		h := Chain(nsq.HandlerFunc(func(m *nsq.Message) error {
+			time.Sleep(100 * time.Millisecond)
+			return nil
+		}), Timeout(10*time.Millisecond))
+		m, _ := newTestMessage("x", 1)
+		err := h.HandleMessage(m)
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldContainSubstring, "timeout")
+	})
+
+	Convey("测试重试退避", t, func() {
+		opts := RetryOptions{MinBackoff: time.Second, MaxBackoff: 5 * time.Second, Jitter: 0.1}
+		h := Chain(failed, Retry(opts))
+		m, d := newTestMessage("x", 3)
+		So(h.HandleMessage(m), ShouldBeNil)
+		So(d.requeued, ShouldBeTrue)
+		So(d.backoff, ShouldBeFalse)
+		So(d.delay, ShouldBeBetweenOrEqual, 3600*time.Millisecond, 4400*time.Millisecond)
+
+		So(opts.backoff(9), ShouldBeBetweenOrEqual, 4500*time.Millisecond, 5500*time.Millisecond)
+	})
+
+	Convey("测试最后一次失败后发布到死信 topic", t, func() {
+		f := newFakeNSQD()
+		defer f.Close()
+		p := NewProducer(f.LookupdAddr())
+		So(waitFor(func() bool { return p.Count() > 0 }), ShouldBeTrue)
+
+		h := Chain(failed, Retry(RetryOptions{MaxAttempts: 3, Producer: p, Topic: "order"}))
+		m, d := newTestMessage("payload", 3)
+		So(h.HandleMessage(m), ShouldBeNil)
+		So(d.requeued, ShouldBeFalse)
+		So(f.Published("order_dlq"), ShouldResemble, [][]byte{[]byte("payload")})
+
+		// 死信发布失败时返回错误，消息重新入队
+		f.mu.Lock()
+		f.failPub = true
+		f.mu.Unlock()
+		m, _ = newTestMessage("payload", 3)
+		So(h.HandleMessage(m), ShouldNotBeNil)
+	})
+}
@@ -0,0 +1,270 @@
+package nsq
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"time"
+)
+
+// fakeNSQD 测试用的 nsqd，实现 TCP 协议中消费和发布需要的命令
+type fakeNSQD struct {
+	ln      net.Listener
+	lookupd *httptest.Server
+
+	mu        sync.Mutex
+	queue     chan []byte         // 等待投递的消息
+	published map[string][][]byte // topic => 收到的消息
+	deferred  map[string][]int64  // topic => DPUB 的延迟毫秒数
+	finished  map[string]int      // 消息 ID => FIN 次数
+	requeued  map[string]int      // 消息 ID => REQ 次数
+	attempts  map[string]uint16   // 消息 ID => 投递次数
+	bodies    map[string][]byte   // 消息 ID => 消息内容
+	conns     map[net.Conn]bool   // 当前的连接
+	nextID    int
+	failPub   bool // 发布时返回错误
+}
+
+func newFakeNSQD() *fakeNSQD {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		panic(err)
+	}
+	f := &fakeNSQD{
+		ln:        ln,
+		queue:     make(chan []byte, 100),
+		published: make(map[string][][]byte),
+		deferred:  make(map[string][]int64),
+		finished:  make(map[string]int),
+		requeued:  make(map[string]int),
+		attempts:  make(map[string]uint16),
+		bodies:    make(map[string][]byte),
+		conns:     make(map[net.Conn]bool),
+	}
+	f.lookupd = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		port := ln.Addr().(*net.TCPAddr).Port
+		w.Header().Set("X-NSQ-Content-Type", "nsq; version=1.0")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"channels": []string{},
+			"producers": []map[string]interface{}{
+				{"broadcast_address": "127.0.0.1", "hostname": "fake", "tcp_port": port, "http_port": 0},
+			},
+		})
+	}))
+	go f.serve()
+	return f
+}
+
+// Addr 返回 nsqd 的 TCP 地址
+func (f *fakeNSQD) Addr() string {
+	return f.ln.Addr().String()
+}
+
+// LookupdAddr 返回 nsqlookupd 的 HTTP 地址
+func (f *fakeNSQD) LookupdAddr() string {
+	return strings.TrimPrefix(f.lookupd.URL, "http://")
+}
+
+// Send 投递一条消息给订阅的消费者
+func (f *fakeNSQD) Send(body []byte) {
+	f.queue <- body
+}
+
+// Published 返回 topic 收到的消息
+func (f *fakeNSQD) Published(topic string) [][]byte {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.published[topic]
+}
+
+// Close 关闭所有连接
+func (f *fakeNSQD) Close() {
+	f.ln.Close()
+	f.lookupd.Close()
+	f.mu.Lock()
+	for c := range f.conns {
+		c.Close()
+	}
+	f.mu.Unlock()
+}
+
+func (f *fakeNSQD) count(m map[string]int, id string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return m[id]
+}
+
+func (f *fakeNSQD) serve() {
+	for {
+		conn, err := f.ln.Accept()
+		if err != nil {
+			return
+		}
+		f.mu.Lock()
+		f.conns[conn] = true
+		f.mu.Unlock()
+		go f.handle(conn)
+	}
+}
+
+func (f *fakeNSQD) handle(conn net.Conn) {
+	defer func() {
+		conn.Close()
+		f.mu.Lock()
+		delete(f.conns, conn)
+		f.mu.Unlock()
+	}()
+	r := bufio.NewReader(conn)
+	magic := make([]byte, 4)
+	if _, err := io.ReadFull(r, magic); err != nil {
+		return
+	}
+
+	var wmu sync.Mutex
+	write := func(frameType int32, data []byte) {
+		wmu.Lock()
+		defer wmu.Unlock()
+		buf := make([]byte, 8+len(data))
+		binary.BigEndian.PutUint32(buf, uint32(4+len(data)))
+		binary.BigEndian.PutUint32(buf[4:], uint32(frameType))
+		copy(buf[8:], data)
+		conn.Write(buf)
+	}
+	readBody := func() ([]byte, error) {
+		var size int32
+		if err := binary.Read(r, binary.BigEndian, &size); err != nil {
+			return nil, err
+		}
+		body := make([]byte, size)
+		_, err := io.ReadFull(r, body)
+		return body, err
+	}
+	pubResponse := func() {
+		f.mu.Lock()
+		fail := f.failPub
+		f.mu.Unlock()
+		if fail {
+			write(1, []byte("E_PUB_FAILED"))
+		} else {
+			write(0, []byte("OK"))
+		}
+	}
+
+	closing := make(chan struct{})
+	var closeOnce sync.Once
+	defer closeOnce.Do(func() { close(closing) })
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		params := strings.Fields(line)
+		if len(params) == 0 {
+			continue
+		}
+		switch params[0] {
+		case "IDENTIFY":
+			if _, err = readBody(); err != nil {
+				return
+			}
+			write(0, []byte("OK"))
+		case "SUB":
+			write(0, []byte("OK"))
+			go f.deliver(write, closing)
+		case "RDY", "NOP", "TOUCH":
+		case "FIN":
+			f.mu.Lock()
+			f.finished[params[1]]++
+			f.mu.Unlock()
+		case "REQ":
+			f.mu.Lock()
+			f.requeued[params[1]]++
+			body := f.bodies[params[1]]
+			f.mu.Unlock()
+			f.queue <- body
+		case "CLS":
+			closeOnce.Do(func() { close(closing) })
+			write(0, []byte("CLOSE_WAIT"))
+		case "PUB":
+			body, err := readBody()
+			if err != nil {
+				return
+			}
+			f.mu.Lock()
+			f.published[params[1]] = append(f.published[params[1]], body)
+			f.mu.Unlock()
+			pubResponse()
+		case "DPUB":
+			body, err := readBody()
+			if err != nil {
+				return
+			}
+			var ms int64
+			fmt.Sscan(params[2], &ms)
+			f.mu.Lock()
+			f.published[params[1]] = append(f.published[params[1]], body)
+			f.deferred[params[1]] = append(f.deferred[params[1]], ms)
+			f.mu.Unlock()
+			pubResponse()
+		case "MPUB":
+			body, err := readBody()
+			if err != nil {
+				return
+			}
+			num := binary.BigEndian.Uint32(body)
+			body = body[4:]
+			f.mu.Lock()
+			for i := uint32(0); i < num; i++ {
+				size := binary.BigEndian.Uint32(body)
+				f.published[params[1]] = append(f.published[params[1]], body[4:4+size])
+				body = body[4+size:]
+			}
+			f.mu.Unlock()
+			pubResponse()
+		default:
+			write(1, []byte("E_INVALID"))
+			return
+		}
+	}
+}
+
+// deliver 把队列中的消息投递给消费者，直到连接开始关闭
+func (f *fakeNSQD) deliver(write func(int32, []byte), closing chan struct{}) {
+	for {
+		select {
+		case <-closing:
+			return
+		case body := <-f.queue:
+			f.mu.Lock()
+			id := ""
+			for k, v := range f.bodies {
+				if bytes.Equal(v, body) {
+					id = k
+				}
+			}
+			if id == "" {
+				f.nextID++
+				id = fmt.Sprintf("%016d", f.nextID)
+				f.bodies[id] = body
+			}
+			f.attempts[id]++
+			attempts := f.attempts[id]
+			f.mu.Unlock()
+
+			data := make([]byte, 26+len(body))
+			binary.BigEndian.PutUint64(data, uint64(time.Now().UnixNano()))
+			binary.BigEndian.PutUint16(data[8:], attempts)
+			copy(data[10:], id)
+			copy(data[26:], body)
+			write(2, data)
+		}
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/go-baa/common/util"
@@ -44,24 +45,77 @@ func NewProducer(nsqLookupdAddrs ...string) *Producer {
 
 // Publish publish a msg to a topic
 func (t *Producer) Publish(topic string, body []byte) error {
-	var conn *nsq.Producer
-	t.locker.RLock()
-	if len(t.conn) == 0 {
-		t.locker.RUnlock()
+	return t.publish(topic, 1, func(conn *nsq.Producer, topic string) error {
+		if setting.Debug {
+			log.Debugf("pub:\n    conn: %v\n    topic: %s\n    body: %s\n", conn, topic, body)
+		}
+		return conn.Publish(topic, body)
+	})
+}
+
+// DeferredPublish 发布一条延迟 delay 后投递的消息
+func (t *Producer) DeferredPublish(topic string, delay time.Duration, body []byte) error {
+	return t.publish(topic, 1, func(conn *nsq.Producer, topic string) error {
+		if setting.Debug {
+			log.Debugf("dpub:\n    conn: %v\n    topic: %s\n    delay: %s\n    body: %s\n", conn, topic, delay, body)
+		}
+		return conn.DeferredPublish(topic, delay, body)
+	})
+}
+
+// MultiPublish 一次发布多条消息，同一个 nsqd 上全部成功或全部失败
+func (t *Producer) MultiPublish(topic string, bodies [][]byte) error {
+	return t.publish(topic, len(bodies), func(conn *nsq.Producer, topic string) error {
+		if setting.Debug {
+			log.Debugf("mpub:\n    conn: %v\n    topic: %s\n    count: %d\n", conn, topic, len(bodies))
+		}
+		return conn.MultiPublish(topic, bodies)
+	})
+}
+
+// PublishAsync 异步发布消息，发布完成后从返回的 channel 中读取结果
+func (t *Producer) PublishAsync(topic string, body []byte) <-chan error {
+	done := make(chan error, 1)
+	go func() {
+		done <- t.Publish(topic, body)
+	}()
+	return done
+}
+
+// publish 按顺序在 nsqd 上执行 fn，失败时切换到下一个 nsqd，全部失败时返回最后的错误
+// n 为发布的消息数，用于统计指标
+func (t *Producer) publish(topic string, n int, fn func(conn *nsq.Producer, topic string) error) error {
+	topic = topicName(topic)
+	addrs := t.nsqdAddrsInOrder()
+	if len(addrs) == 0 {
+		addCounter(metricPublishFailed, topic, "", n)
 		return fmt.Errorf("no alive nsqd")
 	}
 
-	nsqPrefix := setting.Config.MustString("nsq.prefix", "")
-	if nsqPrefix != "" {
-		topic = nsqPrefix + "_" + topic
+	start := time.Now()
+	defer func() {
+		observe(metricPublishDuration, topic, "", time.Since(start))
+	}()
+
+	var err error
+	for _, addr := range addrs {
+		t.locker.RLock()
+		conn, ok := t.conn[addr]
+		t.locker.RUnlock()
+		if !ok {
+			continue
+		}
+		if err = fn(conn, topic); err == nil {
+			addCounter(metricPublished, topic, "", n)
+			return nil
+		}
+		log.Warnf("[nsq] publish to %s (%s) error: %v\n", addr, topic, err)
 	}
-	addr := t.nextNSQDAddr()
-	conn = t.conn[addr]
-	t.locker.RUnlock()
-	if setting.Debug {
-		log.Debugf("pub:\n    conn: %v\n    topic: %s\n    body: %s\n", conn, topic, body)
+	addCounter(metricPublishFailed, topic, "", n)
+	if err == nil {
+		return fmt.Errorf("no alive nsqd")
 	}
-	return conn.Publish(topic, body)
+	return err
 }
 
 // Count return producer count
@@ -72,6 +126,30 @@ func (t *Producer) Count() int {
 	return num
 }
 
+// Alive 向所有 nsqd 连接发送 NOP，返回成功的数量，断开的连接会先尝试重连
+func (t *Producer) Alive() int {
+	t.locker.RLock()
+	conns := make([]*nsq.Producer, 0, len(t.conn))
+	for _, conn := range t.conn {
+		conns = append(conns, conn)
+	}
+	t.locker.RUnlock()
+
+	var alive int32
+	var wg sync.WaitGroup
+	for _, conn := range conns {
+		wg.Add(1)
+		go func(conn *nsq.Producer) {
+			defer wg.Done()
+			if conn.Ping() == nil {
+				atomic.AddInt32(&alive, 1)
+			}
+		}(conn)
+	}
+	wg.Wait()
+	return int(alive)
+}
+
 // connectToNSQLookupds adds multiple nsqlookupd address to the list for this Producer instance.
 func (t *Producer) connectToNSQLookupds(addresses []string) error {
 	for _, addr := range addresses {
@@ -189,12 +267,25 @@ func (t *Producer) nextNSQDAddr() string {
 		t.nsqdAddrIndex = 0
 	}
 	addr := t.nsqdAddrs[t.nsqdAddrIndex]
-	num := len(t.nsqLookupdAddrs)
+	num := len(t.nsqdAddrs)
 	t.nsqdAddrIndex = (t.nsqdAddrIndex + 1) % num
 
 	return addr
 }
 
+// nsqdAddrsInOrder 返回从 nextNSQDAddr 开始的所有 nsqd 地址，用于失败时依次切换
+func (t *Producer) nsqdAddrsInOrder() []string {
+	t.locker.Lock()
+	defer t.locker.Unlock()
+	if len(t.nsqdAddrs) == 0 {
+		return nil
+	}
+	start := indexOf(t.nextNSQDAddr(), t.nsqdAddrs)
+	addrs := make([]string, 0, len(t.nsqdAddrs))
+	addrs = append(addrs, t.nsqdAddrs[start:]...)
+	return append(addrs, t.nsqdAddrs[:start]...)
+}
+
 // return the next lookupd endpoint to query
 // keeping track of which one was last used
 func (t *Producer) nextLookupdEndpoint() string {
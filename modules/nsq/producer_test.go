@@ -0,0 +1,79 @@
+package nsq
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	nsq "github.com/nsqio/go-nsq"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// deadAddr 返回一个没有监听的地址
+func deadAddr() string {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		panic(err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+	return addr
+}
+
+func TestProducer(t *testing.T) {
+	Convey("测试轮询 nsqd 地址", t, func() {
+		p := &Producer{nsqLookupdAddrs: []string{"127.0.0.1:4161"}}
+		p.nsqdAddrs = []string{"a", "b", "c"}
+		So(p.nextNSQDAddr(), ShouldEqual, "a")
+		So(p.nextNSQDAddr(), ShouldEqual, "b")
+		So(p.nextNSQDAddr(), ShouldEqual, "c")
+		So(p.nextNSQDAddr(), ShouldEqual, "a")
+		So(p.nsqdAddrsInOrder(), ShouldResemble, []string{"b", "c", "a"})
+	})
+
+	Convey("测试延迟发布和批量发布", t, func() {
+		f := newFakeNSQD()
+		defer f.Close()
+
+		p := NewProducer(f.LookupdAddr())
+		So(waitFor(func() bool { return p.Count() > 0 }), ShouldBeTrue)
+
+		So(p.DeferredPublish("delay", 1500*time.Millisecond, []byte("later")), ShouldBeNil)
+		So(f.Published("delay"), ShouldResemble, [][]byte{[]byte("later")})
+		f.mu.Lock()
+		So(f.deferred["delay"], ShouldResemble, []int64{1500})
+		f.mu.Unlock()
+
+		So(p.MultiPublish("multi", [][]byte{[]byte("a"), []byte("b")}), ShouldBeNil)
+		So(f.Published("multi"), ShouldResemble, [][]byte{[]byte("a"), []byte("b")})
+
+		So(<-p.PublishAsync("async", []byte("hello")), ShouldBeNil)
+		So(f.Published("async"), ShouldResemble, [][]byte{[]byte("hello")})
+	})
+
+	Convey("测试发布失败时切换 nsqd", t, func() {
+		f := newFakeNSQD()
+		defer f.Close()
+
+		p := &Producer{conn: make(map[string]*nsq.Producer)}
+		p.updateNSQDConn([]string{deadAddr(), f.Addr()})
+		So(p.Count(), ShouldEqual, 2)
+		for i := 0; i < 4; i++ {
+			So(p.Publish("test", []byte("hello")), ShouldBeNil)
+		}
+		So(len(f.Published("test")), ShouldEqual, 4)
+
+		Convey("所有 nsqd 失败时返回错误", func() {
+			f.mu.Lock()
+			f.failPub = true
+			f.mu.Unlock()
+			So(p.Publish("test", []byte("hello")), ShouldNotBeNil)
+			So(<-p.PublishAsync("test", []byte("hello")), ShouldNotBeNil)
+		})
+	})
+
+	Convey("测试没有 nsqd 时返回错误", t, func() {
+		p := &Producer{conn: make(map[string]*nsq.Producer)}
+		So(p.Publish("test", []byte("hello")), ShouldNotBeNil)
+	})
+}
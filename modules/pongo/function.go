@@ -34,7 +34,8 @@ func Functions(b *baa.Baa) map[string]interface{} {
 		"strcut": func(str string, length int, dot string) string {
 			return util.StrNatCut(str, length, dot)
 		},
-		"pages": pages,
+		"pages":       pages,
+		"cursorPages": cursorPages,
 		"range": func(start, end int) []int {
 			ret := []int{}
 			for start <= end {
@@ -195,6 +196,26 @@ func pages(items, page, pagesize, visible int) pagesResult {
 	return ret
 }
 
+type cursorPagesResult struct {
+	Cursor  string // 当前页的游标，为空表示第一页
+	Next    string // 下一页的游标
+	HasMore bool   // 是否还有下一页
+	IsFirst bool   // 是否为第一页
+}
+
+// cursorPages 游标分页只能向后翻页，返回首页和下一页的链接参数
+func cursorPages(cursor, next string, hasMore bool) cursorPagesResult {
+	ret := cursorPagesResult{
+		Cursor:  cursor,
+		HasMore: hasMore && next != "",
+		IsFirst: cursor == "",
+	}
+	if ret.HasMore {
+		ret.Next = next
+	}
+	return ret
+}
+
 func replace(subject, search, replace string) string {
 	return strings.Replace(subject, search, replace, -1)
 }
@@ -115,3 +115,17 @@ func TestPages(t *testing.T) {
 		So(ret.Pages[3], ShouldEqual, 29)
 	})
 }
+
+func TestCursorPages(t *testing.T) {
+	Convey("测试游标分页", t, func() {
+		ret := cursorPages("", "next", true)
+		So(ret.IsFirst, ShouldBeTrue)
+		So(ret.HasMore, ShouldBeTrue)
+		So(ret.Next, ShouldEqual, "next")
+
+		ret = cursorPages("cur", "next", false)
+		So(ret.IsFirst, ShouldBeFalse)
+		So(ret.HasMore, ShouldBeFalse)
+		So(ret.Next, ShouldEqual, "")
+	})
+}
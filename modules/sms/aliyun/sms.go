@@ -6,7 +6,6 @@ import (
 	"github.com/denverdino/aliyungo/sms"
 	"github.com/go-baa/common/modules/sms/base"
 	"github.com/go-baa/log"
-	"github.com/go-baa/setting"
 )
 
 // SMS 阿里云短信
@@ -28,42 +27,42 @@ func getConfig(name string) *Config {
 
 	c.Name = name
 
-	c.AppKey = setting.Config.MustString("sms."+name+".ali.app_key", "")
+	c.AppKey = base.Config.MustString("sms."+name+".ali.app_key", "")
 	if c.AppKey == "" {
-		c.AppKey = setting.Config.MustString("sms.ali.app_key", "")
+		c.AppKey = base.Config.MustString("sms.ali.app_key", "")
 	}
 	if c.AppKey == "" {
 		log.Errorf("短信发送失败：阿里云 短信模板配置缺少 app_key %s\n", name)
 		return nil
 	}
 
-	c.Secret = setting.Config.MustString("sms."+name+".ali.secret", "")
+	c.Secret = base.Config.MustString("sms."+name+".ali.secret", "")
 	if c.Secret == "" {
-		c.Secret = setting.Config.MustString("sms.ali.secret", "")
+		c.Secret = base.Config.MustString("sms.ali.secret", "")
 	}
 	if c.Secret == "" {
 		log.Errorf("短信发送失败：阿里云 短信模板配置缺少 secret %s\n", name)
 		return nil
 	}
 
-	c.SMSFreeSignName = setting.Config.MustString("sms."+name+".ali.sms_free_sign_name", "")
+	c.SMSFreeSignName = base.Config.MustString("sms."+name+".ali.sms_free_sign_name", "")
 	if c.SMSFreeSignName == "" {
-		c.SMSFreeSignName = setting.Config.MustString("sms.ali.sms_free_sign_name", "")
+		c.SMSFreeSignName = base.Config.MustString("sms.ali.sms_free_sign_name", "")
 	}
 	if c.SMSFreeSignName == "" {
 		log.Errorf("短信发送失败：阿里云 短信模板配置缺少 sms_free_sign_name %s\n", name)
 		return nil
 	}
 
-	c.SMSTemplateCode = setting.Config.MustString("sms."+name+".ali.sms_template_code", "")
+	c.SMSTemplateCode = base.Config.MustString("sms."+name+".ali.sms_template_code", "")
 	if c.SMSTemplateCode == "" {
 		log.Errorf("短信发送失败：阿里云 短信模板配置缺少 sms_template_code %s\n", name)
 		return nil
 	}
 
-	c.Timeout = setting.Config.MustInt("sms."+name+".ali.timeout", 0)
+	c.Timeout = base.Config.MustInt("sms."+name+".ali.timeout", 0)
 	if c.Timeout == 0 {
-		c.Timeout = setting.Config.MustInt("sms.ali.timeout", 0)
+		c.Timeout = base.Config.MustInt("sms.ali.timeout", 0)
 	}
 	if c.Timeout == 0 {
 		c.Timeout = 3
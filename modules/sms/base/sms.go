@@ -1,5 +1,17 @@
 package base
 
+import "github.com/go-baa/setting"
+
+// Settings 短信模块读取配置的接口，setting.Config 和 consul.Config 都实现了该接口
+type Settings interface {
+	MustString(key string, value string) string
+	MustInt(key string, value int) int
+}
+
+// Config 短信模块读取配置的来源，默认为 setting.Config，在发送短信前设置
+// 每次发送时都会重新读取配置，设置为 consul.Config 后可以热更新提供商和参数
+var Config Settings = setting.Config
+
 // SMSProvider 短信提供商
 type SMSProvider interface {
 	// SendSMSCode 发送短信验证码
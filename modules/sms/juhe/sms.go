@@ -44,30 +44,30 @@ func getConfig(name string) *Config {
 
 	c.Name = name
 
-	c.Key = setting.Config.MustString("sms."+name+".juhe.key", "")
+	c.Key = base.Config.MustString("sms."+name+".juhe.key", "")
 	if c.Key == "" {
-		c.Key = setting.Config.MustString("sms.juhe.key", "")
+		c.Key = base.Config.MustString("sms.juhe.key", "")
 	}
 	if c.Key == "" {
 		log.Errorf("短信发送失败：聚合数据 短信模板配置缺少 key %s\n", name)
 		return nil
 	}
 
-	c.TplID = setting.Config.MustString("sms."+name+".juhe.tpl_id", "")
+	c.TplID = base.Config.MustString("sms."+name+".juhe.tpl_id", "")
 	if c.TplID == "" {
 		log.Errorf("短信发送失败：聚合数据 短信模板配置缺少 tpl_id %s\n", name)
 		return nil
 	}
 
-	c.TplValueRaw = setting.Config.MustString("sms."+name+".juhe.tpl_value_raw", "")
+	c.TplValueRaw = base.Config.MustString("sms."+name+".juhe.tpl_value_raw", "")
 	if c.TplValueRaw == "" {
 		log.Errorf("短信发送失败：聚合数据 短信模板配置缺少 tpl_value_raw %s\n", name)
 		return nil
 	}
 
-	c.Timeout = setting.Config.MustInt("sms."+name+".juhe.timeout", 0)
+	c.Timeout = base.Config.MustInt("sms."+name+".juhe.timeout", 0)
 	if c.Timeout == 0 {
-		c.Timeout = setting.Config.MustInt("sms.juhe.timeout", 0)
+		c.Timeout = base.Config.MustInt("sms.juhe.timeout", 0)
 	}
 	if c.Timeout == 0 {
 		c.Timeout = 3
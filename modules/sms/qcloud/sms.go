@@ -6,7 +6,6 @@ import (
 	"github.com/go-baa/common/modules/sms/base"
 	"github.com/go-baa/common/modules/tencent/sms"
 	"github.com/go-baa/log"
-	"github.com/go-baa/setting"
 )
 
 // SMS 腾讯云短信
@@ -27,36 +26,36 @@ func getConfig(name string) *Config {
 
 	c.Name = name
 
-	c.AppID = setting.Config.MustString("sms."+name+".tencent.appid", "")
+	c.AppID = base.Config.MustString("sms."+name+".tencent.appid", "")
 	if c.AppID == "" {
-		c.AppID = setting.Config.MustString("sms.tencent.appid", "")
+		c.AppID = base.Config.MustString("sms.tencent.appid", "")
 	}
 	if c.AppID == "" {
 		log.Errorf("短信发送失败：腾讯 短信模板配置缺少 appid %s\n", name)
 		return nil
 	}
 
-	c.AppKey = setting.Config.MustString("sms."+name+".tencent.appkey", "")
+	c.AppKey = base.Config.MustString("sms."+name+".tencent.appkey", "")
 	if c.AppKey == "" {
-		c.AppKey = setting.Config.MustString("sms.tencent.appkey", "")
+		c.AppKey = base.Config.MustString("sms.tencent.appkey", "")
 	}
 	if c.AppKey == "" {
 		log.Errorf("短信发送失败：腾讯云 短信模板配置缺少 appkey %s\n", name)
 		return nil
 	}
 
-	c.Sign = setting.Config.MustString("sms."+name+".tencent.sign_name", "")
+	c.Sign = base.Config.MustString("sms."+name+".tencent.sign_name", "")
 	if c.Sign == "" {
-		c.Sign = setting.Config.MustString("sms.tencent.sign_name", "")
+		c.Sign = base.Config.MustString("sms.tencent.sign_name", "")
 	}
 	if c.Sign == "" {
 		log.Errorf("短信发送失败：腾讯云 短信模板配置缺少 sign_name %s\n", name)
 		return nil
 	}
 
-	c.SMSTplID = setting.Config.MustInt("sms."+name+".tencent.sms_tplid", 0)
+	c.SMSTplID = base.Config.MustInt("sms."+name+".tencent.sms_tplid", 0)
 	if c.SMSTplID == 0 {
-		c.SMSTplID = setting.Config.MustInt("sms.tencent.sms_tplid", 0)
+		c.SMSTplID = base.Config.MustInt("sms.tencent.sms_tplid", 0)
 	}
 	if c.SMSTplID == 0 {
 		log.Errorf("短信发送失败：腾讯云 短信模板配置缺少 sms_tplid %s\n", name)
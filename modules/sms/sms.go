@@ -11,39 +11,32 @@ import (
 	"github.com/go-baa/log"
 )
 
+// smsProviders 默认的短信提供商，按顺序尝试
+var smsProviders = []string{"aliyun", "qcloud"}
+
+// providerNames 短信提供商在日志中的名称
+var providerNames = map[string]string{
+	"aliyun": "阿里云",
+	"qcloud": "腾讯云",
+	"juhe":   "聚合数据",
+}
+
 // SendSMSCode 发送短信验证码
+// 默认先尝试阿里云再尝试腾讯云，配置了 sms.provider 时先尝试指定的提供商
+// sms.provider 通过 base.Config 在每次发送时读取，使用 consul.Config 时可以不重启切换提供商
 func SendSMSCode(mobile string, code string) (ret string, err error) {
-	var success bool
 	var count int
-	var provider base.SMSProvider
-
-	// 首先尝试阿里云接口
-	if provider = base.GetSMSProvider("aliyun"); provider != nil {
-		for i := 0; i < 2; i++ {
-			count++
-			ret, err = provider.SendSMSCode(mobile, code)
-			if err == nil {
-				log.Debugf("短信发送成功：阿里云 %s\n", ret)
-				success = true
-				break
-			}
-			time.Sleep(time.Millisecond * 100)
+	for _, name := range orderProviders(base.Config.MustString("sms.provider", "")) {
+		provider := base.GetSMSProvider(name)
+		if provider == nil {
+			continue
 		}
-	}
-
-	if success {
-		return
-	}
-
-	// 再尝试腾讯云接口
-	if provider = base.GetSMSProvider("qcloud"); provider != nil {
 		for i := 0; i < 2; i++ {
 			count++
 			ret, err = provider.SendSMSCode(mobile, code)
 			if err == nil {
-				log.Debugf("短信发送成功：腾讯云 %s\n", ret)
-				success = true
-				break
+				log.Debugf("短信发送成功：%s %s\n", providerNames[name], ret)
+				return
 			}
 			time.Sleep(time.Millisecond * 100)
 		}
@@ -57,6 +50,20 @@ func SendSMSCode(mobile string, code string) (ret string, err error) {
 	return
 }
 
+// orderProviders 返回短信提供商的尝试顺序，preferred 排在最前面
+func orderProviders(preferred string) []string {
+	if preferred == "" {
+		return smsProviders
+	}
+	names := []string{preferred}
+	for _, name := range smsProviders {
+		if name != preferred {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
 // SendVoiceCode 发送语音短信验证码
 func SendVoiceCode(mobile string, code string) (ret string, err error) {
 	var success bool
@@ -0,0 +1,81 @@
+// Package local 本地磁盘存储驱动
+package local
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/go-baa/common/modules/storage"
+	"github.com/go-baa/common/util"
+	"github.com/go-baa/setting"
+)
+
+// Local 将上传文件保存在 upload.basePath 下
+type Local struct {
+	path string // 文件保存的绝对目录
+	uri  string // 文件访问的根URI
+}
+
+// New 根据上传类型创建本地存储
+func New(uploadType string) (storage.Storage, error) {
+	basePath := setting.Config.MustString("upload.basePath", "")
+	if len(basePath) > 1 {
+		basePath = strings.TrimRight(basePath, "/")
+	}
+	baseURI := setting.Config.MustString("upload.baseUri", "")
+	if len(baseURI) > 1 {
+		baseURI = strings.TrimRight(baseURI, "/")
+	}
+
+	uploadPath := strings.Trim(setting.Config.MustString("upload."+uploadType+".path", ""), "/")
+	if uploadPath == "" {
+		uploadPath = uploadType
+	}
+	uploadPath, err := filepath.Abs(basePath + "/" + uploadPath)
+	if err != nil {
+		return nil, fmt.Errorf("上传目录转化失败: %s", err)
+	}
+
+	uploadURI := strings.Trim(setting.Config.MustString("upload."+uploadType+".uri", ""), "/")
+	if uploadURI == "" {
+		uploadURI = uploadType
+	}
+
+	return &Local{path: uploadPath, uri: baseURI + "/" + uploadURI}, nil
+}
+
+// Put 保存文件到本地磁盘
+func (t *Local) Put(key string, r io.Reader, contentType string) (string, int64, error) {
+	dstPath := t.path + "/" + strings.TrimLeft(key, "/")
+	err := util.MkdirAll(filepath.Dir(dstPath))
+	if err != nil {
+		return "", 0, fmt.Errorf("上传目录创建失败: %s", err)
+	}
+	dst, err := os.Create(dstPath)
+	if err != nil {
+		return "", 0, fmt.Errorf("文件创建失败: %s", err)
+	}
+	defer dst.Close()
+	size, err := io.Copy(dst, r)
+	if err != nil {
+		return "", 0, fmt.Errorf("文件写入失败: %s", err)
+	}
+	return dstPath, size, nil
+}
+
+// Delete 删除本地文件
+func (t *Local) Delete(key string) error {
+	return os.Remove(t.path + "/" + strings.TrimLeft(key, "/"))
+}
+
+// URL 返回文件的访问地址
+func (t *Local) URL(key string) string {
+	return t.uri + "/" + strings.TrimLeft(key, "/")
+}
+
+func init() {
+	storage.Register("local", New)
+}
@@ -0,0 +1,52 @@
+package local
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/go-baa/common/modules/storage"
+	"github.com/go-baa/setting"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestLocal(t *testing.T) {
+	Convey("测试本地存储", t, func() {
+		dir, err := ioutil.TempDir("", "storage-local")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+
+		setting.Config.Set("upload.basePath", dir+"/")
+		setting.Config.Set("upload.baseUri", "/upload/")
+		setting.Config.Set("upload.avatar.uri", "/face/")
+		defer setting.Config.Remove("upload.basePath")
+		defer setting.Config.Remove("upload.baseUri")
+		defer setting.Config.Remove("upload.avatar.uri")
+
+		s, err := storage.New("avatar")
+		So(err, ShouldBeNil)
+		So(s, ShouldHaveSameTypeAs, &Local{})
+
+		path, size, err := s.Put("/2020/01/a.png", strings.NewReader("hello"), "image/png")
+		So(err, ShouldBeNil)
+		So(path, ShouldEqual, dir+"/avatar/2020/01/a.png")
+		So(size, ShouldEqual, 5)
+		body, err := ioutil.ReadFile(path)
+		So(err, ShouldBeNil)
+		So(string(body), ShouldEqual, "hello")
+		So(s.URL("2020/01/a.png"), ShouldEqual, "/upload/face/2020/01/a.png")
+
+		So(s.Delete("2020/01/a.png"), ShouldBeNil)
+		_, err = os.Stat(path)
+		So(os.IsNotExist(err), ShouldBeTrue)
+		So(s.Delete("2020/01/a.png"), ShouldNotBeNil)
+	})
+
+	Convey("测试未知驱动", t, func() {
+		setting.Config.Set("upload.avatar.driver", "ftp")
+		defer setting.Config.Remove("upload.avatar.driver")
+		_, err := storage.New("avatar")
+		So(err, ShouldNotBeNil)
+	})
+}
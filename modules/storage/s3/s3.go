@@ -0,0 +1,241 @@
+// Package s3 S3 兼容对象存储驱动，使用 AWS Signature V4 签名
+package s3
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-baa/common/modules/storage"
+	"github.com/go-baa/setting"
+)
+
+// DefaultTimeout 请求超时时间，单位：秒
+const DefaultTimeout = 30
+
+// Config S3 配置
+type Config struct {
+	Endpoint  string // 服务地址，如 https://s3.amazonaws.com
+	Region    string // 区域，如 us-east-1
+	Bucket    string // 存储桶
+	AccessKey string
+	SecretKey string
+	Prefix    string // 对象键前缀
+	URL       string // 对外访问的根地址，为空时使用 Endpoint
+	PathStyle bool   // 使用 endpoint/bucket/key 形式的地址
+	Timeout   int    // 请求超时，单位：秒
+}
+
+// S3 S3 兼容的对象存储
+type S3 struct {
+	config *Config
+	client *http.Client
+}
+
+// getConfig 读取上传类型的 s3 配置，优先 upload.<type>.s3.<key>，其次 upload.s3.<key>
+func getConfig(uploadType string) *Config {
+	c := new(Config)
+	c.Endpoint = storage.Config(uploadType, "s3.endpoint", "")
+	c.Region = storage.Config(uploadType, "s3.region", "us-east-1")
+	c.Bucket = storage.Config(uploadType, "s3.bucket", "")
+	c.AccessKey = storage.Config(uploadType, "s3.access_key", "")
+	c.SecretKey = storage.Config(uploadType, "s3.secret_key", "")
+	c.URL = storage.Config(uploadType, "s3.url", "")
+	c.PathStyle = storage.Config(uploadType, "s3.path_style", "false") == "true"
+	c.Timeout, _ = strconv.Atoi(storage.Config(uploadType, "s3.timeout", strconv.Itoa(DefaultTimeout)))
+
+	c.Prefix = strings.Trim(setting.Config.MustString("upload."+uploadType+".path", ""), "/")
+	if c.Prefix == "" {
+		c.Prefix = uploadType
+	}
+	return c
+}
+
+// New 使用指定配置创建 S3 存储
+func New(c *Config) (*S3, error) {
+	if c.Endpoint == "" || c.Bucket == "" {
+		return nil, fmt.Errorf("s3.New: endpoint and bucket are required")
+	}
+	if !strings.Contains(c.Endpoint, "://") {
+		c.Endpoint = "https://" + c.Endpoint
+	}
+	c.Endpoint = strings.TrimRight(c.Endpoint, "/")
+	if c.Region == "" {
+		c.Region = "us-east-1"
+	}
+	if c.Timeout <= 0 {
+		c.Timeout = DefaultTimeout
+	}
+	return &S3{
+		config: c,
+		client: &http.Client{Timeout: time.Second * time.Duration(c.Timeout)},
+	}, nil
+}
+
+// Put 上传对象，返回对象键
+func (t *S3) Put(key string, r io.Reader, contentType string) (string, int64, error) {
+	// 签名需要内容的摘要，上传大小已受 maxsize 限制，直接读入内存
+	body, err := ioutil.ReadAll(r)
+	if err != nil {
+		return "", 0, fmt.Errorf("文件读取失败: %s", err)
+	}
+
+	objectKey := t.objectKey(key)
+	req, err := http.NewRequest("PUT", t.endpoint(objectKey), bytes.NewReader(body))
+	if err != nil {
+		return "", 0, err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if err = t.do(req, body); err != nil {
+		return "", 0, fmt.Errorf("文件写入失败: %s", err)
+	}
+	return objectKey, int64(len(body)), nil
+}
+
+// Delete 删除对象
+func (t *S3) Delete(key string) error {
+	req, err := http.NewRequest("DELETE", t.endpoint(t.objectKey(key)), nil)
+	if err != nil {
+		return err
+	}
+	return t.do(req, nil)
+}
+
+// URL 返回对象的访问地址
+func (t *S3) URL(key string) string {
+	if t.config.URL != "" {
+		return strings.TrimRight(t.config.URL, "/") + "/" + escapePath(t.objectKey(key))
+	}
+	return t.endpoint(t.objectKey(key))
+}
+
+// objectKey 返回带前缀的对象键
+func (t *S3) objectKey(key string) string {
+	key = strings.TrimLeft(key, "/")
+	if t.config.Prefix == "" {
+		return key
+	}
+	return t.config.Prefix + "/" + key
+}
+
+// endpoint 返回对象的请求地址
+func (t *S3) endpoint(objectKey string) string {
+	if t.config.PathStyle {
+		return t.config.Endpoint + "/" + t.config.Bucket + "/" + escapePath(objectKey)
+	}
+	u, err := url.Parse(t.config.Endpoint)
+	if err != nil {
+		return t.config.Endpoint + "/" + escapePath(objectKey)
+	}
+	return u.Scheme + "://" + t.config.Bucket + "." + u.Host + "/" + escapePath(objectKey)
+}
+
+// do 签名并发送请求
+func (t *S3) do(req *http.Request, body []byte) error {
+	t.sign(req, body, time.Now().UTC())
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		respBody, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("got response %s %q", resp.Status, respBody)
+	}
+	return nil
+}
+
+// sign 使用 AWS Signature V4 为请求签名
+func (t *S3) sign(req *http.Request, body []byte, now time.Time) {
+	payloadHash := sha256Hex(body)
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	// 参与签名的头信息
+	headers := map[string]string{
+		"host":                 req.URL.Host,
+		"x-amz-content-sha256": payloadHash,
+		"x-amz-date":           amzDate,
+	}
+	if v := req.Header.Get("Content-Type"); v != "" {
+		headers["content-type"] = v
+	}
+	names := make([]string, 0, len(headers))
+	for k := range headers {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	var canonicalHeaders bytes.Buffer
+	for _, k := range names {
+		canonicalHeaders.WriteString(k + ":" + strings.TrimSpace(headers[k]) + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.Query().Encode(),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := date + "/" + t.config.Region + "/s3/aws4_request"
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + sha256Hex([]byte(canonicalRequest))
+
+	key := hmacSHA256([]byte("AWS4"+t.config.SecretKey), date)
+	key = hmacSHA256(key, t.config.Region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		t.config.AccessKey, scope, signedHeaders, signature))
+}
+
+func sha256Hex(b []byte) string {
+	h := sha256.Sum256(b)
+	return hex.EncodeToString(h[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// escapePath 按 S3 的规则编码对象路径，保留 /
+func escapePath(p string) string {
+	var buf bytes.Buffer
+	for i := 0; i < len(p); i++ {
+		c := p[i]
+		if (c >= 'A' && c <= 'Z') || (c >= 'a' && c <= 'z') || (c >= '0' && c <= '9') ||
+			c == '-' || c == '_' || c == '.' || c == '~' || c == '/' {
+			buf.WriteByte(c)
+			continue
+		}
+		fmt.Fprintf(&buf, "%%%02X", c)
+	}
+	return buf.String()
+}
+
+func init() {
+	storage.Register("s3", func(uploadType string) (storage.Storage, error) {
+		return New(getConfig(uploadType))
+	})
+}
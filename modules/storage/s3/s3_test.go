@@ -0,0 +1,89 @@
+package s3
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-baa/setting"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestS3PutDelete(t *testing.T) {
+	Convey("测试S3上传和删除", t, func() {
+		var method, path, auth, payloadHash, contentType, body string
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			method = r.Method
+			path = r.URL.EscapedPath()
+			auth = r.Header.Get("Authorization")
+			payloadHash = r.Header.Get("X-Amz-Content-Sha256")
+			contentType = r.Header.Get("Content-Type")
+			b, _ := ioutil.ReadAll(r.Body)
+			body = string(b)
+			if strings.Contains(path, "forbidden") {
+				w.WriteHeader(http.StatusForbidden)
+			}
+		}))
+		defer ts.Close()
+
+		s, err := New(&Config{
+			Endpoint:  ts.URL,
+			Bucket:    "bucket",
+			AccessKey: "AKID",
+			SecretKey: "SECRET",
+			Prefix:    "avatar",
+			URL:       "https://cdn.example.com",
+			PathStyle: true,
+		})
+		So(err, ShouldBeNil)
+
+		key, size, err := s.Put("2020/01/头像.png", strings.NewReader("hello"), "image/png")
+		So(err, ShouldBeNil)
+		So(key, ShouldEqual, "avatar/2020/01/头像.png")
+		So(size, ShouldEqual, 5)
+		So(method, ShouldEqual, "PUT")
+		So(path, ShouldEqual, "/bucket/avatar/2020/01/%E5%A4%B4%E5%83%8F.png")
+		So(body, ShouldEqual, "hello")
+		So(contentType, ShouldEqual, "image/png")
+		So(payloadHash, ShouldEqual, sha256Hex([]byte("hello")))
+		So(auth, ShouldStartWith, "AWS4-HMAC-SHA256 Credential=AKID/")
+		So(auth, ShouldContainSubstring, "SignedHeaders=content-type;host;x-amz-content-sha256;x-amz-date")
+		So(s.URL("2020/01/a.png"), ShouldEqual, "https://cdn.example.com/avatar/2020/01/a.png")
+		So(s.URL("2020/01/a b#1?.png"), ShouldEqual, "https://cdn.example.com/avatar/2020/01/a%20b%231%3F.png")
+
+		err = s.Delete("2020/01/a.png")
+		So(err, ShouldBeNil)
+		So(method, ShouldEqual, "DELETE")
+		So(path, ShouldEqual, "/bucket/avatar/2020/01/a.png")
+
+		_, _, err = s.Put("forbidden.png", strings.NewReader("hello"), "")
+		So(err, ShouldNotBeNil)
+	})
+}
+
+func TestS3Config(t *testing.T) {
+	Convey("测试按上传类型读取配置", t, func() {
+		setting.Config.Set("upload.s3.endpoint", "s3.example.com")
+		setting.Config.Set("upload.s3.timeout", "10")
+		setting.Config.Set("upload.avatar.s3.bucket", "avatar")
+		setting.Config.Set("upload.avatar.s3.timeout", "5")
+		defer setting.Config.Remove("upload.s3.endpoint")
+		defer setting.Config.Remove("upload.s3.timeout")
+		defer setting.Config.Remove("upload.avatar.s3.bucket")
+		defer setting.Config.Remove("upload.avatar.s3.timeout")
+
+		c := getConfig("avatar")
+		So(c.Endpoint, ShouldEqual, "s3.example.com")
+		So(c.Bucket, ShouldEqual, "avatar")
+		So(c.Timeout, ShouldEqual, 5)
+		So(c.Prefix, ShouldEqual, "avatar")
+		So(getConfig("file").Timeout, ShouldEqual, 10)
+
+		s, err := New(c)
+		So(err, ShouldBeNil)
+		So(s.client.Timeout.Seconds(), ShouldEqual, 5)
+		So(s.URL("a b.png"), ShouldEqual, "https://avatar.s3.example.com/avatar/a%20b.png")
+	})
+}
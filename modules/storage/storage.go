@@ -0,0 +1,57 @@
+// Package storage 提供上传文件的存储驱动，按 upload.<type>.driver 选择
+package storage
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/go-baa/setting"
+)
+
+// DefaultDriver 默认存储驱动
+const DefaultDriver = "local"
+
+// Storage 上传文件存储接口
+type Storage interface {
+	// Put 保存文件内容到 key，返回文件的存储路径和写入的字节数
+	Put(key string, r io.Reader, contentType string) (string, int64, error)
+	// Delete 删除 key 对应的文件
+	Delete(key string) error
+	// URL 返回 key 对应的访问地址
+	URL(key string) string
+}
+
+// Driver 根据上传类型创建一个存储实例
+type Driver func(uploadType string) (Storage, error)
+
+var drivers = make(map[string]Driver)
+
+// Register 注册一个存储驱动
+func Register(name string, driver Driver) {
+	if driver == nil {
+		panic("storage.Register: cannot register driver with nil func")
+	}
+	if _, ok := drivers[name]; ok {
+		panic(fmt.Errorf("storage.Register: cannot register driver '%s' twice", name))
+	}
+	drivers[name] = driver
+}
+
+// New 根据上传类型的配置创建存储实例，未配置驱动时使用本地存储
+func New(uploadType string) (Storage, error) {
+	name := Config(uploadType, "driver", DefaultDriver)
+	driver, ok := drivers[name]
+	if !ok {
+		return nil, fmt.Errorf("storage.New: unknown driver '%s' (forgot to import?)", name)
+	}
+	return driver(uploadType)
+}
+
+// Config 读取上传类型的配置，优先 upload.<type>.<key>，其次 upload.<key>
+func Config(uploadType, key, defaultValue string) string {
+	v := setting.Config.MustString("upload."+uploadType+"."+key, "")
+	if v == "" {
+		v = setting.Config.MustString("upload."+key, defaultValue)
+	}
+	return v
+}
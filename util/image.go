@@ -465,28 +465,14 @@ func GenerateTextAvatar(file, text string, fontFamily []byte, bgColor string, si
 // fontFamily 字体文件
 // size 是生成图片的尺寸，等比的宽高
 func GenerateTextImage(text string, fontFamily []byte, size int) (*image.RGBA, error) {
-	var fontBytes []byte
-	var err error
-	if fontFamily == nil {
-		fontBytes = gomono.TTF
-	} else {
-		fontBytes = fontFamily
-	}
-	f, err := truetype.Parse(fontBytes)
+	var fontNum = float64(len([]rune(text)))
+	var fontSize = float64(size) / fontNum
+
+	face, err := newFontFace(fontFamily, fontSize)
 	if err != nil {
 		return nil, err
 	}
-
-	var fontDPI float64 = 72  // screen resolution in dots per inch
-	var fontSize float64 = 12 // font size in points
-	var fontNum = float64(len([]rune(text)))
-	fontSize = float64(size) / fontNum
-
-	face := truetype.NewFace(f, &truetype.Options{
-		Size:    fontSize,
-		DPI:     fontDPI,
-		Hinting: font.HintingNone,
-	})
+	defer face.Close()
 
 	rgba := image.NewRGBA(image.Rect(0, 0, int(fontSize*fontNum), int(fontSize)))
 	d := &font.Drawer{
@@ -504,6 +490,49 @@ func GenerateTextImage(text string, fontFamily []byte, size int) (*image.RGBA, e
 	return rgba, nil
 }
 
+// GenerateTextImageWithSize 按字号和颜色生成文字的图像，图像的宽高与文字一致
+// fontFamily 为 nil 时使用 gomono 字体
+func GenerateTextImageWithSize(text string, fontFamily []byte, fontSize float64, c color.Color) (*image.RGBA, error) {
+	face, err := newFontFace(fontFamily, fontSize)
+	if err != nil {
+		return nil, err
+	}
+	defer face.Close()
+
+	metrics := face.Metrics()
+	w := font.MeasureString(face, text).Ceil()
+	h := (metrics.Ascent + metrics.Descent).Ceil()
+	if w <= 0 || h <= 0 {
+		return nil, errors.New("text is empty")
+	}
+
+	rgba := image.NewRGBA(image.Rect(0, 0, w, h))
+	d := &font.Drawer{
+		Dst:  rgba,
+		Src:  image.NewUniform(c),
+		Face: face,
+		Dot:  fixed.Point26_6{X: 0, Y: metrics.Ascent},
+	}
+	d.DrawString(text)
+	return rgba, nil
+}
+
+// newFontFace 解析字体文件，fontFamily 为 nil 时使用 gomono 字体
+func newFontFace(fontFamily []byte, fontSize float64) (font.Face, error) {
+	if fontFamily == nil {
+		fontFamily = gomono.TTF
+	}
+	f, err := truetype.Parse(fontFamily)
+	if err != nil {
+		return nil, err
+	}
+	return truetype.NewFace(f, &truetype.Options{
+		Size:    fontSize,
+		DPI:     72, // screen resolution in dots per inch
+		Hinting: font.HintingNone,
+	}), nil
+}
+
 // RGBA2HexColor returns the hex "html" representation of the color, as in #FF0080.
 func RGBA2HexColor(c color.RGBA) string {
 	return fmt.Sprintf("#%02X%02X%02X", c.R, c.G, c.B)